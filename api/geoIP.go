@@ -3,9 +3,13 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/shreethaar/heroPacket/internal/analysis"
 	"io"
 	"net"
 	"net/http"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/pcap"
@@ -21,6 +25,8 @@ type IPInfo struct {
 	Country string `json:"country"`
 	Loc     string `json:"loc"`
 	Org     string `json:"org"`
+	// Hostname is filled in from the names observed in the capture
+	Hostname string `json:"hostname,omitempty"`
 }
 
 // IsPrivateIP checks if an IP address is private
@@ -74,10 +80,19 @@ func ExtractPublicIPs(pcapFile string) (map[string]struct{}, error) {
 	return publicIPs, nil
 }
 
+var ipInfoClient = &http.Client{Timeout: 5 * time.Second}
+
+// Lookups already made, including failed ones, so pages that show many
+// addresses do not query the API again on every load
+var ipInfoCache = struct {
+	sync.Mutex
+	entries map[string]*IPInfo
+}{entries: make(map[string]*IPInfo)}
+
 // GetIPInfo fetches geolocation data for an IP using the ipinfo.io API
 func GetIPInfo(ip string) (*IPInfo, error) {
 	url := fmt.Sprintf("https://ipinfo.io/%s/json?token=%s", ip, IPINFO_TOKEN)
-	resp, err := http.Get(url)
+	resp, err := ipInfoClient.Get(url)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching IP info: %v", err)
 	}
@@ -100,6 +115,32 @@ func GetIPInfo(ip string) (*IPInfo, error) {
 	return &ipData, nil
 }
 
+// LookupIPInfo returns cached geolocation data for a public IP, fetching it
+// on first use. It returns nil for private, multicast and other non-routable
+// addresses and for failed lookups.
+func LookupIPInfo(ip string) *IPInfo {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || !parsed.IsGlobalUnicast() || parsed.IsPrivate() || IsPrivateIP(ip) {
+		return nil
+	}
+
+	ipInfoCache.Lock()
+	info, cached := ipInfoCache.entries[ip]
+	ipInfoCache.Unlock()
+	if cached {
+		return info
+	}
+
+	info, err := GetIPInfo(ip)
+	if err != nil {
+		info = nil
+	}
+	ipInfoCache.Lock()
+	ipInfoCache.entries[ip] = info
+	ipInfoCache.Unlock()
+	return info
+}
+
 // ProcessPCAPAndFetchGeoInfo processes a PCAP file and fetches geolocation data for public IPs
 func ProcessPCAPAndFetchGeoInfo(pcapFile string) ([]IPInfo, error) {
 	publicIPs, err := ExtractPublicIPs(pcapFile)
@@ -126,3 +167,26 @@ func ProcessPCAPAndFetchGeoInfo(pcapFile string) ([]IPInfo, error) {
 
 
 
+
+// GeoIPTable locates the public addresses of a capture, labelled with the
+// names they were seen with. Failed lookups are left out, as on the GeoIP
+// page.
+func GeoIPTable(filePath string, names map[string]string) (*analysis.Table, error) {
+	publicIPs, err := ExtractPublicIPs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]string, 0, len(publicIPs))
+	for ip := range publicIPs {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	table := analysis.NewTable(analysis.TableGeoIP)
+	for _, ip := range ips {
+		if info := LookupIPInfo(ip); info != nil {
+			table.Add(ip, names[ip], info.City, info.Region, info.Country, info.Loc, info.Org)
+		}
+	}
+	return table, nil
+}
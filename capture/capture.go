@@ -0,0 +1,234 @@
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/google/gopacket"
+)
+
+// Version is the semantic version of the package API
+const Version = "2.0.0"
+
+// Built-in analyzers for Options.Analyzers
+const (
+	Protocols     = analysis.AnalyzerProtocols     // Protocol hierarchy
+	Traffic       = analysis.AnalyzerTraffic       // Packet and byte totals
+	Conversations = analysis.AnalyzerConversations // Conversations at each layer
+	Endpoints     = analysis.AnalyzerEndpoints     // Ethernet, IP, TCP and UDP endpoints
+	DNS           = analysis.AnalyzerDNS           // DNS transactions and threats
+	HTTP          = analysis.AnalyzerHTTP          // HTTP/1.x transactions
+	TLS           = analysis.AnalyzerTLS           // TLS handshakes and certificates
+	NetworkMap    = analysis.AnalyzerNetworkMap    // Hosts, their roles and connections
+	Findings      = analysis.AnalyzerFindings      // Expert findings
+)
+
+// ErrNotAnalyzed is returned for the results of analyzers left out by
+// Options.Analyzers
+var ErrNotAnalyzed = errors.New("capture: analyzer not enabled")
+
+// ErrNotFinished is returned for results asked for before Finish
+var ErrNotFinished = errors.New("capture: analysis not finished")
+
+// Analyzers returns the names of every analyzer, the built-in ones and
+// those registered with heroPacket, in the order they run
+func Analyzers() []string {
+	var names []string
+	for _, plugin := range analysis.Plugins() {
+		names = append(names, plugin.Name)
+	}
+	return names
+}
+
+// Options configure an analysis. The zero value runs every analyzer.
+type Options struct {
+	// Analyzers to run, every one when empty. Analyzers that require one
+	// left out do not run either.
+	Analyzers []string
+
+	// Config sets options of analyzers by analyzer and option name. Values
+	// are written as on the command line, e.g. "5" or "true".
+	Config map[string]map[string]string
+
+	// KeyLog holds TLS secrets in SSLKEYLOGFILE format for decrypting TLS.
+	// Open adds them to the secrets embedded in pcapng files.
+	KeyLog io.Reader
+
+	// KeyLogFile names a file of TLS secrets read along with KeyLog, such
+	// as the one heroPacket keeps next to an uploaded capture. A file that
+	// does not exist is skipped.
+	KeyLogFile string
+
+	// CacheDir is where Open keeps an index of each capture's packets,
+	// named after the capture file, so reopening an unchanged capture
+	// reads it once. Open writes nothing when it is empty.
+	CacheDir string
+}
+
+// sessionRef is embedded by Analysis under a name other packages cannot use
+type sessionRef = analysis.SessionRef
+
+// Analysis is the analysis of one capture. It is not safe for concurrent
+// use until Finish returns; after that its results may be read from any
+// goroutine.
+type Analysis struct {
+	sessionRef // For analysis.SessionOf
+	session    *analysis.Session
+	packets    int
+	finished   bool
+	warnings   []error
+}
+
+// New starts an analysis that is given its packets by Process
+func New(opts Options) (*Analysis, error) {
+	a, err := newAnalysis(opts)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := readKeyLogs(analysis.NewKeyLog(), opts)
+	if err != nil {
+		return nil, err
+	}
+	if keys.Len() > 0 {
+		a.session.SetKeyLog(keys)
+	}
+	return a, nil
+}
+
+// Open analyses a pcap or pcapng file. Problems that do not stop the
+// analysis, such as an unreadable stored key log, are kept as warnings.
+func Open(path string, opts Options) (*Analysis, error) {
+	a, err := newAnalysis(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	packets, err := analysis.ExtractPackets(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := analysis.LoadKeyLog(path, "")
+	if err != nil {
+		a.warnings = append(a.warnings, fmt.Errorf("ignoring embedded TLS secrets: %w", err))
+	}
+	if keys == nil {
+		keys = analysis.NewKeyLog()
+	}
+	if keys, err = readKeyLogs(keys, opts); err != nil {
+		return nil, err
+	}
+	if keys.Len() > 0 {
+		a.session.SetKeyLog(keys)
+	}
+
+	indexPath := ""
+	if opts.CacheDir != "" {
+		indexPath = filepath.Join(opts.CacheDir, filepath.Base(path)+".idx")
+	}
+	index, err := analysis.LoadPacketIndex(path, indexPath)
+	if err != nil {
+		a.warnings = append(a.warnings, fmt.Errorf("could not index: %w", err))
+	}
+	a.session.SetIndex(index)
+
+	for _, packet := range packets {
+		a.session.Process(packet)
+	}
+	a.packets = len(packets)
+	a.Finish()
+	return a, nil
+}
+
+// readKeyLogs adds the secrets of Options.KeyLog and Options.KeyLogFile
+func readKeyLogs(keys *analysis.KeyLog, opts Options) (*analysis.KeyLog, error) {
+	if opts.KeyLog != nil {
+		if err := keys.Read(opts.KeyLog); err != nil {
+			return nil, fmt.Errorf("capture: reading key log: %w", err)
+		}
+	}
+	if opts.KeyLogFile != "" {
+		file, err := os.Open(opts.KeyLogFile)
+		if os.IsNotExist(err) {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("capture: %w", err)
+		}
+		defer file.Close()
+		if err := keys.Read(file); err != nil {
+			return nil, fmt.Errorf("capture: reading %s: %w", opts.KeyLogFile, err)
+		}
+	}
+	return keys, nil
+}
+
+func newAnalysis(opts Options) (*Analysis, error) {
+	session := analysis.NewSession()
+	if len(opts.Analyzers) > 0 {
+		chosen := make(map[string]bool)
+		for _, name := range opts.Analyzers {
+			if _, known := analysis.LookupPlugin(name); !known {
+				return nil, fmt.Errorf("capture: unknown analyzer %q", name)
+			}
+			chosen[name] = true
+		}
+		for _, name := range Analyzers() {
+			if !chosen[name] {
+				session.Disable(name)
+			}
+		}
+	}
+	for name, values := range opts.Config {
+		if err := session.Configure(name, values); err != nil {
+			return nil, fmt.Errorf("capture: %w", err)
+		}
+	}
+	return &Analysis{sessionRef: analysis.NewSessionRef(session), session: session}, nil
+}
+
+// Process analyses the next packet of the capture. Packets must come in
+// capture order and before Finish.
+func (a *Analysis) Process(packet gopacket.Packet) {
+	if a.finished {
+		return
+	}
+	a.packets++
+	a.session.Process(analysis.DecodePacket(packet, a.packets))
+}
+
+// Finish completes the analysis once every packet has been processed:
+// reassembled streams are parsed and findings are collected. Calling it
+// again has no effect.
+func (a *Analysis) Finish() {
+	if a.finished {
+		return
+	}
+	a.session.Finish()
+	a.finished = true
+}
+
+// Enabled reports whether an analyzer runs in this analysis
+func (a *Analysis) Enabled(name string) bool {
+	return a.session.Enabled(name)
+}
+
+// Warnings returns the problems that did not stop the analysis
+func (a *Analysis) Warnings() []error {
+	return append([]error(nil), a.warnings...)
+}
+
+// ready checks that the results of an analyzer can be read
+func (a *Analysis) ready(name string) error {
+	if !a.finished {
+		return ErrNotFinished
+	}
+	if !a.session.Enabled(name) {
+		return ErrNotAnalyzed
+	}
+	return nil
+}
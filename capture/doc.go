@@ -0,0 +1,43 @@
+// Package capture analyses packet captures with heroPacket's analyzers
+// through a stable API, for the command line tools, the examples and other
+// programs.
+//
+// Open reads and analyses a pcap or pcapng file in one call:
+//
+//	a, err := capture.Open("trace.pcapng", capture.Options{})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	summary, _ := a.Summary()
+//	fmt.Println(summary.Packets, "packets")
+//
+//	queries, _ := a.DNSQueries()
+//	for _, q := range queries {
+//		fmt.Println(q.Name, q.ResponseCode)
+//	}
+//
+// New analyses packets from any other source, such as a live capture.
+// Process takes the packets in order and Finish completes the analysis:
+//
+//	a, err := capture.New(capture.Options{Analyzers: []string{capture.DNS, capture.Findings}})
+//	for packet := range source.Packets() {
+//		a.Process(packet)
+//	}
+//	a.Finish()
+//
+// Options.Analyzers chooses the analyzers to run, from those Analyzers
+// lists, and Options.Config sets their options. The results of the others
+// return ErrNotAnalyzed. Open only reads the capture unless
+// Options.KeyLogFile names a key log to read or Options.CacheDir a
+// directory to keep packet indexes in.
+//
+// # Compatibility
+//
+// The package follows semantic versioning, with its version in Version.
+// Within a major version exported names keep their meaning and signatures;
+// minor versions may add analyzers, functions and result fields, so
+// construct result types with field names. The CHANGELOG next to this file
+// records every version.
+//
+// The examples directory holds complete programs.
+package capture
@@ -0,0 +1,56 @@
+// DNS reads packets itself and feeds them to an analysis that only runs the
+// DNS analyzer, then prints every query with its answers:
+//
+//	go run ./capture/examples/dns trace.pcapng
+package main
+
+import (
+	"fmt"
+	"github.com/shreethaar/heroPacket/capture"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcapgo"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: dns <file>")
+		os.Exit(2)
+	}
+	f, err := os.Open(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcapgo.NewNgReader(f, pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	a, err := capture.New(capture.Options{Analyzers: []string{capture.DNS}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for packet := range gopacket.NewPacketSource(r, r.LinkType()).Packets() {
+		a.Process(packet)
+	}
+	a.Finish()
+
+	queries, err := a.DNSQueries()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, q := range queries {
+		answer := "no response"
+		if q.Answered {
+			answer = q.ResponseCode
+			if len(q.Answers) > 0 {
+				answer += " " + strings.Join(q.Answers, ", ")
+			}
+		}
+		fmt.Printf("%s %s %s -> %s\n", q.QueryTime.Format("15:04:05.000"), q.Type, q.Name, answer)
+	}
+}
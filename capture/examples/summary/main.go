@@ -0,0 +1,60 @@
+// Summary prints the totals, busiest conversations and findings of a capture:
+//
+//	go run ./capture/examples/summary trace.pcapng
+package main
+
+import (
+	"fmt"
+	"github.com/shreethaar/heroPacket/capture"
+	"log"
+	"os"
+	"sort"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: summary <file>")
+		os.Exit(2)
+	}
+	a, err := capture.Open(os.Args[1], capture.Options{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, warning := range a.Warnings() {
+		log.Println("warning:", warning)
+	}
+
+	summary, err := a.Summary()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%d packets, %d bytes", summary.Packets, summary.Bytes)
+	if !summary.Start.IsZero() {
+		fmt.Printf(" over %s", summary.End.Sub(summary.Start))
+	}
+	fmt.Println()
+
+	conversations, err := a.Conversations()
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.SliceStable(conversations, func(i, j int) bool {
+		return conversations[i].Bytes > conversations[j].Bytes
+	})
+	if len(conversations) > 5 {
+		conversations = conversations[:5]
+	}
+	fmt.Println("\nBusiest conversations:")
+	for _, conv := range conversations {
+		fmt.Printf("  %-5s %s <-> %s  %d bytes\n", conv.Type, conv.AddressA, conv.AddressB, conv.Bytes)
+	}
+
+	findings, err := a.Findings()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("\n%d findings:\n", len(findings))
+	for _, finding := range findings {
+		fmt.Printf("  [%s] %s\n", finding.Severity, finding.Summary)
+	}
+}
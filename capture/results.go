@@ -0,0 +1,407 @@
+package capture
+
+import (
+	"bytes"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"net"
+	"sort"
+	"time"
+)
+
+// Finding severities, most severe first
+const (
+	SeverityError = analysis.ExpertError
+	SeverityWarn  = analysis.ExpertWarn
+	SeverityNote  = analysis.ExpertNote
+	SeverityChat  = analysis.ExpertChat
+)
+
+// Summary totals the packets of a capture
+type Summary struct {
+	Packets int       `json:"packets"`
+	Bytes   int       `json:"bytes"`
+	Start   time.Time `json:"start"` // Zero for an empty capture
+	End     time.Time `json:"end"`
+}
+
+// ProtocolNode is one protocol of the hierarchy with the protocols carried
+// inside it
+type ProtocolNode struct {
+	Name     string          `json:"name"`
+	Packets  int             `json:"packets"`
+	Bytes    int             `json:"bytes"`
+	Percent  float64         `json:"percent"` // Of all packets
+	Children []*ProtocolNode `json:"children,omitempty"`
+}
+
+// Conversation is the traffic between two addresses at one layer. The
+// addresses of TCP and UDP conversations include the port.
+type Conversation struct {
+	Type        string    `json:"type"` // Ethernet, IPv4, IPv6, TCP or UDP
+	AddressA    string    `json:"address_a"`
+	AddressB    string    `json:"address_b"`
+	Protocol    string    `json:"protocol"`
+	Packets     int       `json:"packets"`
+	Bytes       int       `json:"bytes"`
+	PacketsAToB int       `json:"packets_a_to_b"`
+	BytesAToB   int       `json:"bytes_a_to_b"`
+	PacketsBToA int       `json:"packets_b_to_a"`
+	BytesBToA   int       `json:"bytes_b_to_a"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	State       string    `json:"state"` // TCP connection state
+	SNI         string    `json:"sni"`   // Server name of the latest TLS handshake
+}
+
+// Endpoint is one address that sent or received packets
+type Endpoint struct {
+	Type            string    `json:"type"` // Ethernet, IPv4, IPv6, TCP or UDP
+	Address         string    `json:"address"`
+	MAC             string    `json:"mac"`
+	Name            string    `json:"name"` // Passively resolved name of an IP endpoint
+	PacketsSent     int       `json:"packets_sent"`
+	BytesSent       int       `json:"bytes_sent"`
+	PacketsReceived int       `json:"packets_received"`
+	BytesReceived   int       `json:"bytes_received"`
+	FirstSeen       time.Time `json:"first_seen"`
+	LastSeen        time.Time `json:"last_seen"`
+	Protocols       []string  `json:"protocols"`
+	ListeningPorts  []int     `json:"listening_ports"`
+}
+
+// DNSQuery is a DNS query paired with its response
+type DNSQuery struct {
+	ID              int           `json:"id"`
+	Client          string        `json:"client"`
+	ClientPort      int           `json:"client_port"`
+	Resolver        string        `json:"resolver"`
+	ResolverPort    int           `json:"resolver_port"`
+	Transport       string        `json:"transport"` // UDP or TCP
+	Name            string        `json:"name"`
+	Type            string        `json:"type"`
+	QueryTime       time.Time     `json:"query_time"`
+	Answered        bool          `json:"answered"`
+	ResponseTime    time.Time     `json:"response_time"`
+	Latency         time.Duration `json:"latency"`
+	ResponseCode    string        `json:"response_code"`
+	Answers         []string      `json:"answers"` // Type and data of each answer, e.g. "A 192.0.2.1"
+	Retransmissions int           `json:"retransmissions"`
+}
+
+// HTTPTransaction is an HTTP/1.x request with its response
+type HTTPTransaction struct {
+	Client       string        `json:"client"`
+	Server       string        `json:"server"`
+	ServerPort   int           `json:"server_port"`
+	Method       string        `json:"method"`
+	Host         string        `json:"host"`
+	URI          string        `json:"uri"`
+	UserAgent    string        `json:"user_agent"`
+	Status       int           `json:"status"` // Zero when there was no response
+	ContentType  string        `json:"content_type"`
+	RequestSize  int           `json:"request_size"`
+	ResponseSize int           `json:"response_size"`
+	RequestTime  time.Time     `json:"request_time"`
+	ResponseTime time.Time     `json:"response_time"`
+	Latency      time.Duration `json:"latency"`
+}
+
+// TLSHandshake is the handshake of one TLS connection
+type TLSHandshake struct {
+	Client      string `json:"client"`
+	ClientPort  int    `json:"client_port"`
+	Server      string `json:"server"`
+	ServerPort  int    `json:"server_port"`
+	SNI         string `json:"sni"`
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipher_suite"`
+	ALPN        string `json:"alpn"`
+	JA3         string `json:"ja3"`
+	JA3S        string `json:"ja3s"`
+	JA4         string `json:"ja4"`
+	Decrypted   bool   `json:"decrypted"`
+}
+
+// Host is one IP address of the network map
+type Host struct {
+	IP       string   `json:"ip"`
+	Role     string   `json:"role"` // client, server or router
+	Hostname string   `json:"hostname"`
+	Ports    []int    `json:"ports"`
+	Services []string `json:"services"`
+}
+
+// Connection is the traffic from one host to another over one protocol
+type Connection struct {
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Protocol    string    `json:"protocol"`
+	Packets     int       `json:"packets"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// Finding is an expert observation about the capture
+type Finding struct {
+	Severity string    `json:"severity"`
+	Group    string    `json:"group"` // malformed, sequence, protocol or security
+	Protocol string    `json:"protocol"`
+	Summary  string    `json:"summary"`
+	Detail   string    `json:"detail"`
+	Packet   int       `json:"packet"` // Zero when not tied to one packet
+	Time     time.Time `json:"time"`
+}
+
+// Summary returns the packet and byte totals
+func (a *Analysis) Summary() (Summary, error) {
+	if err := a.ready(Traffic); err != nil {
+		return Summary{}, err
+	}
+	stats := a.session.TrafficStats()
+	return Summary{
+		Packets: stats.TotalPackets,
+		Bytes:   stats.TotalBytes,
+		Start:   stats.StartTime,
+		End:     stats.EndTime,
+	}, nil
+}
+
+// Protocols returns the protocol hierarchy, rooted at the frame
+func (a *Analysis) Protocols() (*ProtocolNode, error) {
+	if err := a.ready(Protocols); err != nil {
+		return nil, err
+	}
+	var convert func(node *analysis.ProtocolNode) *ProtocolNode
+	convert = func(node *analysis.ProtocolNode) *ProtocolNode {
+		result := &ProtocolNode{Name: node.Name, Packets: node.Packets, Bytes: node.Bytes, Percent: node.Percent}
+		for _, child := range node.Children {
+			result.Children = append(result.Children, convert(child))
+		}
+		return result
+	}
+	return convert(a.session.Protocols().Tree()), nil
+}
+
+// Conversations returns the conversations of every type, by type and then
+// address
+func (a *Analysis) Conversations() ([]Conversation, error) {
+	if err := a.ready(Conversations); err != nil {
+		return nil, err
+	}
+	var result []Conversation
+	for _, kind := range analysis.ConversationTypes {
+		conversations, _ := a.session.Conversations().List(kind, "a", false, 0, 0)
+		for _, conv := range conversations {
+			c := Conversation{
+				Type:        conv.Type,
+				AddressA:    conv.AddressA(),
+				AddressB:    conv.AddressB(),
+				Protocol:    conv.Protocol,
+				Packets:     conv.PacketCount,
+				Bytes:       conv.TotalBytes,
+				PacketsAToB: conv.PacketsAB,
+				BytesAToB:   conv.BytesAB,
+				PacketsBToA: conv.PacketsBA,
+				BytesBToA:   conv.BytesBA,
+				Start:       conv.FirstSeen,
+				End:         conv.LastSeen,
+				State:       conv.State,
+			}
+			if conv.TLS != nil {
+				c.SNI = conv.TLS.SNI
+			}
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+// Endpoints returns the endpoints of every type, by type and then address
+func (a *Analysis) Endpoints() ([]Endpoint, error) {
+	if err := a.ready(Endpoints); err != nil {
+		return nil, err
+	}
+	var result []Endpoint
+	for _, kind := range analysis.EndpointTypes {
+		endpoints, _ := a.session.Endpoints().List(kind, "address", false, 0, 0)
+		for _, ep := range endpoints {
+			e := Endpoint{
+				Type:            ep.Type,
+				Address:         ep.Address,
+				MAC:             ep.MAC,
+				Name:            ep.Name,
+				PacketsSent:     ep.PacketsSent,
+				BytesSent:       ep.BytesSent,
+				PacketsReceived: ep.PacketsReceived,
+				BytesReceived:   ep.BytesReceived,
+				FirstSeen:       ep.FirstSeen,
+				LastSeen:        ep.LastSeen,
+				Protocols:       ep.ProtocolList(),
+			}
+			for _, port := range ep.PortList() {
+				e.ListeningPorts = append(e.ListeningPorts, int(port))
+			}
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// DNSQueries returns the DNS transactions in the order of their queries
+func (a *Analysis) DNSQueries() ([]DNSQuery, error) {
+	if err := a.ready(DNS); err != nil {
+		return nil, err
+	}
+	var result []DNSQuery
+	for _, tx := range a.session.DNS().GetTransactions() {
+		q := DNSQuery{
+			ID:              int(tx.ID),
+			Client:          tx.ClientIP,
+			ClientPort:      int(tx.ClientPort),
+			Resolver:        tx.ResolverIP,
+			ResolverPort:    int(tx.ResolverPort),
+			Transport:       tx.Transport,
+			Name:            tx.Name,
+			Type:            tx.Type,
+			QueryTime:       tx.QueryTime,
+			Answered:        tx.ResponsePacket != 0,
+			ResponseTime:    tx.ResponseTime,
+			Latency:         tx.Latency,
+			ResponseCode:    tx.ResponseCode,
+			Retransmissions: tx.Retransmissions,
+		}
+		for _, answer := range tx.Answers {
+			q.Answers = append(q.Answers, answer.Type+" "+answer.Data)
+		}
+		result = append(result, q)
+	}
+	return result, nil
+}
+
+// HTTPTransactions returns the HTTP transactions in request order
+func (a *Analysis) HTTPTransactions() ([]HTTPTransaction, error) {
+	if err := a.ready(HTTP); err != nil {
+		return nil, err
+	}
+	var result []HTTPTransaction
+	for _, tx := range a.session.HTTP().GetTransactions() {
+		result = append(result, HTTPTransaction{
+			Client:       tx.ClientIP,
+			Server:       tx.ServerIP,
+			ServerPort:   int(tx.ServerPort),
+			Method:       tx.Method,
+			Host:         tx.Host,
+			URI:          tx.URI,
+			UserAgent:    tx.UserAgent,
+			Status:       tx.Status,
+			ContentType:  tx.ContentType,
+			RequestSize:  tx.RequestSize,
+			ResponseSize: tx.ResponseSize,
+			RequestTime:  tx.RequestTime,
+			ResponseTime: tx.ResponseTime,
+			Latency:      tx.Latency,
+		})
+	}
+	return result, nil
+}
+
+// TLSHandshakes returns the TLS handshakes in stream order
+func (a *Analysis) TLSHandshakes() ([]TLSHandshake, error) {
+	if err := a.ready(TLS); err != nil {
+		return nil, err
+	}
+	var result []TLSHandshake
+	for _, hs := range a.session.TLS().GetSessions() {
+		result = append(result, TLSHandshake{
+			Client:      hs.ClientIP,
+			ClientPort:  int(hs.ClientPort),
+			Server:      hs.ServerIP,
+			ServerPort:  int(hs.ServerPort),
+			SNI:         hs.SNI,
+			Version:     analysis.TLSVersionName(hs.NegotiatedVersion),
+			CipherSuite: analysis.CipherSuiteName(hs.CipherSuite),
+			ALPN:        hs.NegotiatedALPN,
+			JA3:         hs.JA3Hash,
+			JA3S:        hs.JA3SHash,
+			JA4:         hs.JA4,
+			Decrypted:   hs.Decrypted,
+		})
+	}
+	return result, nil
+}
+
+// Hosts returns the hosts of the network map by address
+func (a *Analysis) Hosts() ([]Host, error) {
+	if err := a.ready(NetworkMap); err != nil {
+		return nil, err
+	}
+	var result []Host
+	for _, node := range a.session.NetworkMap().GetActiveNodes() {
+		host := Host{IP: node.IP, Role: node.Type, Hostname: node.Hostname}
+		for port := range node.Ports {
+			host.Ports = append(host.Ports, int(port))
+		}
+		sort.Ints(host.Ports)
+		for service := range node.Services {
+			host.Services = append(host.Services, service)
+		}
+		sort.Strings(host.Services)
+		result = append(result, host)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(result[i].IP).To16(), net.ParseIP(result[j].IP).To16()) < 0
+	})
+	return result, nil
+}
+
+// Connections returns the connections of the network map, busiest first
+func (a *Analysis) Connections() ([]Connection, error) {
+	if err := a.ready(NetworkMap); err != nil {
+		return nil, err
+	}
+	var result []Connection
+	for _, conn := range a.session.NetworkMap().GetActiveConnections() {
+		result = append(result, Connection{
+			Source:      conn.Source,
+			Destination: conn.Destination,
+			Protocol:    conn.Protocol,
+			Packets:     conn.Count,
+			LastSeen:    time.Unix(conn.LastSeen, 0),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Packets != result[j].Packets {
+			return result[i].Packets > result[j].Packets
+		}
+		return result[i].Source+result[i].Destination+result[i].Protocol < result[j].Source+result[j].Destination+result[j].Protocol
+	})
+	return result, nil
+}
+
+// Findings returns the expert findings in packet order, with those not
+// tied to a packet first
+func (a *Analysis) Findings() ([]Finding, error) {
+	if err := a.ready(Findings); err != nil {
+		return nil, err
+	}
+	var result []Finding
+	for _, item := range a.session.Expert().All() {
+		result = append(result, Finding{
+			Severity: item.Severity,
+			Group:    item.Group,
+			Protocol: item.Protocol,
+			Summary:  item.Summary,
+			Detail:   item.Detail,
+			Packet:   item.Packet,
+			Time:     item.Time,
+		})
+	}
+	return result, nil
+}
+
+// SeverityCounts returns the number of findings of each severity
+func (a *Analysis) SeverityCounts() (map[string]int, error) {
+	if err := a.ready(Findings); err != nil {
+		return nil, err
+	}
+	return a.session.Expert().SeverityCounts(), nil
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/shreethaar/heroPacket/api"
+	"github.com/shreethaar/heroPacket/capture"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats of the commands that print results
+const (
+	formatJSON  = "json"
+	formatTable = "table"
+	formatCSV   = "csv"
+)
+
+// tableFormats maps output formats to the formats of analysis.Table
+var tableFormats = map[string]string{
+	formatJSON:  analysis.TableJSON,
+	formatTable: analysis.TableText,
+	formatCSV:   analysis.TableCSV,
+}
+
+// parseFlags parses flags given before or after the positional arguments,
+// so that both "analyze -format json x.pcapng" and "analyze x.pcapng
+// --format json" work, and returns the positional arguments
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// flagStatus is the exit status after a flag error, which the flag set has
+// already reported
+func flagStatus(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitError
+}
+
+// fail reports an error of a command and returns the error status
+func fail(command string, err error) int {
+	fmt.Fprintf(os.Stderr, "heroPacket %s: %v\n", command, err)
+	return exitError
+}
+
+// captureArg parses the flags of a command that takes one capture file and
+// returns its path
+func captureArg(fs *flag.FlagSet, args []string) (string, error) {
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return "", err
+	}
+	if len(positional) != 1 {
+		fmt.Fprintf(fs.Output(), "%s needs exactly one capture file\n", fs.Name())
+		fs.Usage()
+		return "", errors.New("usage")
+	}
+	if _, err := os.Stat(positional[0]); err != nil {
+		fail(fs.Name(), err)
+		return "", err
+	}
+	return positional[0], nil
+}
+
+// analyzeFile analyses a capture, reporting the problems that did not stop
+// the analysis on stderr
+func analyzeFile(command, filePath string, opts capture.Options) (*analysis.Session, error) {
+	// Like the web interface, read a key log uploaded with the capture and
+	// keep its packet index next to it
+	opts.KeyLogFile = analysis.KeyLogPath(filePath)
+	opts.CacheDir = filepath.Dir(filePath)
+	result, err := capture.Open(filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range result.Warnings() {
+		fmt.Fprintf(os.Stderr, "heroPacket %s: warning: %v\n", command, warning)
+	}
+	return analysis.SessionOf(result), nil
+}
+
+// configFlag collects --config analyzer.option=value settings
+type configFlag map[string]map[string]string
+
+func (f configFlag) String() string {
+	return ""
+}
+
+func (f configFlag) Set(value string) error {
+	setting, v, found := strings.Cut(value, "=")
+	analyzer, option, dotted := strings.Cut(setting, ".")
+	if !found || !dotted || analyzer == "" || option == "" {
+		return errors.New("want analyzer.option=value")
+	}
+	if f[analyzer] == nil {
+		f[analyzer] = make(map[string]string)
+	}
+	f[analyzer][option] = v
+	return nil
+}
+
+// enabledTables keeps the tables of the analyzers that ran
+func enabledTables(session *analysis.Session, names []string) []string {
+	ran := make(map[string]bool)
+	for _, plugin := range analysis.Plugins() {
+		for _, table := range plugin.Tables {
+			ran[table.Name] = session.Enabled(plugin.Name)
+		}
+	}
+	var result []string
+	for _, name := range names {
+		if ran[name] {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// analysisSummary is the JSON output of analyze
+type analysisSummary struct {
+	File     string                     `json:"file"`
+	Packets  int                        `json:"packets"`
+	Bytes    int                        `json:"bytes"`
+	Start    *time.Time                 `json:"start"`
+	End      *time.Time                 `json:"end"`
+	Findings map[string]int             `json:"findings"`
+	Tables   map[string]json.RawMessage `json:"tables"`
+}
+
+// analyze prints the analysis tables of a capture and sets the exit status
+// from the severity of its findings
+func analyze(args []string) int {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	format := fs.String("format", formatTable, "output format: json, table or csv")
+	tables := fs.String("tables", "", "comma-separated tables to print, all but geoip by default; csv prints exactly one")
+	top := fs.Int("top", 10, "rows per table in the table format, 0 for all")
+	failOn := fs.String("fail-on", "", "exit with status 1 when there are findings of this severity or worse: "+strings.Join(analysis.ExpertSeverities, ", "))
+	analyzers := fs.String("analyzers", "", "comma-separated analyzers to run, all by default; see heroPacket analyzers")
+	config := configFlag{}
+	fs.Var(config, "config", "analyzer option as analyzer.option=value, repeatable")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: heroPacket analyze <file> [options]")
+		fs.PrintDefaults()
+	}
+	filePath, err := captureArg(fs, args)
+	if err != nil {
+		return flagStatus(err)
+	}
+
+	if _, known := tableFormats[*format]; !known {
+		return fail("analyze", fmt.Errorf("format must be %s, %s or %s", formatJSON, formatTable, formatCSV))
+	}
+	if *failOn != "" && analysis.ExpertSeverityRank(*failOn) == len(analysis.ExpertSeverities) {
+		return fail("analyze", fmt.Errorf("unknown severity %q", *failOn))
+	}
+	if *top < 0 {
+		return fail("analyze", errors.New("top must not be negative"))
+	}
+	var names []string
+	if *tables == "" {
+		for _, name := range analysis.TableNames {
+			if name != analysis.TableGeoIP {
+				names = append(names, name)
+			}
+		}
+	} else {
+		for _, name := range strings.Split(*tables, ",") {
+			name = strings.TrimSpace(name)
+			if _, known := analysis.TableColumns[name]; !known || name == analysis.TableGeoIP {
+				return fail("analyze", fmt.Errorf("unknown table %q; use the geoip command for locations", name))
+			}
+			names = append(names, name)
+		}
+	}
+	if *format == formatCSV && len(names) != 1 {
+		return fail("analyze", errors.New("csv prints one table; choose it with --tables"))
+	}
+
+	opts := capture.Options{Config: config}
+	if *analyzers != "" {
+		for _, name := range strings.Split(*analyzers, ",") {
+			opts.Analyzers = append(opts.Analyzers, strings.TrimSpace(name))
+		}
+	}
+	session, err := analyzeFile("analyze", filePath, opts)
+	if err != nil {
+		return fail("analyze", err)
+	}
+	if *failOn != "" && !session.Enabled(analysis.AnalyzerFindings) {
+		return fail("analyze", fmt.Errorf("--fail-on needs the %s analyzer", analysis.AnalyzerFindings))
+	}
+	if *tables == "" {
+		names = enabledTables(session, names)
+	}
+
+	var out error
+	switch *format {
+	case formatCSV:
+		out = writeTable(session, names[0], analysis.TableCSV, 0, os.Stdout)
+	case formatJSON:
+		out = writeAnalysisJSON(session, filePath, names, os.Stdout)
+	case formatTable:
+		out = writeAnalysisText(session, filePath, names, *top, os.Stdout)
+	}
+	if out != nil {
+		return fail("analyze", out)
+	}
+
+	if *failOn != "" {
+		counts := session.Expert().SeverityCounts()
+		found := 0
+		for _, severity := range analysis.ExpertSeverities {
+			if analysis.ExpertSeverityRank(severity) <= analysis.ExpertSeverityRank(*failOn) {
+				found += counts[severity]
+			}
+		}
+		if found > 0 {
+			fmt.Fprintf(os.Stderr, "heroPacket analyze: %d findings of severity %s or worse\n", found, *failOn)
+			return exitFindings
+		}
+	}
+	return exitOK
+}
+
+// writeTable writes one table of a session, only its first limit rows
+// unless limit is zero
+func writeTable(session *analysis.Session, name, format string, limit int, w io.Writer) error {
+	table, err := session.Table(name)
+	if err != nil {
+		return err
+	}
+	total := table.Page(0, limit)
+	if err := table.Write(format, w); err != nil {
+		return err
+	}
+	if left := total - len(table.Rows); left > 0 {
+		_, err = fmt.Fprintf(w, "... and %d more\n", left)
+	}
+	return err
+}
+
+func writeAnalysisJSON(session *analysis.Session, filePath string, names []string, w io.Writer) error {
+	stats := session.TrafficStats()
+	summary := analysisSummary{
+		File:     filePath,
+		Packets:  stats.TotalPackets,
+		Bytes:    stats.TotalBytes,
+		Findings: session.Expert().SeverityCounts(),
+		Tables:   make(map[string]json.RawMessage),
+	}
+	if !stats.StartTime.IsZero() {
+		start, end := stats.StartTime.UTC(), stats.EndTime.UTC()
+		summary.Start, summary.End = &start, &end
+	}
+	for _, name := range names {
+		table, err := session.Table(name)
+		if err != nil {
+			return err
+		}
+		var rows strings.Builder
+		if err := table.Write(analysis.TableJSON, &rows); err != nil {
+			return err
+		}
+		summary.Tables[name] = json.RawMessage(rows.String())
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(summary)
+}
+
+func writeAnalysisText(session *analysis.Session, filePath string, names []string, top int, w io.Writer) error {
+	stats := session.TrafficStats()
+	counts := session.Expert().SeverityCounts()
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "File\t%s\n", filePath)
+	fmt.Fprintf(writer, "Packets\t%d\n", stats.TotalPackets)
+	fmt.Fprintf(writer, "Bytes\t%d\n", stats.TotalBytes)
+	if !stats.StartTime.IsZero() {
+		fmt.Fprintf(writer, "Start\t%s\n", stats.StartTime.UTC().Format(time.RFC3339Nano))
+		fmt.Fprintf(writer, "End\t%s\n", stats.EndTime.UTC().Format(time.RFC3339Nano))
+		fmt.Fprintf(writer, "Duration\t%s\n", stats.EndTime.Sub(stats.StartTime))
+	}
+	var findings []string
+	for _, severity := range analysis.ExpertSeverities {
+		findings = append(findings, fmt.Sprintf("%d %s", counts[severity], severity))
+	}
+	fmt.Fprintf(writer, "Findings\t%s\n", strings.Join(findings, ", "))
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		fmt.Fprintf(w, "\n== %s ==\n", analysis.TableTitles[name])
+		if err := writeTable(session, name, analysis.TableText, top, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// properties prints the file properties of a capture
+func properties(args []string) int {
+	fs := flag.NewFlagSet("properties", flag.ContinueOnError)
+	format := fs.String("format", formatTable, "output format: json or table")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: heroPacket properties <file> [options]")
+		fs.PrintDefaults()
+	}
+	filePath, err := captureArg(fs, args)
+	if err != nil {
+		return flagStatus(err)
+	}
+	if *format != formatJSON && *format != formatTable {
+		return fail("properties", fmt.Errorf("format must be %s or %s", formatJSON, formatTable))
+	}
+
+	propertiesJSON, err := analysis.GetCaptureProperties(filePath)
+	if err != nil {
+		return fail("properties", err)
+	}
+	if *format == formatJSON {
+		fmt.Println(propertiesJSON)
+		return exitOK
+	}
+
+	var props analysis.CaptureProperties
+	if err := json.Unmarshal([]byte(propertiesJSON), &props); err != nil {
+		return fail("properties", err)
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(writer, "File\t%s\n", props.FileName)
+	fmt.Fprintf(writer, "Size\t%d\n", props.FileSize)
+	fmt.Fprintf(writer, "MD5\t%s\n", props.MD5Hash)
+	fmt.Fprintf(writer, "SHA-256\t%s\n", props.SHA256Hash)
+	fmt.Fprintf(writer, "First packet\t%s\n", props.FirstPacket.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(writer, "Last packet\t%s\n", props.LastPacket.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(writer, "Interfaces\t%s\n", strings.Join(props.Interfaces, ", "))
+	if err := writer.Flush(); err != nil {
+		return fail("properties", err)
+	}
+	return exitOK
+}
+
+// geoip prints the locations of the public addresses of a capture
+func geoip(args []string) int {
+	fs := flag.NewFlagSet("geoip", flag.ContinueOnError)
+	format := fs.String("format", formatTable, "output format: json, table or csv")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: heroPacket geoip <file> [options]")
+		fs.PrintDefaults()
+	}
+	filePath, err := captureArg(fs, args)
+	if err != nil {
+		return flagStatus(err)
+	}
+	tableFormat, known := tableFormats[*format]
+	if !known {
+		return fail("geoip", fmt.Errorf("format must be %s, %s or %s", formatJSON, formatTable, formatCSV))
+	}
+
+	// Analyse the capture for the names its addresses were seen with
+	session, err := analyzeFile("geoip", filePath, capture.Options{})
+	if err != nil {
+		return fail("geoip", err)
+	}
+	table, err := api.GeoIPTable(filePath, session.Names().Map())
+	if err != nil {
+		return fail("geoip", err)
+	}
+	if err := table.Write(tableFormat, os.Stdout); err != nil {
+		return fail("geoip", err)
+	}
+	return exitOK
+}
+
+// export writes the packets of a capture chosen by the flags as a new
+// capture
+func export(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var selection analysis.PacketSelection
+	fs.StringVar(&selection.Filter, "filter", "", "display filter, e.g. \"dns && ip.addr == 10.0.0.1\"")
+	fs.StringVar(&selection.BPF, "bpf", "", "capture filter, e.g. \"tcp port 443\"")
+	fs.StringVar(&selection.Conversation, "conversation", "", "conversation key, as in the conversation table links")
+	packets := fs.String("packets", "", "packet numbers and ranges, e.g. 1-10,15")
+	from := fs.String("from", "", "first packet time, RFC 3339")
+	to := fs.String("to", "", "last packet time, RFC 3339")
+	format := fs.String("format", analysis.FormatPcapNG, "capture format: pcap or pcapng")
+	output := fs.String("o", "-", "file to write, - for standard output")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: heroPacket export <file> [options]")
+		fs.PrintDefaults()
+	}
+	filePath, err := captureArg(fs, args)
+	if err != nil {
+		return flagStatus(err)
+	}
+
+	if *format != analysis.FormatPcap && *format != analysis.FormatPcapNG {
+		return fail("export", fmt.Errorf("format must be %s or %s", analysis.FormatPcap, analysis.FormatPcapNG))
+	}
+	if *packets != "" {
+		if selection.Packets, err = analysis.ParsePacketRanges(*packets); err != nil {
+			return fail("export", err)
+		}
+	}
+	if *from != "" {
+		if selection.From, err = time.Parse(time.RFC3339Nano, *from); err != nil {
+			return fail("export", fmt.Errorf("invalid start time %q", *from))
+		}
+	}
+	if *to != "" {
+		if selection.To, err = time.Parse(time.RFC3339Nano, *to); err != nil {
+			return fail("export", fmt.Errorf("invalid end time %q", *to))
+		}
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output == "-" {
+		if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			return fail("export", errors.New("refusing to write a capture to a terminal; use -o"))
+		}
+	} else {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fail("export", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	index, err := analysis.LoadPacketIndex(filePath, analysis.PacketIndexPath(filePath))
+	if err != nil {
+		return fail("export", err)
+	}
+	written, err := analysis.ExportPackets(index, selection, *format, w)
+	if err != nil {
+		if *output != "-" {
+			os.Remove(*output)
+		}
+		return fail("export", err)
+	}
+	fmt.Fprintf(os.Stderr, "heroPacket export: wrote %d packets (%s)\n", written, selection)
+	return exitOK
+}
+
+// analyzerInfo is the JSON output of analyzers
+type analyzerInfo struct {
+	Name        string                     `json:"name"`
+	Title       string                     `json:"title"`
+	Version     string                     `json:"version"`
+	Description string                     `json:"description"`
+	Requires    []string                   `json:"requires"`
+	Options     []analysis.ConfigOption    `json:"options"`
+	Tables      []analysis.TableDefinition `json:"tables"`
+}
+
+// listAnalyzers prints the registered analyzers with their options and
+// tables
+func listAnalyzers(args []string) int {
+	fs := flag.NewFlagSet("analyzers", flag.ContinueOnError)
+	format := fs.String("format", formatTable, "output format: json or table")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: heroPacket analyzers [options]")
+		fs.PrintDefaults()
+	}
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagStatus(err)
+	}
+	if len(positional) > 0 {
+		fs.Usage()
+		return exitError
+	}
+	if *format != formatJSON && *format != formatTable {
+		return fail("analyzers", fmt.Errorf("format must be %s or %s", formatJSON, formatTable))
+	}
+
+	plugins := analysis.Plugins()
+	if *format == formatJSON {
+		list := make([]analyzerInfo, 0, len(plugins))
+		for _, plugin := range plugins {
+			list = append(list, analyzerInfo{
+				Name:        plugin.Name,
+				Title:       plugin.Title,
+				Version:     plugin.Version,
+				Description: plugin.Description,
+				Requires:    append([]string{}, plugin.Requires...),
+				Options:     append([]analysis.ConfigOption{}, plugin.Config...),
+				Tables:      append([]analysis.TableDefinition{}, plugin.Tables...),
+			})
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(list); err != nil {
+			return fail("analyzers", err)
+		}
+		return exitOK
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tREQUIRES\tTABLES\tOPTIONS\tDESCRIPTION")
+	for _, plugin := range plugins {
+		var tables, options []string
+		for _, table := range plugin.Tables {
+			tables = append(tables, table.Name)
+		}
+		for _, option := range plugin.Config {
+			options = append(options, fmt.Sprintf("%s=%s (%s)", option.Name, option.Default, option.Type))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", plugin.Name, plugin.Version,
+			dash(strings.Join(plugin.Requires, ",")), dash(strings.Join(tables, ",")), dash(strings.Join(options, ", ")), plugin.Description)
+	}
+	if err := w.Flush(); err != nil {
+		return fail("analyzers", err)
+	}
+	return exitOK
+}
+
+// dash stands in for an empty column
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -1,13 +1,75 @@
 package main
 
 import (
-	"heroPacket/handler"
+	"flag"
+	"fmt"
+	"github.com/shreethaar/heroPacket/handler"
 	"log"
+	"os"
+	"strings"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
+// Exit statuses, so scripts can gate on the content of a capture
+const (
+	exitOK       = 0
+	exitFindings = 1 // analyze found items at or above --fail-on
+	exitError    = 2
+)
+
+const usage = `Usage: heroPacket [command] [options]
+
+Commands:
+  serve               Start the web interface (the default)
+  analyze <file>      Print the analysis of a capture
+  properties <file>   Print the file properties of a capture
+  geoip <file>        Print the locations of the public addresses
+  export <file>       Write the selected packets as pcap or pcapng
+  analyzers           List the analyzers with their options and tables
+
+Run heroPacket <command> -h for the options of a command.
+
+The exit status is 0 on success, 1 when analyze finds items at or above
+its --fail-on severity and 2 on errors.
+`
+
 func main() {
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	commands := map[string]func([]string) int{
+		"serve":      serve,
+		"analyze":    analyze,
+		"properties": properties,
+		"geoip":      geoip,
+		"export":     export,
+		"analyzers":  listAnalyzers,
+	}
+	run, known := commands[command]
+	if !known {
+		if command != "help" {
+			fmt.Fprintf(os.Stderr, "heroPacket: unknown command %q\n\n", command)
+		}
+		fmt.Fprint(os.Stderr, usage)
+		if command == "help" {
+			os.Exit(exitOK)
+		}
+		os.Exit(exitError)
+	}
+	os.Exit(run(args))
+}
+
+// serve runs the web interface until it fails
+func serve(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	if _, err := parseFlags(fs, args); err != nil {
+		return flagStatus(err)
+	}
+
 	app := echo.New()
 	
 	// Middleware
@@ -19,7 +81,7 @@ func main() {
 		CookieName:   "csrf",
 		CookieMaxAge: 86400,
 		Skipper: func(c echo.Context) bool {
-			return c.Path() == "/static/*" || c.Path() == "/upload" || c.Request().Method == "DELETE"
+			return c.Path() == "/static/*" || c.Path() == "/upload" || c.Request().Method == "DELETE" || strings.HasPrefix(c.Path(), "/api/v1/")
 		},
 	}))
 
@@ -36,12 +98,40 @@ func main() {
     app.GET("/properties", userHandler.HandlePropertiesIndex)
     app.GET("/properties/:filename", userHandler.HandleProperties)
     app.GET("/api/geoip/:filename", userHandler.HandleGeoIP)
+    app.GET("/stream/:filename/:index", userHandler.HandleStream)
+    app.GET("/stream/:filename/:index/download/:direction", userHandler.HandleStreamDownload)
+    app.GET("/certificates/:filename", userHandler.HandleCertificates)
+    app.GET("/certificates/:filename/:fingerprint/download", userHandler.HandleCertificateDownload)
+    app.GET("/resolved/:filename", userHandler.HandleResolved)
+    app.GET("/protocols/:filename", userHandler.HandleProtocolHierarchy)
+    app.GET("/conversations/:filename", userHandler.HandleConversations)
+    app.GET("/endpoints/:filename", userHandler.HandleEndpoints)
+    app.GET("/host/:filename/:ip", userHandler.HandleHost)
+    app.GET("/host/:filename/:ip/traffic.svg", userHandler.HandleHostTraffic)
+    app.GET("/tcp/:filename", userHandler.HandleTCPHealth)
+    app.GET("/tcp/:filename/events", userHandler.HandleTCPEvents)
+    app.GET("/expert/:filename", userHandler.HandleExpertInfo)
+    app.GET("/expert/:filename/items", userHandler.HandleExpertItems)
+    app.GET("/packets/:filename", userHandler.HandlePackets)
+    app.GET("/packets/:filename/:number", userHandler.HandlePacket)
+    app.GET("/export/:filename", userHandler.HandleExport)
+    app.POST("/export/:filename/save", userHandler.HandleExportSave)
+    app.GET("/sanitize/:filename/report", userHandler.HandleSanitizeReport, handler.ReportAuth())
+    app.GET("/report/:filename", userHandler.HandleReportOptions)
+    app.GET("/report/:filename/download", userHandler.HandleReport)
+    app.GET("/tables/:filename", userHandler.HandleTables)
+    app.GET("/tables/:filename/:table", userHandler.HandleTable)
+    app.GET("/analyzers/:filename", userHandler.HandleAnalyzers)
+    app.POST("/analyzers/:filename", userHandler.HandleAnalyzersSave)
+    userHandler.RegisterAPI(app.Group("/api/v1"))
 	//app.GET("/docs", userHandler.HandleDocs)                  
 	//app.GET("/protocol-chart/:sessionID", userHandler.ProtocolChart)
 	//app.GET("/traffic-timeline/:sessionID", userHandler.TrafficTimeline)
 
 	// Start server
-	if err := app.Start(":8080"); err != nil {
-		log.Fatal(err)
+	if err := app.Start(*addr); err != nil {
+		log.Println(err)
+		return exitError
 	}
+	return exitOK
 }
@@ -1,4 +1,4 @@
-module heroPacket
+module github.com/shreethaar/heroPacket
 
 go 1.23.0
 
@@ -9,6 +9,7 @@ require (
 	github.com/google/gopacket v1.1.19
 	github.com/labstack/echo/v4 v4.11.4
 	github.com/wcharczuk/go-chart v2.0.1+incompatible
+	golang.org/x/crypto v0.31.0
 )
 
 require (
@@ -20,7 +21,6 @@ require (
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasttemplate v1.2.2 // indirect
-	golang.org/x/crypto v0.31.0 // indirect
 	golang.org/x/image v0.25.0 // indirect
 	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
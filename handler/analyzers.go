@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"github.com/shreethaar/heroPacket/capture"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"github.com/shreethaar/heroPacket/view/analyzers"
+	"github.com/shreethaar/heroPacket/view/home"
+	"path/filepath"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleAnalyzers lists the registered analyzers with their settings for a
+// capture and previews the tables of those that ran
+func (h *UserHandler) HandleAnalyzers(c echo.Context) error {
+	filename := filepath.Base(c.Param("filename"))
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+	return render(c, analyzers.Content(analyzerData(c, filename, session, "")))
+}
+
+// HandleAnalyzersSave analyses a capture again with the analyzers and
+// options chosen on the analyzers page
+func (h *UserHandler) HandleAnalyzersSave(c echo.Context) error {
+	filename := filepath.Base(c.Param("filename"))
+	params, err := c.FormParams()
+	if err != nil {
+		return render(c, home.ErrorTemplate("Invalid form"))
+	}
+
+	opts := capture.Options{Analyzers: params["analyzer"], Config: make(map[string]map[string]string)}
+	for _, plugin := range analysis.Plugins() {
+		for _, option := range plugin.Config {
+			field := plugin.Name + "." + option.Name
+			var value string
+			if option.Type == analysis.ColumnBoolean {
+				// Unticked checkboxes are not sent
+				value = strconv.FormatBool(params.Get(field) != "")
+			} else if value = params.Get(field); value == "" {
+				continue
+			}
+			if opts.Config[plugin.Name] == nil {
+				opts.Config[plugin.Name] = make(map[string]string)
+			}
+			opts.Config[plugin.Name][option.Name] = value
+		}
+	}
+
+	message := ""
+	if len(opts.Analyzers) == 0 {
+		message = "Choose at least one analyzer"
+	} else if err := h.setAnalysisOptions(filename, opts); err != nil {
+		message = err.Error()
+	}
+
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+	return render(c, analyzers.Content(analyzerData(c, filename, session, message)))
+}
+
+func analyzerData(c echo.Context, filename string, session *analysis.Session, message string) analyzers.ViewData {
+	data := analyzers.ViewData{Filename: filename, Error: message}
+	if token, ok := c.Get("csrf").(string); ok {
+		data.CSRF = token
+	}
+	for _, plugin := range analysis.Plugins() {
+		a := analyzers.Analyzer{Plugin: plugin, Enabled: session.Enabled(plugin.Name), Config: session.Config(plugin.Name)}
+		if a.Enabled {
+			for _, definition := range plugin.Tables {
+				table, err := session.Table(definition.Name)
+				if err != nil {
+					continue
+				}
+				total := table.Page(0, analyzers.PreviewRows)
+				a.Tables = append(a.Tables, analyzers.TablePreview{Title: definition.Title, Table: table, Total: total})
+			}
+		}
+		data.Analyzers = append(data.Analyzers, a)
+	}
+	return data
+}
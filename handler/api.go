@@ -0,0 +1,631 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/shreethaar/heroPacket/capture"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// APIVersion is the version of the JSON API, served under /api/v1. Fields
+// and endpoints are only ever added within a version.
+const APIVersion = "1.1.0"
+
+// Pagination of list endpoints
+const (
+	apiDefaultLimit = 100
+	apiMaxLimit     = 1000
+)
+
+// apiRoute is one endpoint of the JSON API. The same list registers the
+// routes and generates the OpenAPI document, so the two cannot drift.
+type apiRoute struct {
+	Method  string
+	Path    string // Relative to /api/v1, in Echo syntax
+	Summary string
+	Status  int         // Status of a successful response, 200 if zero
+	Table   string      // Analysis table listed by the endpoint
+	Result  interface{} // Otherwise a value of the type in data
+	List    bool        // Result is one item of a paginated list
+	Upload  bool        // Takes a multipart capture upload
+	Body    interface{} // Takes an optional JSON body of this type, sent as application/json
+	Handle  func(h *UserHandler, c echo.Context) error
+}
+
+var apiRoutes = []apiRoute{
+	{Method: http.MethodGet, Path: "/analyzers", Summary: "List the registered analyzers", Result: []apiAnalyzer{}, Handle: (*UserHandler).apiAnalyzers},
+	{Method: http.MethodGet, Path: "/captures", Summary: "List uploaded captures", Result: apiCapture{}, List: true, Handle: (*UserHandler).apiCaptures},
+	{Method: http.MethodPost, Path: "/captures", Summary: "Upload a capture and start analysing it", Status: http.StatusCreated, Result: apiCapture{}, Upload: true, Handle: (*UserHandler).apiUpload},
+	{Method: http.MethodGet, Path: "/captures/:name", Summary: "Get a capture with its properties", Result: apiCaptureDetail{}, Handle: (*UserHandler).apiCapture},
+	{Method: http.MethodDelete, Path: "/captures/:name", Summary: "Delete a capture", Status: http.StatusNoContent, Handle: (*UserHandler).apiDelete},
+	{Method: http.MethodGet, Path: "/captures/:name/analysis", Summary: "Get the state of the analysis job", Result: analysisJob{}, Handle: (*UserHandler).apiAnalysis},
+	{Method: http.MethodPost, Path: "/captures/:name/analysis", Summary: "Start analysing a capture, again if analyzers are chosen", Status: http.StatusAccepted, Result: analysisJob{}, Body: apiAnalysisRequest{}, Handle: (*UserHandler).apiAnalyse},
+	{Method: http.MethodGet, Path: "/captures/:name/analyzers", Summary: "List the analyzers with their state in the analysis", Result: []apiAnalyzer{}, Handle: (*UserHandler).apiCaptureAnalyzers},
+	{Method: http.MethodGet, Path: "/captures/:name/stats", Summary: "Get traffic statistics", Result: apiStats{}, Handle: (*UserHandler).apiStats},
+	{Method: http.MethodGet, Path: "/captures/:name/protocols", Summary: "Get the protocol hierarchy", Result: capture.ProtocolNode{}, Handle: (*UserHandler).apiProtocols},
+	{Method: http.MethodGet, Path: "/captures/:name/conversations", Summary: "List conversations", Table: analysis.TableConversations},
+	{Method: http.MethodGet, Path: "/captures/:name/endpoints", Summary: "List endpoints", Table: analysis.TableEndpoints},
+	{Method: http.MethodGet, Path: "/captures/:name/dns", Summary: "Get the DNS summary", Result: apiDNS{}, Handle: (*UserHandler).apiDNS},
+	{Method: http.MethodGet, Path: "/captures/:name/dns/queries", Summary: "List DNS transactions", Table: analysis.TableDNS},
+	{Method: http.MethodGet, Path: "/captures/:name/http", Summary: "Get the HTTP summary", Result: apiHTTP{}, Handle: (*UserHandler).apiHTTP},
+	{Method: http.MethodGet, Path: "/captures/:name/http/transactions", Summary: "List HTTP transactions", Table: analysis.TableHTTP},
+	{Method: http.MethodGet, Path: "/captures/:name/tls", Summary: "Get the TLS summary", Result: apiTLS{}, Handle: (*UserHandler).apiTLS},
+	{Method: http.MethodGet, Path: "/captures/:name/tls/handshakes", Summary: "List TLS handshakes", Table: analysis.TableTLS},
+	{Method: http.MethodGet, Path: "/captures/:name/network/nodes", Summary: "List network map nodes", Table: analysis.TableNodes},
+	{Method: http.MethodGet, Path: "/captures/:name/network/connections", Summary: "List network map connections", Table: analysis.TableConnections},
+	{Method: http.MethodGet, Path: "/captures/:name/findings", Summary: "List expert findings", Table: analysis.TableFindings},
+}
+
+type apiResponse struct {
+	Data     interface{} `json:"data"`
+	Meta     *apiMeta    `json:"meta,omitempty"`
+	Warnings []string    `json:"warnings,omitempty"`
+}
+
+type apiMeta struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	Total  int `json:"total"`
+}
+
+type apiErrorResponse struct {
+	Error apiError `json:"error"`
+}
+
+type apiError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type apiCapture struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Uploaded time.Time `json:"uploaded"`
+	Analysis string    `json:"analysis"`
+}
+
+type apiCaptureDetail struct {
+	apiCapture
+	Job        analysisJob                 `json:"job"`
+	Properties *analysis.CaptureProperties `json:"properties"`
+}
+
+// apiAnalysisRequest chooses the analyzers of an analysis and their
+// options. Leaving both out keeps those chosen before.
+type apiAnalysisRequest struct {
+	Analyzers []string                     `json:"analyzers,omitempty"`
+	Config    map[string]map[string]string `json:"config,omitempty"`
+}
+
+type apiAnalyzer struct {
+	Name        string                  `json:"name"`
+	Title       string                  `json:"title"`
+	Version     string                  `json:"version"`
+	Description string                  `json:"description"`
+	Requires    []string                `json:"requires"`
+	Options     []analysis.ConfigOption `json:"options"`
+	Tables      []apiAnalyzerTable      `json:"tables"`
+
+	// The state in the analysis of a capture
+	Enabled *bool                  `json:"enabled,omitempty"`
+	Config  map[string]interface{} `json:"config,omitempty"`
+}
+
+type apiAnalyzerTable struct {
+	Name    string                 `json:"name"`
+	Title   string                 `json:"title"`
+	Columns []analysis.TableColumn `json:"columns"`
+	Path    string                 `json:"path"` // Endpoint listing the rows, relative to /api/v1
+}
+
+type apiStats struct {
+	Packets     int            `json:"packets"`
+	Bytes       int            `json:"bytes"`
+	Start       *time.Time     `json:"start"`
+	End         *time.Time     `json:"end"`
+	DurationMs  float64        `json:"duration_ms"`
+	SizeBuckets map[string]int `json:"size_buckets"`
+}
+
+type apiCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type apiDNS struct {
+	Messages      int           `json:"messages"`
+	Queries       int           `json:"queries"`
+	Responses     int           `json:"responses"`
+	Truncated     int           `json:"truncated"`
+	TCP           int           `json:"tcp"`
+	EDNS          int           `json:"edns"`
+	Unanswered    int           `json:"unanswered"`
+	Retransmitted int           `json:"retransmitted"`
+	Errors        int           `json:"errors"`
+	TopQueries    []apiCount    `json:"top_queries"`
+	Types         []apiCount    `json:"types"`
+	ResponseCodes []apiCount    `json:"response_codes"`
+	Resolvers     []apiResolver `json:"resolvers"`
+}
+
+type apiResolver struct {
+	IP          string  `json:"ip"`
+	Queries     int     `json:"queries"`
+	Answered    int     `json:"answered"`
+	Failures    int     `json:"failures"`
+	FailureRate float64 `json:"failure_rate"`
+	P50Ms       float64 `json:"p50_ms"`
+	P95Ms       float64 `json:"p95_ms"`
+	P99Ms       float64 `json:"p99_ms"`
+}
+
+type apiHTTP struct {
+	Transactions    int        `json:"transactions"`
+	ClientErrorRate float64    `json:"client_error_rate"`
+	ServerErrorRate float64    `json:"server_error_rate"`
+	TopHosts        []apiCount `json:"top_hosts"`
+	TopURIs         []apiCount `json:"top_uris"`
+	TopUserAgents   []apiCount `json:"top_user_agents"`
+}
+
+type apiTLS struct {
+	Handshakes int        `json:"handshakes"`
+	Decrypted  int        `json:"decrypted"`
+	Versions   []apiCount `json:"versions"`
+	TopSNIs    []apiCount `json:"top_snis"`
+	TopJA3     []apiCount `json:"top_ja3"`
+	TopJA4     []apiCount `json:"top_ja4"`
+}
+
+// apiTop is how many entries the summaries rank
+const apiTop = 20
+
+// apiTablePaths maps tables to the endpoints listing them, as registered
+var apiTablePaths = make(map[string]string)
+
+// RegisterAPI adds the JSON API to a group, which main mounts at /api/v1
+func (h *UserHandler) RegisterAPI(g *echo.Group) {
+	for _, route := range apiRouteList() {
+		route := route
+		handle := route.Handle
+		if route.Table != "" {
+			handle = func(h *UserHandler, c echo.Context) error { return h.apiTable(c, route.Table) }
+			apiTablePaths[route.Table] = strings.Replace(route.Path, ":name", "{name}", 1)
+		}
+		if route.Body != nil {
+			// The API is exempt from CSRF tokens. Browsers send forms to
+			// other sites without asking, but not JSON, so requiring it
+			// keeps pages elsewhere from calling these routes.
+			next := handle
+			handle = func(h *UserHandler, c echo.Context) error {
+				mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+				if mediaType != echo.MIMEApplicationJSON {
+					return apiFail(c, http.StatusUnsupportedMediaType, "Content-Type must be "+echo.MIMEApplicationJSON)
+				}
+				return next(h, c)
+			}
+		}
+		g.Add(route.Method, route.Path, func(c echo.Context) error { return handle(h, c) })
+	}
+	g.GET("/openapi.json", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, openAPIDocument())
+	})
+}
+
+// apiRouteList returns apiRoutes and a route for every table of a
+// registered analyzer that has none, so analyzers need no routes of their own
+func apiRouteList() []apiRoute {
+	routes := append([]apiRoute(nil), apiRoutes...)
+	served := make(map[string]bool)
+	for _, route := range apiRoutes {
+		served[route.Table] = true
+	}
+	for _, plugin := range analysis.Plugins() {
+		for _, table := range plugin.Tables {
+			if !served[table.Name] {
+				routes = append(routes, apiRoute{
+					Method:  http.MethodGet,
+					Path:    "/captures/:name/tables/" + table.Name,
+					Summary: "List the " + table.Title + " table",
+					Table:   table.Name,
+				})
+			}
+		}
+	}
+	return routes
+}
+
+func apiFail(c echo.Context, status int, message string) error {
+	code := strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	return c.JSON(status, apiErrorResponse{Error: apiError{Status: status, Code: code, Message: message}})
+}
+
+// apiPage reads the offset and limit parameters
+func apiPage(c echo.Context) (offset, limit int, err error) {
+	limit = apiDefaultLimit
+	if value := c.QueryParam("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > apiMaxLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", apiMaxLimit)
+		}
+	}
+	return offset, limit, nil
+}
+
+// apiCaptureName returns the capture named in the path, answering 404 when
+// it has not been uploaded or names a key log or packet index kept beside
+// one
+func apiCaptureName(c echo.Context) (string, error) {
+	name := filepath.Base(c.Param("name"))
+	if !isCaptureFile(name) {
+		return "", apiFail(c, http.StatusNotFound, fmt.Sprintf("capture %q not found", name))
+	}
+	if _, err := os.Stat(filepath.Join("uploads", name)); err != nil {
+		return "", apiFail(c, http.StatusNotFound, fmt.Sprintf("capture %q not found", name))
+	}
+	return name, nil
+}
+
+// apiResults returns the analysis of the capture named in the path. Until
+// it is ready the analysis is nil and the response has been sent: 202 with
+// the job while the analysis runs, starting it if needed, or 422 when it
+// failed.
+func (h *UserHandler) apiResults(c echo.Context) (*capture.Analysis, error) {
+	name, err := apiCaptureName(c)
+	if name == "" {
+		return nil, err
+	}
+	job := h.analysisStatus(name)
+	switch job.State {
+	case jobDone:
+		result, err := h.loadAnalysis(name)
+		if err != nil {
+			return nil, apiFail(c, http.StatusUnprocessableEntity, err.Error())
+		}
+		return result, nil
+	case jobFailed:
+		return nil, apiFail(c, http.StatusUnprocessableEntity, "analysis failed: "+job.Error)
+	}
+	return nil, c.JSON(http.StatusAccepted, apiResponse{Data: h.startAnalysis(name)})
+}
+
+func (h *UserHandler) captureInfo(name string, size int64, uploaded time.Time) apiCapture {
+	return apiCapture{Name: name, Size: size, Uploaded: uploaded, Analysis: h.analysisStatus(name).State}
+}
+
+func (h *UserHandler) apiCaptures(c echo.Context) error {
+	offset, limit, err := apiPage(c)
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, err.Error())
+	}
+	files := h.getUploadedFiles()
+	captures := []apiCapture{}
+	for i := offset; i < len(files) && i < offset+limit; i++ {
+		captures = append(captures, h.captureInfo(files[i].Name, files[i].Size, files[i].UploadTime))
+	}
+	return c.JSON(http.StatusOK, apiResponse{
+		Data: captures,
+		Meta: &apiMeta{Offset: offset, Limit: limit, Total: len(files)},
+	})
+}
+
+func (h *UserHandler) apiUpload(c echo.Context) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, "No file uploaded")
+	}
+	dstPath, err := h.saveCapture(file)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if failure, ok := err.(*captureError); ok {
+			status = failure.status
+		}
+		return apiFail(c, status, err.Error())
+	}
+
+	var warnings []string
+	if keyFile, err := c.FormFile("keylog"); err == nil {
+		if _, err := saveKeyLog(keyFile, analysis.KeyLogPath(dstPath)); err != nil {
+			warnings = append(warnings, "key log rejected: "+err.Error())
+		}
+	}
+
+	name := filepath.Base(dstPath)
+	h.startAnalysis(name)
+	info, err := os.Stat(dstPath)
+	if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err.Error())
+	}
+	c.Response().Header().Set(echo.HeaderLocation, "/api/v1/captures/"+name)
+	return c.JSON(http.StatusCreated, apiResponse{Data: h.captureInfo(name, info.Size(), info.ModTime()), Warnings: warnings})
+}
+
+func (h *UserHandler) apiCapture(c echo.Context) error {
+	name, err := apiCaptureName(c)
+	if name == "" {
+		return err
+	}
+	filePath := filepath.Join("uploads", name)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: apiCaptureDetail{
+		apiCapture: h.captureInfo(name, info.Size(), info.ModTime()),
+		Job:        h.analysisStatus(name),
+		Properties: captureProperties(filePath),
+	}})
+}
+
+func (h *UserHandler) apiDelete(c echo.Context) error {
+	err := h.deleteCapture(c.Param("name"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if failure, ok := err.(*captureError); ok {
+			status = failure.status
+		}
+		return apiFail(c, status, err.Error())
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *UserHandler) apiAnalysis(c echo.Context) error {
+	name, err := apiCaptureName(c)
+	if name == "" {
+		return err
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: h.analysisStatus(name)})
+}
+
+func (h *UserHandler) apiAnalyse(c echo.Context) error {
+	name, err := apiCaptureName(c)
+	if name == "" {
+		return err
+	}
+	var request apiAnalysisRequest
+	if c.Request().ContentLength != 0 {
+		if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+			return apiFail(c, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		}
+	}
+	if request.Analyzers != nil || request.Config != nil {
+		opts := capture.Options{Analyzers: request.Analyzers, Config: request.Config}
+		if err := h.setAnalysisOptions(name, opts); err != nil {
+			return apiFail(c, http.StatusBadRequest, err.Error())
+		}
+	}
+	return c.JSON(http.StatusAccepted, apiResponse{Data: h.startAnalysis(name)})
+}
+
+func (h *UserHandler) apiAnalyzers(c echo.Context) error {
+	return c.JSON(http.StatusOK, apiResponse{Data: apiAnalyzerList(nil)})
+}
+
+func (h *UserHandler) apiCaptureAnalyzers(c echo.Context) error {
+	results, err := h.apiResults(c)
+	if results == nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: apiAnalyzerList(analysis.SessionOf(results))})
+}
+
+// apiAnalyzerList describes the registered analyzers, with their state in
+// a session unless it is nil
+func apiAnalyzerList(session *analysis.Session) []apiAnalyzer {
+	var list []apiAnalyzer
+	for _, plugin := range analysis.Plugins() {
+		a := apiAnalyzer{
+			Name:        plugin.Name,
+			Title:       plugin.Title,
+			Version:     plugin.Version,
+			Description: plugin.Description,
+			Requires:    append([]string{}, plugin.Requires...),
+			Options:     append([]analysis.ConfigOption{}, plugin.Config...),
+			Tables:      []apiAnalyzerTable{},
+		}
+		for _, table := range plugin.Tables {
+			a.Tables = append(a.Tables, apiAnalyzerTable{Name: table.Name, Title: table.Title, Columns: table.Columns, Path: apiTablePaths[table.Name]})
+		}
+		if session != nil {
+			enabled := session.Enabled(plugin.Name)
+			a.Enabled = &enabled
+			a.Config = session.Config(plugin.Name)
+		}
+		list = append(list, a)
+	}
+	return list
+}
+
+func (h *UserHandler) apiStats(c echo.Context) error {
+	results, err := h.apiResults(c)
+	if results == nil {
+		return err
+	}
+	summary, err := results.Summary()
+	if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err.Error())
+	}
+	stats := apiStats{
+		Packets:     summary.Packets,
+		Bytes:       summary.Bytes,
+		SizeBuckets: analysis.SessionOf(results).TrafficStats().SizeBuckets,
+	}
+	if !summary.Start.IsZero() {
+		start, end := summary.Start.UTC(), summary.End.UTC()
+		stats.Start, stats.End = &start, &end
+		stats.DurationMs = float64(end.Sub(start)) / float64(time.Millisecond)
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: stats})
+}
+
+func (h *UserHandler) apiProtocols(c echo.Context) error {
+	results, err := h.apiResults(c)
+	if results == nil {
+		return err
+	}
+	tree, err := results.Protocols()
+	if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: tree})
+}
+
+func (h *UserHandler) apiDNS(c echo.Context) error {
+	results, err := h.apiResults(c)
+	if results == nil {
+		return err
+	}
+	session := analysis.SessionOf(results)
+	dns := session.DNS()
+	stats := dns.GetStats()
+	result := apiDNS{
+		Messages:      stats.Messages,
+		Queries:       stats.Queries,
+		Responses:     stats.Responses,
+		Truncated:     stats.Truncated,
+		TCP:           stats.TCP,
+		EDNS:          stats.EDNS,
+		Unanswered:    stats.Unanswered,
+		Retransmitted: stats.Retransmitted,
+		Errors:        stats.Errors,
+		TopQueries:    []apiCount{},
+		Types:         []apiCount{},
+		ResponseCodes: []apiCount{},
+		Resolvers:     []apiResolver{},
+	}
+	for _, query := range dns.TopQueries(apiTop) {
+		result.TopQueries = append(result.TopQueries, apiCount{query.Domain, query.Count})
+	}
+	for _, count := range dns.TypeDistribution() {
+		result.Types = append(result.Types, apiCount{count.Name, count.Count})
+	}
+	for _, count := range dns.ResponseCodeDistribution() {
+		result.ResponseCodes = append(result.ResponseCodes, apiCount{count.Name, count.Count})
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	for _, resolver := range dns.ResolverStats() {
+		result.Resolvers = append(result.Resolvers, apiResolver{
+			IP:          resolver.IP,
+			Queries:     resolver.Queries,
+			Answered:    resolver.Answered,
+			Failures:    resolver.Failures,
+			FailureRate: resolver.FailureRate,
+			P50Ms:       ms(resolver.P50),
+			P95Ms:       ms(resolver.P95),
+			P99Ms:       ms(resolver.P99),
+		})
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: result})
+}
+
+func (h *UserHandler) apiHTTP(c echo.Context) error {
+	results, err := h.apiResults(c)
+	if results == nil {
+		return err
+	}
+	session := analysis.SessionOf(results)
+	analyzer := session.HTTP()
+	counts := func(in []analysis.HTTPCount) []apiCount {
+		out := []apiCount{}
+		for _, count := range in {
+			out = append(out, apiCount{count.Name, count.Count})
+		}
+		return out
+	}
+	result := apiHTTP{
+		Transactions:  len(analyzer.GetTransactions()),
+		TopHosts:      counts(analyzer.TopHosts(apiTop)),
+		TopURIs:       counts(analyzer.TopURIs(apiTop)),
+		TopUserAgents: counts(analyzer.TopUserAgents(apiTop)),
+	}
+	result.ClientErrorRate, result.ServerErrorRate = analyzer.ErrorRates()
+	return c.JSON(http.StatusOK, apiResponse{Data: result})
+}
+
+func (h *UserHandler) apiTLS(c echo.Context) error {
+	results, err := h.apiResults(c)
+	if results == nil {
+		return err
+	}
+	session := analysis.SessionOf(results)
+	analyzer := session.TLS()
+	counts := func(in []analysis.TLSCount) []apiCount {
+		out := []apiCount{}
+		for _, count := range in {
+			out = append(out, apiCount{count.Name, count.Count})
+		}
+		return out
+	}
+	sessions := analyzer.GetSessions()
+	result := apiTLS{
+		Handshakes: len(sessions),
+		Versions:   counts(analyzer.VersionDistribution()),
+		TopSNIs:    counts(analyzer.TopSNIs(apiTop)),
+		TopJA3:     counts(analyzer.TopJA3(apiTop)),
+		TopJA4:     counts(analyzer.TopJA4(apiTop)),
+	}
+	for _, hs := range sessions {
+		if hs.Decrypted {
+			result.Decrypted++
+		}
+	}
+	return c.JSON(http.StatusOK, apiResponse{Data: result})
+}
+
+// apiTable lists the rows of an analysis table as objects. Any query
+// parameter named after a column keeps the rows with that value.
+func (h *UserHandler) apiTable(c echo.Context, name string) error {
+	offset, limit, err := apiPage(c)
+	if err != nil {
+		return apiFail(c, http.StatusBadRequest, err.Error())
+	}
+	results, err := h.apiResults(c)
+	if results == nil {
+		return err
+	}
+	session := analysis.SessionOf(results)
+	table, err := session.Table(name)
+	if err != nil {
+		return apiFail(c, http.StatusInternalServerError, err.Error())
+	}
+
+	params := c.QueryParams()
+	columns := make([]string, 0, len(params))
+	for column := range params {
+		if column != "offset" && column != "limit" {
+			columns = append(columns, column)
+		}
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		if err := table.Filter(column, params.Get(column)); err != nil {
+			return apiFail(c, http.StatusBadRequest, err.Error())
+		}
+	}
+
+	total := table.Page(offset, limit)
+	var rows bytes.Buffer
+	if err := table.Write(analysis.TableJSON, &rows); err != nil {
+		return apiFail(c, http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, apiResponse{
+		Data: json.RawMessage(rows.Bytes()),
+		Meta: &apiMeta{Offset: offset, Limit: limit, Total: total},
+	})
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/shreethaar/heroPacket/view/certificates"
+	"github.com/shreethaar/heroPacket/view/home"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleCertificates lists the X.509 certificates seen in TLS handshakes
+func (h *UserHandler) HandleCertificates(c echo.Context) error {
+	filename := c.Param("filename")
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+
+	return render(c, certificates.Show(certificates.ViewData{
+		Filename:     filename,
+		Certificates: session.Certificates().GetCertificates(),
+	}))
+}
+
+// HandleCertificateDownload sends one certificate as DER or PEM
+func (h *UserHandler) HandleCertificateDownload(c echo.Context) error {
+	filename := c.Param("filename")
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error processing PCAP file")
+	}
+
+	cert := session.Certificates().Get(c.Param("fingerprint"))
+	if cert == nil {
+		return c.String(http.StatusNotFound, "Certificate not found")
+	}
+
+	switch c.QueryParam("format") {
+	case "pem":
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", cert.SHA256[:16]+".pem"))
+		return c.Blob(http.StatusOK, "application/x-pem-file", cert.PEM())
+	default:
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", cert.SHA256[:16]+".der"))
+		return c.Blob(http.StatusOK, "application/pkix-cert", cert.Raw)
+	}
+}
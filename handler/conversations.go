@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"github.com/shreethaar/heroPacket/view/conversations"
+	"github.com/shreethaar/heroPacket/view/home"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleConversations lists the conversations of one type, sorted and
+// paginated by the type, sort, order and page query parameters
+func (h *UserHandler) HandleConversations(c echo.Context) error {
+	filename := c.Param("filename")
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+
+	kind := c.QueryParam("type")
+	valid := false
+	for _, t := range analysis.ConversationTypes {
+		if t == kind {
+			valid = true
+		}
+	}
+	if !valid {
+		kind = analysis.ConversationTCP
+	}
+
+	sortBy := c.QueryParam("sort")
+	if !analysis.ValidConversationSort(sortBy) {
+		sortBy = "bytes"
+	}
+	desc := c.QueryParam("order") != "asc"
+
+	page, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	tracker := session.Conversations()
+	list, total := tracker.List(kind, sortBy, desc, (page-1)*conversations.PageSize, conversations.PageSize)
+	if len(list) == 0 && total > 0 {
+		// Past the last page
+		page = (total + conversations.PageSize - 1) / conversations.PageSize
+		list, _ = tracker.List(kind, sortBy, desc, (page-1)*conversations.PageSize, conversations.PageSize)
+	}
+
+	data := conversations.ViewData{
+		Filename:      filename,
+		Type:          kind,
+		Sort:          sortBy,
+		Desc:          desc,
+		Page:          page,
+		Total:         total,
+		Counts:        tracker.Count(),
+		Conversations: list,
+	}
+
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return render(c, conversations.Table(data))
+	}
+	return render(c, conversations.Show(data))
+}
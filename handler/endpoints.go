@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"github.com/shreethaar/heroPacket/api"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"github.com/shreethaar/heroPacket/view/endpoints"
+	"github.com/shreethaar/heroPacket/view/home"
+	"strconv"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleEndpoints lists the endpoints of one type, sorted and paginated by
+// the type, sort, order and page query parameters
+func (h *UserHandler) HandleEndpoints(c echo.Context) error {
+	filename := c.Param("filename")
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+
+	kind := c.QueryParam("type")
+	valid := false
+	for _, t := range analysis.EndpointTypes {
+		if t == kind {
+			valid = true
+		}
+	}
+	if !valid {
+		kind = analysis.EndpointIPv4
+	}
+
+	sortBy := c.QueryParam("sort")
+	if !analysis.ValidEndpointSort(sortBy) {
+		sortBy = "bytes"
+	}
+	desc := c.QueryParam("order") != "asc"
+
+	page, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	analyzer := session.Endpoints()
+	list, total := analyzer.List(kind, sortBy, desc, (page-1)*endpoints.PageSize, endpoints.PageSize)
+	if len(list) == 0 && total > 0 {
+		// Past the last page
+		page = (total + endpoints.PageSize - 1) / endpoints.PageSize
+		list, _ = analyzer.List(kind, sortBy, desc, (page-1)*endpoints.PageSize, endpoints.PageSize)
+	}
+
+	data := endpoints.ViewData{
+		Filename:  filename,
+		Type:      kind,
+		Sort:      sortBy,
+		Desc:      desc,
+		Page:      page,
+		Total:     total,
+		Counts:    analyzer.Count(),
+		Endpoints: list,
+	}
+	if kind != analysis.EndpointEthernet {
+		data.Geo = lookupGeo(list)
+	}
+
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return render(c, endpoints.Table(data))
+	}
+	return render(c, endpoints.Show(data))
+}
+
+// lookupGeo fetches the location of the public addresses in parallel
+func lookupGeo(list []*analysis.Endpoint) map[string]*api.IPInfo {
+	geo := make(map[string]*api.IPInfo)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, ep := range list {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			if info := api.LookupIPInfo(address); info != nil {
+				mu.Lock()
+				geo[address] = info
+				mu.Unlock()
+			}
+		}(ep.Address)
+	}
+	wg.Wait()
+	return geo
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"github.com/shreethaar/heroPacket/view/expert"
+	"github.com/shreethaar/heroPacket/view/home"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleExpertInfo lists the expert info types with their counts, filtered
+// by the severity and group query parameters
+func (h *UserHandler) HandleExpertInfo(c echo.Context) error {
+	filename := c.Param("filename")
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+
+	severity := c.QueryParam("severity")
+	if analysis.ExpertSeverityRank(severity) == len(analysis.ExpertSeverities) {
+		severity = ""
+	}
+	group := ""
+	for _, g := range analysis.ExpertGroups {
+		if g == c.QueryParam("group") {
+			group = g
+		}
+	}
+
+	info := session.Expert()
+	data := expert.ViewData{
+		Filename:       filename,
+		Severity:       severity,
+		Group:          group,
+		SeverityCounts: info.SeverityCounts(),
+		GroupCounts:    info.GroupCounts(),
+		Types:          info.Types(severity, group),
+	}
+
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return render(c, expert.Content(data))
+	}
+	return render(c, expert.Show(data))
+}
+
+// HandleExpertItems returns one page of the items of the type given by the
+// type query parameter
+func (h *UserHandler) HandleExpertItems(c echo.Context) error {
+	filename := c.Param("filename")
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+
+	page, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	key := c.QueryParam("type")
+	_, total := session.Expert().Items(key, 0, 1)
+	page = clampPage(page, total, expert.PageSize)
+	items, _ := session.Expert().Items(key, (page-1)*expert.PageSize, expert.PageSize)
+	return render(c, expert.Items(expert.ItemsData{
+		Filename: filename,
+		Key:      key,
+		Page:     page,
+		Total:    total,
+		Items:    items,
+	}))
+}
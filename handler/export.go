@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"github.com/shreethaar/heroPacket/view/home"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// exportRequest reads the packet selection and format of an export from
+// the bpf, filter, conversation, from, to, packets and format parameters.
+// The times are read as on the host page, in the capture's time zone.
+func exportRequest(c echo.Context, session *analysis.Session) (analysis.PacketSelection, string, error) {
+	selection := analysis.PacketSelection{
+		BPF:          strings.TrimSpace(c.FormValue("bpf")),
+		Filter:       strings.TrimSpace(c.FormValue("filter")),
+		Conversation: c.FormValue("conversation"),
+	}
+
+	loc := time.Local
+	if first := session.Packets().Get(1); first != nil {
+		loc = first.Time.Location()
+	}
+	if value := c.FormValue("from"); value != "" {
+		if selection.From = parseHostTime(value, loc); selection.From.IsZero() {
+			return selection, "", fmt.Errorf("invalid start time %q", value)
+		}
+	}
+	if value := c.FormValue("to"); value != "" {
+		if selection.To = parseHostTime(value, loc); selection.To.IsZero() {
+			return selection, "", fmt.Errorf("invalid end time %q", value)
+		}
+		// Include all of the last second
+		selection.To = selection.To.Add(time.Second - time.Nanosecond)
+	}
+	if value := strings.TrimSpace(c.FormValue("packets")); value != "" {
+		numbers, err := analysis.ParsePacketRanges(value)
+		if err != nil {
+			return selection, "", err
+		}
+		selection.Packets = numbers
+	}
+
+	format := c.FormValue("format")
+	if format == "" {
+		format = analysis.FormatPcapNG
+	}
+	if format != analysis.FormatPcap && format != analysis.FormatPcapNG {
+		return selection, "", fmt.Errorf("format must be %s or %s", analysis.FormatPcap, analysis.FormatPcapNG)
+	}
+	return selection, format, nil
+}
+
+// exportName names an export of a capture, e.g.
+// trace-export-20240101-120000.pcapng, or trace-sanitized-... when sanitized
+func exportName(c echo.Context, filename, format string) string {
+	kind := "export"
+	if c.FormValue("sanitize") != "" {
+		kind = "sanitized"
+	}
+	stem := strings.TrimSuffix(filename, filepath.Ext(filename))
+	return fmt.Sprintf("%s-%s-%s.%s", stem, kind, time.Now().Format("20060102-150405"), format)
+}
+
+// exportTo writes the selected packets to w, passed through a Sanitizer
+// when the sanitize parameter is set
+func exportTo(c echo.Context, session *analysis.Session, selection analysis.PacketSelection, format string, w io.Writer) (int, error) {
+	if c.FormValue("sanitize") == "" {
+		return analysis.ExportPackets(session.Index(), selection, format, w)
+	}
+	sanitizer, err := newSanitizer(c)
+	if err != nil {
+		return 0, err
+	}
+	return analysis.SanitizePackets(session.Index(), selection, sanitizer, format, w)
+}
+
+// HandleExport sends the packets of a capture chosen by the query
+// parameters as a pcap or pcapng download, sanitized if asked
+func (h *UserHandler) HandleExport(c echo.Context) error {
+	filename := filepath.Base(c.Param("filename"))
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error processing PCAP file")
+	}
+	if session.Index() == nil {
+		return c.String(http.StatusInternalServerError, "Capture is not indexed")
+	}
+
+	selection, format, err := exportRequest(c, session)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/vnd.tcpdump.pcap")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", exportName(c, filename, format)))
+	if _, err := exportTo(c, session, selection, format, c.Response()); err != nil {
+		if !c.Response().Committed {
+			c.Response().Header().Del(echo.HeaderContentDisposition)
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+		log.Printf("Error exporting packets of %s: %v", filename, err)
+	}
+	return nil
+}
+
+// HandleExportSave stores the packets chosen by the form as a new upload
+func (h *UserHandler) HandleExportSave(c echo.Context) error {
+	filename := filepath.Base(c.Param("filename"))
+	session, err := h.loadSession(filename)
+	if err != nil || session.Index() == nil {
+		return render(c, home.UploadResponseTemplate(home.UploadResponse{
+			Status:  "error",
+			Message: "Error processing PCAP file",
+		}))
+	}
+
+	selection, format, err := exportRequest(c, session)
+	if err != nil {
+		return render(c, home.UploadResponseTemplate(home.UploadResponse{
+			Status:  "error",
+			Message: err.Error(),
+		}))
+	}
+
+	var buf bytes.Buffer
+	count, err := exportTo(c, session, selection, format, &buf)
+	if err != nil {
+		return render(c, home.UploadResponseTemplate(home.UploadResponse{
+			Status:  "error",
+			Message: err.Error(),
+		}))
+	}
+	if count == 0 {
+		return render(c, home.UploadResponseTemplate(home.UploadResponse{
+			Status:  "error",
+			Message: "No packets match the selection",
+		}))
+	}
+
+	// Exports of the same selection are duplicates like repeated uploads
+	hashStr := fmt.Sprintf("%x", md5.Sum(buf.Bytes()))
+	h.hashMutex.RLock()
+	existingFile, exists := h.fileHashes[hashStr]
+	h.hashMutex.RUnlock()
+	if exists {
+		return render(c, home.UploadResponseTemplate(home.UploadResponse{
+			Status:  "error",
+			Message: fmt.Sprintf("This export has already been saved as %s", filepath.Base(existingFile)),
+		}))
+	}
+
+	name := exportName(c, filename, format)
+	dstPath := filepath.Join("uploads", name)
+	if _, err := os.Stat(dstPath); !errors.Is(err, os.ErrNotExist) {
+		return render(c, home.UploadResponseTemplate(home.UploadResponse{
+			Status:  "error",
+			Message: fmt.Sprintf("%s already exists", name),
+		}))
+	}
+	if err := os.WriteFile(dstPath, buf.Bytes(), 0644); err != nil {
+		log.Println("DEBUG: Failed to save export:", err)
+		return render(c, home.UploadResponseTemplate(home.UploadResponse{
+			Status:  "error",
+			Message: "Failed to save export",
+		}))
+	}
+	h.saveFileHash(hashStr, dstPath)
+
+	c.Response().Header().Set("HX-Trigger", "fileListUpdate")
+	return render(c, home.UploadResponseTemplate(home.UploadResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Saved %d packets as %s", count, name),
+	}))
+}
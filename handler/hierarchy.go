@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/shreethaar/heroPacket/view/hierarchy"
+	"github.com/shreethaar/heroPacket/view/home"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleProtocolHierarchy renders the protocol hierarchy tree, or sends it
+// as JSON when format=json
+func (h *UserHandler) HandleProtocolHierarchy(c echo.Context) error {
+	filename := c.Param("filename")
+	session, err := h.loadSession(filename)
+	if err != nil {
+		if c.QueryParam("format") == "json" {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Error processing PCAP file"})
+		}
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+
+	tree := session.Protocols().Tree()
+	if c.QueryParam("format") == "json" {
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename+"-protocols.json"))
+		return c.JSONPretty(http.StatusOK, tree, "  ")
+	}
+
+	return render(c, hierarchy.Tree(hierarchy.ViewData{
+		Filename: filename,
+		Root:     tree,
+	}))
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"github.com/shreethaar/heroPacket/api"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"github.com/shreethaar/heroPacket/view/home"
+	"github.com/shreethaar/heroPacket/view/host"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Layouts accepted for the from and to query parameters, as sent by
+// datetime-local inputs with and without seconds
+var hostTimeLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// hostProfile builds the profile of the ip parameter over the from and to
+// query parameters, which are read in the capture's time zone
+func hostProfile(c echo.Context, session *analysis.Session) *analysis.HostProfile {
+	ip := c.Param("ip")
+	endpoint := session.Endpoints().Get(ip)
+	if endpoint == nil {
+		return nil
+	}
+	loc := endpoint.FirstSeen.Location()
+	from, to := parseHostTime(c.QueryParam("from"), loc), parseHostTime(c.QueryParam("to"), loc)
+	if !to.IsZero() {
+		// The inputs have whole seconds; include all of the last one
+		to = to.Add(time.Second - time.Nanosecond)
+	}
+	return session.HostProfile(ip, from, to)
+}
+
+func parseHostTime(value string, loc *time.Location) time.Time {
+	for _, layout := range hostTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// HandleHost shows the profile of one IP address, optionally limited to the
+// from and to query parameters
+func (h *UserHandler) HandleHost(c echo.Context) error {
+	filename := c.Param("filename")
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+
+	profile := hostProfile(c, session)
+	if profile == nil {
+		return render(c, home.ErrorTemplate("Host not found in this capture"))
+	}
+
+	return render(c, host.Show(host.ViewData{
+		Filename: filename,
+		Profile:  profile,
+		Geo:      api.LookupIPInfo(profile.IP),
+		Names:    session.Names().Map(),
+		Query:    c.QueryString(),
+	}))
+}
+
+// HandleHostTraffic draws the traffic of one IP address over time as SVG
+func (h *UserHandler) HandleHostTraffic(c echo.Context) error {
+	// The chart is an image, so errors are plain statuses rather than pages
+	session, err := h.loadSession(c.Param("filename"))
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error processing PCAP file")
+	}
+
+	profile := hostProfile(c, session)
+	if profile == nil {
+		return c.String(http.StatusNotFound, "Host not found in this capture")
+	}
+
+	var v analysis.Visualization
+	return v.HostTrafficChart(profile.Traffic, c.Response().Writer)
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// Analysis job states
+const (
+	jobNone    = "none"
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// analysisJob is the background analysis of a capture started through the
+// API. Pages analyse captures on demand instead.
+type analysisJob struct {
+	State    string     `json:"state"`
+	Error    string     `json:"error,omitempty"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// startAnalysis analyses a capture in the background unless it has been
+// analysed or is being analysed, and returns the state of its job
+func (h *UserHandler) startAnalysis(filename string) analysisJob {
+	filename = filepath.Base(filename)
+
+	// Checking and starting under one lock keeps two requests from both
+	// starting a job
+	h.jobMutex.Lock()
+	defer h.jobMutex.Unlock()
+	if job := h.jobStatus(filename); job.State == jobRunning || job.State == jobDone {
+		return job
+	}
+
+	now := time.Now()
+	job := &analysisJob{State: jobRunning, Started: &now}
+	h.jobs[filename] = job
+
+	go func() {
+		_, err := h.loadSession(filename)
+		finished := time.Now()
+
+		h.jobMutex.Lock()
+		defer h.jobMutex.Unlock()
+		job.Finished = &finished
+		if err != nil {
+			job.State, job.Error = jobFailed, err.Error()
+		} else {
+			job.State = jobDone
+		}
+	}()
+	return *job
+}
+
+// analysisStatus returns the state of the analysis of a capture. Captures
+// analysed by a page count as done.
+func (h *UserHandler) analysisStatus(filename string) analysisJob {
+	h.jobMutex.Lock()
+	defer h.jobMutex.Unlock()
+	return h.jobStatus(filepath.Base(filename))
+}
+
+// jobStatus is analysisStatus for callers holding jobMutex
+func (h *UserHandler) jobStatus(filename string) analysisJob {
+	if job, exists := h.jobs[filename]; exists {
+		return *job
+	}
+
+	h.cacheMutex.RLock()
+	_, cached := h.analysisCache[filename]
+	h.cacheMutex.RUnlock()
+	if cached {
+		return analysisJob{State: jobDone}
+	}
+	return analysisJob{State: jobNone}
+}
@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// openAPIDocument describes the JSON API as OpenAPI 3.0. Paths come from
+// apiRouteList, table schemas from the table columns and the other schemas
+// from the Go types the endpoints encode.
+func openAPIDocument() map[string]interface{} {
+	schemas := map[string]interface{}{
+		"Error": schemaOf(reflect.TypeOf(apiErrorResponse{}), nil),
+		"Meta":  schemaOf(reflect.TypeOf(apiMeta{}), nil),
+	}
+	paths := map[string]map[string]interface{}{}
+
+	for _, route := range apiRouteList() {
+		path := route.Path
+		var parameters []interface{}
+		for _, segment := range strings.Split(route.Path, "/") {
+			if strings.HasPrefix(segment, ":") {
+				name := segment[1:]
+				path = strings.Replace(path, segment, "{"+name+"}", 1)
+				parameters = append(parameters, map[string]interface{}{
+					"name": name, "in": "path", "required": true,
+					"schema": map[string]interface{}{"type": "string"},
+				})
+			}
+		}
+
+		var data map[string]interface{}
+		list := route.List || route.Table != ""
+		switch {
+		case route.Table != "":
+			name := strings.ReplaceAll(analysis.TableTitles[route.Table], " ", "")
+			schemas[name] = tableSchema(route.Table)
+			data = map[string]interface{}{"$ref": "#/components/schemas/" + name}
+			for _, column := range analysis.TableColumns[route.Table] {
+				parameters = append(parameters, map[string]interface{}{
+					"name": column.Name, "in": "query",
+					"description": "Only rows with this " + column.Name,
+					"schema":      map[string]interface{}{"type": "string"},
+				})
+			}
+		case route.Result != nil:
+			data = schemaOf(reflect.TypeOf(route.Result), schemas)
+		}
+		if list {
+			parameters = append(parameters,
+				map[string]interface{}{"name": "offset", "in": "query", "schema": map[string]interface{}{"type": "integer", "minimum": 0, "default": 0}},
+				map[string]interface{}{"name": "limit", "in": "query", "schema": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": apiMaxLimit, "default": apiDefaultLimit}},
+			)
+			data = map[string]interface{}{"type": "array", "items": data}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		if data != nil {
+			envelope := map[string]interface{}{
+				"data":     data,
+				"warnings": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			}
+			if list {
+				envelope["meta"] = map[string]interface{}{"$ref": "#/components/schemas/Meta"}
+			}
+			success["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]interface{}{
+					"type": "object", "required": []string{"data"}, "properties": envelope,
+				}},
+			}
+		}
+		responses := map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"}},
+				},
+			},
+		}
+		if strings.HasPrefix(route.Path, "/captures/:name/") && route.Result != (analysisJob{}) {
+			responses["202"] = map[string]interface{}{
+				"description": "The capture is still being analysed; data is the analysis job",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": map[string]interface{}{
+						"type": "object", "properties": map[string]interface{}{"data": schemaOf(reflect.TypeOf(analysisJob{}), schemas)},
+					}},
+				},
+			}
+		}
+
+		operation := map[string]interface{}{
+			"summary":     route.Summary,
+			"operationId": operationID(route),
+			"responses":   responses,
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+		if route.Body != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(route.Body), schemas)},
+				},
+			}
+		}
+		if route.Upload {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"multipart/form-data": map[string]interface{}{"schema": map[string]interface{}{
+						"type":     "object",
+						"required": []string{"file"},
+						"properties": map[string]interface{}{
+							"file":   map[string]interface{}{"type": "string", "format": "binary", "description": "pcap or pcapng capture"},
+							"keylog": map[string]interface{}{"type": "string", "format": "binary", "description": "Optional SSLKEYLOGFILE"},
+						},
+					}},
+				},
+			}
+		}
+
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(route.Method)] = operation
+	}
+	paths["/openapi.json"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary":     "Get this document",
+			"operationId": "getOpenAPI",
+			"responses":   map[string]interface{}{"200": map[string]interface{}{"description": "OK"}},
+		},
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "heroPacket API",
+			"version":     APIVersion,
+			"description": "Analyses of uploaded packet captures. Results answer 202 with the analysis job until the capture has been analysed.",
+		},
+		"servers":    []interface{}{map[string]interface{}{"url": "/api/v1"}},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+// operationID names an operation after its method and path, for example
+// listCapturesDnsQueries
+func operationID(route apiRoute) string {
+	verb := map[string]string{http.MethodGet: "get", http.MethodPost: "create", http.MethodDelete: "delete"}[route.Method]
+	if route.List || route.Table != "" {
+		verb = "list"
+	}
+	var b strings.Builder
+	b.WriteString(verb)
+	for _, segment := range strings.Split(route.Path, "/") {
+		if segment == "" || strings.HasPrefix(segment, ":") {
+			continue
+		}
+		runes := []rune(segment)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	return b.String()
+}
+
+// tableSchema describes one row of an analysis table
+func tableSchema(name string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for _, column := range analysis.TableColumns[name] {
+		var schema map[string]interface{}
+		switch column.Type {
+		case analysis.ColumnInteger:
+			schema = map[string]interface{}{"type": "integer"}
+		case analysis.ColumnNumber:
+			schema = map[string]interface{}{"type": "number"}
+		case analysis.ColumnBoolean:
+			schema = map[string]interface{}{"type": "boolean"}
+		case analysis.ColumnTime:
+			schema = map[string]interface{}{"type": "string", "format": "date-time", "nullable": true}
+		default:
+			schema = map[string]interface{}{"type": "string"}
+		}
+		properties[column.Name] = schema
+		required = append(required, column.Name)
+	}
+	return map[string]interface{}{"type": "object", "required": required, "properties": properties}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf describes the JSON encoding of a Go type. Named structs are added
+// to schemas and referenced, which also covers recursive types; a nil
+// schemas inlines the struct.
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+	var schema map[string]interface{}
+	switch {
+	case t == timeType:
+		schema = map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.String:
+		schema = map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		schema = map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema = map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema = map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.Slice:
+		schema = map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case t.Kind() == reflect.Map:
+		schema = map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case t.Kind() == reflect.Struct:
+		if schemas == nil {
+			return structSchema(t, nil)
+		}
+		name := strings.TrimPrefix(t.Name(), "api")
+		name = strings.ToUpper(name[:1]) + name[1:]
+		if _, exists := schemas[name]; !exists {
+			schemas[name] = nil // Placeholder while the fields refer back
+			schemas[name] = structSchema(t, schemas)
+		}
+		schema = map[string]interface{}{"$ref": "#/components/schemas/" + name}
+		if nullable {
+			// Siblings of $ref are ignored in OpenAPI 3.0
+			schema = map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		return schema
+	default:
+		schema = map[string]interface{}{}
+	}
+	if nullable {
+		schema["nullable"] = true
+	}
+	return schema
+}
+
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous {
+				add(field.Type)
+				continue
+			}
+			if field.PkgPath != "" {
+				continue
+			}
+			tag := strings.Split(field.Tag.Get("json"), ",")
+			name := tag[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaOf(field.Type, schemas)
+			omitempty := false
+			for _, option := range tag[1:] {
+				omitempty = omitempty || option == "omitempty"
+			}
+			if !omitempty {
+				required = append(required, name)
+			}
+		}
+	}
+	add(t)
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
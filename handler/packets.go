@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"github.com/shreethaar/heroPacket/view/home"
+	"github.com/shreethaar/heroPacket/view/packets"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandlePackets shows the packet list. The offset query parameter asks for
+// the next rows only, as loaded while scrolling; start opens the list at a
+// packet along with its dissection, and at does the same for the first
+// packet at a number of seconds into the capture.
+func (h *UserHandler) HandlePackets(c echo.Context) error {
+	filename := c.Param("filename")
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+
+	data := packets.ViewData{Filename: filename}
+	if token, ok := c.Get("csrf").(string); ok {
+		data.CSRF = token
+	}
+	if offset, err := strconv.Atoi(c.QueryParam("offset")); err == nil {
+		data.Rows, data.Total = session.Packets().Page(offset, packets.PageSize)
+		data.Offset = offset
+		return render(c, packets.Rows(data))
+	}
+
+	start, err := strconv.Atoi(c.QueryParam("start"))
+	if at, atErr := strconv.ParseFloat(c.QueryParam("at"), 64); atErr == nil && session.Index() != nil && session.Packets().Count() > 0 {
+		// Seconds since the first packet, as in the Time column
+		first := session.Packets().Get(1).Time
+		start, err = session.Index().SeekTime(first.Add(time.Duration(at*float64(time.Second)))), nil
+	}
+	if err == nil && session.Packets().Get(start) != nil {
+		data.Offset = start - 1
+		if data.Detail, err = dissectPacket(session, start); err != nil {
+			return render(c, home.ErrorTemplate("Error reading packet"))
+		}
+	}
+	data.Rows, data.Total = session.Packets().Page(data.Offset, packets.PageSize)
+
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return render(c, packets.Content(data))
+	}
+	return render(c, packets.Show(data))
+}
+
+// HandlePacket returns the dissection tree and bytes of one packet
+func (h *UserHandler) HandlePacket(c echo.Context) error {
+	filename := c.Param("filename")
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil || session.Packets().Get(number) == nil {
+		return render(c, home.ErrorTemplate("Packet not found"))
+	}
+	if c.Request().Header.Get("HX-Request") != "true" {
+		return c.Redirect(http.StatusFound, fmt.Sprintf("/packets/%s?start=%d", filename, number))
+	}
+
+	dissection, err := dissectPacket(session, number)
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error reading packet"))
+	}
+	return render(c, packets.Detail(dissection))
+}
+
+func dissectPacket(session *analysis.Session, number int) (*analysis.Dissection, error) {
+	index := session.Index()
+	if index == nil {
+		return nil, errors.New("capture is not indexed")
+	}
+	packet, err := index.ReadPacket(number)
+	if err != nil {
+		return nil, err
+	}
+	return analysis.Dissect(number, packet), nil
+}
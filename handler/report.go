@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/shreethaar/heroPacket/api"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"github.com/shreethaar/heroPacket/view/home"
+	"github.com/shreethaar/heroPacket/view/report"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+// reportLookups limits the GeoIP lookups of a report to the busiest public
+// addresses
+const reportLookups = 50
+
+// HandleReportOptions shows the form choosing the sections, notes and format
+// of a report
+func (h *UserHandler) HandleReportOptions(c echo.Context) error {
+	filename := filepath.Base(c.Param("filename"))
+	if _, err := h.loadSession(filename); err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+	return render(c, report.Options(report.OptionsData{Filename: filename}))
+}
+
+// HandleReport sends the analysis of a capture as an HTML, Markdown or PDF
+// download. Every section is included unless section parameters choose
+// some.
+func (h *UserHandler) HandleReport(c echo.Context) error {
+	filename := filepath.Base(c.Param("filename"))
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error processing PCAP file")
+	}
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = analysis.ReportHTML
+	}
+	if format != analysis.ReportHTML && format != analysis.ReportMarkdown && format != analysis.ReportPDF {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("format must be %s, %s or %s", analysis.ReportHTML, analysis.ReportMarkdown, analysis.ReportPDF))
+	}
+
+	opts := analysis.ReportOptions{
+		Filename: filename,
+		Notes:    c.QueryParam("notes"),
+	}
+	if utf8.RuneCountInString(opts.Notes) > report.MaxNotes {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("Notes are limited to %d characters", report.MaxNotes))
+	}
+	for _, id := range c.QueryParams()["section"] {
+		if _, known := analysis.ReportTitles[id]; !known {
+			return c.String(http.StatusBadRequest, fmt.Sprintf("unknown report section %q", id))
+		}
+		opts.Sections = append(opts.Sections, id)
+	}
+	if value := c.QueryParam("top"); value != "" {
+		if opts.Top, err = strconv.Atoi(value); err != nil || opts.Top < 1 || opts.Top > 100 {
+			return c.String(http.StatusBadRequest, "top must be between 1 and 100")
+		}
+	}
+
+	wants := func(id string) bool {
+		if len(opts.Sections) == 0 {
+			return true
+		}
+		for _, section := range opts.Sections {
+			if section == id {
+				return true
+			}
+		}
+		return false
+	}
+	filePath := filepath.Join("uploads", filename)
+	if wants(analysis.ReportProperties) {
+		opts.Properties = captureProperties(filePath)
+	}
+	if wants(analysis.ReportGeoIP) {
+		opts.Locations = locateEndpoints(session)
+	}
+
+	var buf bytes.Buffer
+	contentType := "text/html; charset=utf-8"
+	built := analysis.BuildReport(session, opts)
+	switch format {
+	case analysis.ReportHTML:
+		err = report.Document(built).Render(c.Request().Context(), &buf)
+	case analysis.ReportMarkdown:
+		contentType = "text/markdown; charset=utf-8"
+		err = built.Write(format, &buf)
+	case analysis.ReportPDF:
+		contentType = "application/pdf"
+		err = built.Write(format, &buf)
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Failed to write report: "+err.Error())
+	}
+
+	name := strings.TrimSuffix(filename, filepath.Ext(filename)) + "-report." + format
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name))
+	return c.Blob(http.StatusOK, contentType, buf.Bytes())
+}
+
+// captureProperties reads the properties of a capture, or nil when they
+// cannot be read
+func captureProperties(filePath string) *analysis.CaptureProperties {
+	propertiesJSON, err := analysis.GetCaptureProperties(filePath)
+	if err != nil {
+		return nil
+	}
+	var props analysis.CaptureProperties
+	if err := json.Unmarshal([]byte(propertiesJSON), &props); err != nil {
+		return nil
+	}
+	return &props
+}
+
+// locateEndpoints geolocates the busiest public IP endpoints of a session
+func locateEndpoints(session *analysis.Session) []analysis.ReportLocation {
+	var locations []analysis.ReportLocation
+	lookups := 0
+	for _, kind := range []string{analysis.EndpointIPv4, analysis.EndpointIPv6} {
+		endpoints, _ := session.Endpoints().List(kind, "bytes", true, 0, 0)
+		for _, endpoint := range endpoints {
+			ip := net.ParseIP(endpoint.Address)
+			if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() || lookups == reportLookups {
+				continue
+			}
+			lookups++
+			info := api.LookupIPInfo(endpoint.Address)
+			if info == nil {
+				continue
+			}
+			locations = append(locations, analysis.ReportLocation{
+				IP:      endpoint.Address,
+				Name:    endpoint.Name,
+				Country: info.Country,
+				Region:  info.Region,
+				City:    info.City,
+				Org:     info.Org,
+				Packets: endpoint.Packets(),
+				Bytes:   endpoint.Bytes(),
+			})
+		}
+	}
+	return locations
+}
@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"github.com/shreethaar/heroPacket/view/home"
+	"github.com/shreethaar/heroPacket/view/resolved"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleResolved lists the hostnames observed for each address, optionally
+// narrowed down by the q query parameter
+func (h *UserHandler) HandleResolved(c echo.Context) error {
+	filename := c.Param("filename")
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+
+	query := c.QueryParam("q")
+	return render(c, resolved.Table(resolved.ViewData{
+		Filename: filename,
+		Query:    query,
+		Names:    session.Names().Search(query),
+	}))
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/csv"
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Environment variables configuring sanitization. Without a key one is
+// generated and kept in analysis.SanitizeKeyPath; without a password the
+// mapping report is disabled.
+const (
+	sanitizeKeyEnv    = "HEROPACKET_SANITIZE_KEY"
+	reportPasswordEnv = "HEROPACKET_REPORT_PASSWORD"
+)
+
+func sanitizeKey() ([]byte, error) {
+	if value := os.Getenv(sanitizeKeyEnv); value != "" {
+		return analysis.ParseSanitizeKey(value)
+	}
+	return analysis.LoadSanitizeKey(analysis.SanitizeKeyPath)
+}
+
+// newSanitizer configures a Sanitizer from the keep_oui, hash_dns, payload,
+// protocols and truncate parameters. Payloads are truncated unless payload
+// says otherwise, and protocols lists exceptions, e.g. "dns=keep,http=zero".
+func newSanitizer(c echo.Context) (*analysis.Sanitizer, error) {
+	key, err := sanitizeKey()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := analysis.SanitizeOptions{
+		Key:       key,
+		KeepOUI:   c.FormValue("keep_oui") != "",
+		HashNames: c.FormValue("hash_dns") != "",
+		Payload:   c.FormValue("payload"),
+		Protocols: make(map[string]string),
+	}
+	if opts.Payload == "" {
+		opts.Payload = analysis.PayloadTruncate
+	}
+	if value := c.FormValue("truncate"); value != "" {
+		if opts.Truncate, err = strconv.Atoi(value); err != nil || opts.Truncate < 0 {
+			return nil, fmt.Errorf("invalid truncation length %q", value)
+		}
+	}
+
+	for _, rule := range strings.Split(c.FormValue("protocols"), ",") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		protocol, action, found := strings.Cut(rule, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid payload rule %q, expected protocol=action", rule)
+		}
+		opts.Protocols[strings.ToLower(strings.TrimSpace(protocol))] = strings.TrimSpace(action)
+	}
+	return analysis.NewSanitizer(opts)
+}
+
+// ReportAuth guards the sanitization mapping report, which undoes the
+// anonymization, with HTTP basic authentication against the password in
+// HEROPACKET_REPORT_PASSWORD. Any user name is accepted.
+func ReportAuth() echo.MiddlewareFunc {
+	return middleware.BasicAuth(func(_, password string, c echo.Context) (bool, error) {
+		expected := os.Getenv(reportPasswordEnv)
+		if expected == "" {
+			return false, echo.NewHTTPError(http.StatusForbidden, "The mapping report is disabled")
+		}
+		return subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1, nil
+	})
+}
+
+// HandleSanitizeReport lists, as CSV, the addresses and names a sanitized
+// export with the same parameters replaces and what replaces them
+func (h *UserHandler) HandleSanitizeReport(c echo.Context) error {
+	filename := filepath.Base(c.Param("filename"))
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error processing PCAP file")
+	}
+	if session.Index() == nil {
+		return c.String(http.StatusInternalServerError, "Capture is not indexed")
+	}
+
+	selection, _, err := exportRequest(c, session)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	sanitizer, err := newSanitizer(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if _, err := analysis.SanitizePackets(session.Index(), selection, sanitizer, analysis.FormatPcapNG, io.Discard); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"kind", "original", "anonymized"})
+	for _, m := range sanitizer.Mappings() {
+		writer.Write([]string{m.Kind, m.Original, m.Anonymized})
+	}
+	writer.Flush()
+
+	name := strings.TrimSuffix(filename, filepath.Ext(filename)) + "-sanitize-mapping.csv"
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name))
+	return c.Blob(http.StatusOK, "text/csv", buf.Bytes())
+}
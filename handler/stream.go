@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"github.com/shreethaar/heroPacket/view/home"
+	"github.com/shreethaar/heroPacket/view/stream"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandleStream shows the reassembled payload of one TCP or UDP stream
+func (h *UserHandler) HandleStream(c echo.Context) error {
+	filename := c.Param("filename")
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		return render(c, home.ErrorTemplate("Invalid stream index"))
+	}
+
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+
+	st := session.Streams().Get(index)
+	if st == nil {
+		return render(c, home.ErrorTemplate("Stream not found"))
+	}
+
+	mode := c.QueryParam("mode")
+	valid := false
+	for _, m := range stream.Modes {
+		if m == mode {
+			valid = true
+		}
+	}
+	if !valid {
+		mode = "ascii"
+	}
+
+	// Decrypted TLS streams show their plaintext unless raw records are asked for
+	raw := c.QueryParam("raw") == "1"
+	data := stream.ViewData{
+		Filename:    filename,
+		Stream:      st,
+		StreamCount: session.Streams().Count(),
+		Mode:        mode,
+		Decryptable: st.Decrypted != nil,
+		Raw:         raw,
+	}
+	if st.Decrypted != nil && !raw {
+		data.Stream = st.Decrypted
+	}
+
+	// Mode toggles only swap the payload pane
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return render(c, stream.Payload(data))
+	}
+	return render(c, stream.Show(data))
+}
+
+// HandleStreamDownload sends one direction of a stream as a binary file,
+// decrypted when TLS secrets are available unless raw=1 is given
+func (h *UserHandler) HandleStreamDownload(c echo.Context) error {
+	filename := c.Param("filename")
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid stream index")
+	}
+
+	var dir analysis.StreamDirection
+	switch c.Param("direction") {
+	case "client":
+		dir = analysis.ClientToServer
+	case "server":
+		dir = analysis.ServerToClient
+	default:
+		return c.String(http.StatusBadRequest, "Direction must be client or server")
+	}
+
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error processing PCAP file")
+	}
+
+	st := session.Streams().Get(index)
+	if st == nil {
+		return c.String(http.StatusNotFound, "Stream not found")
+	}
+
+	name := fmt.Sprintf("%s-stream%d-%s.bin", filename, index, dir)
+	if st.Decrypted != nil && c.QueryParam("raw") != "1" {
+		st = st.Decrypted
+		name = fmt.Sprintf("%s-stream%d-%s-decrypted.bin", filename, index, dir)
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", name))
+	return c.Blob(http.StatusOK, "application/octet-stream", st.Data(dir))
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/shreethaar/heroPacket/api"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+var tableContentTypes = map[string]string{
+	analysis.TableCSV:    "text/csv; charset=utf-8",
+	analysis.TableJSON:   echo.MIMEApplicationJSONCharsetUTF8,
+	analysis.TableNDJSON: "application/x-ndjson",
+}
+
+// tableInfo describes a table for scripts discovering the downloads
+type tableInfo struct {
+	Name    string                 `json:"name"`
+	Title   string                 `json:"title"`
+	Columns []analysis.TableColumn `json:"columns"`
+	URLs    map[string]string      `json:"urls"`
+}
+
+// HandleTables lists the tables of a capture with their column definitions
+// and download URLs
+func (h *UserHandler) HandleTables(c echo.Context) error {
+	filename := filepath.Base(c.Param("filename"))
+	tables := make([]tableInfo, 0, len(analysis.TableNames))
+	for _, name := range analysis.TableNames {
+		info := tableInfo{
+			Name:    name,
+			Title:   analysis.TableTitles[name],
+			Columns: analysis.TableColumns[name],
+			URLs:    make(map[string]string),
+		}
+		for format := range tableContentTypes {
+			info.URLs[format] = fmt.Sprintf("/tables/%s/%s?format=%s", filename, name, format)
+		}
+		tables = append(tables, info)
+	}
+	return c.JSON(http.StatusOK, tables)
+}
+
+// HandleTable sends every row of one analysis table as CSV, JSON or NDJSON,
+// CSV unless the format parameter says otherwise
+func (h *UserHandler) HandleTable(c echo.Context) error {
+	filename := filepath.Base(c.Param("filename"))
+	name := c.Param("table")
+	if _, known := analysis.TableColumns[name]; !known {
+		return c.String(http.StatusNotFound, fmt.Sprintf("unknown table %q", name))
+	}
+	format := c.QueryParam("format")
+	if format == "" {
+		format = analysis.TableCSV
+	}
+	contentType, known := tableContentTypes[format]
+	if !known {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("format must be %s, %s or %s", analysis.TableCSV, analysis.TableJSON, analysis.TableNDJSON))
+	}
+
+	session, err := h.loadSession(filename)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, "Error processing PCAP file")
+	}
+
+	var table *analysis.Table
+	if name == analysis.TableGeoIP {
+		table, err = api.GeoIPTable(filepath.Join("uploads", filename), session.Names().Map())
+	} else {
+		table, err = session.Table(name)
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+
+	stem := strings.TrimSuffix(filename, filepath.Ext(filename))
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", stem+"-"+name+"."+format))
+	c.Response().WriteHeader(http.StatusOK)
+	if err := table.Write(format, c.Response()); err != nil {
+		log.Printf("Error writing %s table of %s: %v", name, filename, err)
+	}
+	return nil
+}
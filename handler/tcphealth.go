@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"github.com/shreethaar/heroPacket/view/home"
+	"github.com/shreethaar/heroPacket/view/tcphealth"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// clampPage limits a page number taken from the query to the pages that
+// hold the items, so the offset computed from it stays within them
+func clampPage(page, total, size int) int {
+	pages := (total + size - 1) / size
+	if page > pages {
+		page = pages
+	}
+	if page < 1 {
+		page = 1
+	}
+	return page
+}
+
+// tcpHealthData reads the kind and page query parameters and fills in one
+// page of the TCP events along with the summaries
+func tcpHealthData(c echo.Context, session *analysis.Session) tcphealth.ViewData {
+	kind := c.QueryParam("kind")
+	valid := false
+	for _, k := range analysis.TCPEventKinds {
+		if k == kind {
+			valid = true
+		}
+	}
+	if !valid {
+		kind = ""
+	}
+
+	page, err := strconv.Atoi(c.QueryParam("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	analyzer := session.TCPHealth()
+	_, total := analyzer.Events(kind, 0, 1)
+	page = clampPage(page, total, tcphealth.PageSize)
+	events, _ := analyzer.Events(kind, (page-1)*tcphealth.PageSize, tcphealth.PageSize)
+
+	return tcphealth.ViewData{
+		Filename: c.Param("filename"),
+		Kind:     kind,
+		Page:     page,
+		Total:    total,
+		Counts:   analyzer.Counts(),
+		Events:   events,
+	}
+}
+
+// HandleTCPHealth shows the TCP analysis: events by kind, and the RTT and
+// response times of each connection and server
+func (h *UserHandler) HandleTCPHealth(c echo.Context) error {
+	session, err := h.loadSession(c.Param("filename"))
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+
+	data := tcpHealthData(c, session)
+	data.Servers = session.TCPHealth().Servers()
+	data.Flows = session.TCPHealth().Flows()
+	if len(data.Flows) > tcphealth.FlowLimit {
+		data.Flows = data.Flows[:tcphealth.FlowLimit]
+	}
+
+	if c.Request().Header.Get("HX-Request") == "true" {
+		return render(c, tcphealth.Content(data))
+	}
+	return render(c, tcphealth.Show(data))
+}
+
+// HandleTCPEvents returns one page of the TCP events table
+func (h *UserHandler) HandleTCPEvents(c echo.Context) error {
+	session, err := h.loadSession(c.Param("filename"))
+	if err != nil {
+		return render(c, home.ErrorTemplate("Error processing PCAP file"))
+	}
+
+	if c.Request().Header.Get("HX-Request") != "true" {
+		return c.Redirect(http.StatusFound, "/tcp/"+c.Param("filename")+"?"+c.QueryString())
+	}
+	return render(c, tcphealth.Events(tcpHealthData(c, session)))
+}
@@ -2,12 +2,13 @@ package handler
 
 import (
 	"fmt"
-	"heroPacket/internal/analysis"
-	"heroPacket/view/docs"
-	"heroPacket/view/home"
-	"heroPacket/view/overview"
-    "heroPacket/view/properties"
-	"heroPacket/api"
+	"github.com/shreethaar/heroPacket/capture"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"github.com/shreethaar/heroPacket/view/docs"
+	"github.com/shreethaar/heroPacket/view/home"
+	"github.com/shreethaar/heroPacket/view/overview"
+    "github.com/shreethaar/heroPacket/view/properties"
+	"github.com/shreethaar/heroPacket/api"
     "log"
 	"net/http"
 	"os"
@@ -17,22 +18,33 @@ import (
 	"sync"
 	"bytes"
     "io"
+    "mime/multipart"
     "crypto/md5"
     "github.com/labstack/echo/v4"
     "encoding/json"
 )
 
+// maxCachedAnalyses bounds the analyses kept in memory; the least recently
+// used is dropped when another is added
+const maxCachedAnalyses = 8
+
 type UserHandler struct {
-	analysisCache map[string]*analysis.Session
+	analysisCache map[string]*capture.Analysis
+	cacheOrder    []string // Cached captures, least recently used first
+	options       map[string]capture.Options // Analyzers chosen per capture
 	fileHashes    map[string]string // Maps MD5 hash to filename
+	jobs          map[string]*analysisJob
 	cacheMutex    sync.RWMutex
 	hashMutex     sync.RWMutex
+	jobMutex      sync.Mutex
 }
 
 func NewUserHandler() *UserHandler {
 	return &UserHandler{
-		analysisCache: make(map[string]*analysis.Session),
+		analysisCache: make(map[string]*capture.Analysis),
+		options:       make(map[string]capture.Options),
 		fileHashes:    make(map[string]string),
+		jobs:          make(map[string]*analysisJob),
 	}
 }
 
@@ -57,23 +69,64 @@ func (h *UserHandler) HandleUpload(c echo.Context) error {
 		}))
 	}
 
-	// Validate file size
-	if file.Size > 100*1024*1024 {
-		log.Println("DEBUG: File too large:", file.Size)
+	dstPath, err := h.saveCapture(file)
+	if err != nil {
 		return render(c, home.UploadResponseTemplate(home.UploadResponse{
 			Status:  "error",
-			Message: "File size exceeds 100MB limit",
+			Message: err.Error(),
 		}))
 	}
 
+	// Save the optional TLS key log next to the capture
+	message := "File uploaded successfully"
+	if keyFile, err := c.FormFile("keylog"); err == nil {
+		sessions, err := saveKeyLog(keyFile, analysis.KeyLogPath(dstPath))
+		if err != nil {
+			log.Println("DEBUG: Failed to save key log:", err)
+			message = "File uploaded, but the key log was rejected: " + err.Error()
+		} else {
+			message = fmt.Sprintf("File uploaded successfully with TLS secrets for %d sessions", sessions)
+		}
+	}
+
+	// Trigger file list update
+	c.Response().Header().Set("HX-Trigger", "fileListUpdate")
+	return render(c, home.UploadResponseTemplate(home.UploadResponse{
+		Status:  "success",
+		Message: message,
+	}))
+}
+
+// captureError is a failure to store or remove a capture, with the message
+// shown to the user and the HTTP status the API answers with
+type captureError struct {
+	status  int
+	message string
+}
+
+func (e *captureError) Error() string {
+	return e.message
+}
+
+// saveCapture validates an uploaded capture and stores it in the uploads
+// directory, rejecting duplicates by MD5, and returns its path
+func (h *UserHandler) saveCapture(file *multipart.FileHeader) (string, error) {
+	// Names of key logs and packet indexes would be hidden from the list
+	if !isCaptureFile(filepath.Base(file.Filename)) {
+		return "", &captureError{http.StatusBadRequest, "Invalid file name"}
+	}
+
+	// Validate file size
+	if file.Size > 100*1024*1024 {
+		log.Println("DEBUG: File too large:", file.Size)
+		return "", &captureError{http.StatusRequestEntityTooLarge, "File size exceeds 100MB limit"}
+	}
+
 	// Open file
 	src, err := file.Open()
 	if err != nil {
 		log.Println("DEBUG: Failed to open file:", err)
-		return render(c, home.UploadResponseTemplate(home.UploadResponse{
-			Status:  "error",
-			Message: "Failed to read file",
-		}))
+		return "", &captureError{http.StatusInternalServerError, "Failed to read file"}
 	}
 	defer src.Close()
 
@@ -82,50 +135,35 @@ func (h *UserHandler) HandleUpload(c echo.Context) error {
 	_, err = src.Read(header)
 	if err != nil {
 		log.Println("DEBUG: Failed to read file header:", err)
-		return render(c, home.UploadResponseTemplate(home.UploadResponse{
-			Status:  "error",
-			Message: "Failed to read file header",
-		}))
+		return "", &captureError{http.StatusBadRequest, "Failed to read file header"}
 	}
 
 	// Validate PCAP-NG format
 	if !bytes.Equal(header[:4], []byte{0x0a, 0x0d, 0x0d, 0x0a}) || 
 	   !bytes.Equal(header[8:12], []byte{0x4d, 0x3c, 0x2b, 0x1a}) {
 		log.Println("DEBUG: Invalid PCAP-NG magic number")
-		return render(c, home.UploadResponseTemplate(home.UploadResponse{
-			Status:  "error",
-			Message: "Invalid file format. Expected a PCAP file.",
-		}))
+		return "", &captureError{http.StatusBadRequest, "Invalid file format. Expected a PCAP file."}
 	}
 
 	// Reset file pointer before saving
 	_, err = src.Seek(0, io.SeekStart)
 	if err != nil {
 		log.Println("DEBUG: Failed to reset file pointer:", err)
-		return render(c, home.UploadResponseTemplate(home.UploadResponse{
-			Status:  "error",
-			Message: "Failed to reset file pointer",
-		}))
+		return "", &captureError{http.StatusInternalServerError, "Failed to reset file pointer"}
 	}
 
 	// Create uploads directory
 	if err := os.MkdirAll("uploads", 0755); err != nil {
 		log.Println("DEBUG: Failed to create uploads directory:", err)
-		return render(c, home.UploadResponseTemplate(home.UploadResponse{
-			Status:  "error",
-			Message: "Failed to create uploads directory",
-		}))
+		return "", &captureError{http.StatusInternalServerError, "Failed to create uploads directory"}
 	}
 
 	// Compute MD5 hash and save the file
-	dstPath := filepath.Join("uploads", file.Filename)
+	dstPath := filepath.Join("uploads", filepath.Base(file.Filename))
 	dst, err := os.Create(dstPath)
 	if err != nil {
 		log.Println("DEBUG: Failed to create destination file:", err)
-		return render(c, home.UploadResponseTemplate(home.UploadResponse{
-			Status:  "error",
-			Message: "Failed to create destination file",
-		}))
+		return "", &captureError{http.StatusInternalServerError, "Failed to create destination file"}
 	}
 	defer dst.Close()
 
@@ -133,10 +171,7 @@ func (h *UserHandler) HandleUpload(c echo.Context) error {
 	if _, err = io.Copy(io.MultiWriter(dst, hash), src); err != nil {
 		os.Remove(dstPath) // Cleanup on error
 		log.Println("DEBUG: Failed to save file:", err)
-		return render(c, home.UploadResponseTemplate(home.UploadResponse{
-			Status:  "error",
-			Message: "Failed to save file",
-		}))
+		return "", &captureError{http.StatusInternalServerError, "Failed to save file"}
 	}
 
 	// Convert hash to string
@@ -147,22 +182,49 @@ func (h *UserHandler) HandleUpload(c echo.Context) error {
 	if existingFile, exists := h.fileHashes[hashStr]; exists {
 		h.hashMutex.RUnlock()
 		os.Remove(dstPath) // Remove duplicate file
-		return render(c, home.UploadResponseTemplate(home.UploadResponse{
-			Status:  "error",
-			Message: fmt.Sprintf("This file has already been uploaded as %s", filepath.Base(existingFile)),
-		}))
+		return "", &captureError{http.StatusConflict, fmt.Sprintf("This file has already been uploaded as %s", filepath.Base(existingFile))}
 	}
 	h.hashMutex.RUnlock()
 
+	// A key log or packet index left by an earlier capture of the same
+	// name does not belong to this one
+	if err := os.Remove(analysis.KeyLogPath(dstPath)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error deleting key log for %s: %v", dstPath, err)
+	}
+	if err := os.Remove(analysis.PacketIndexPath(dstPath)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error deleting packet index for %s: %v", dstPath, err)
+	}
+
 	// Save file hash
 	h.saveFileHash(hashStr, dstPath)
+	h.evictSession(file.Filename)
+	return dstPath, nil
+}
 
-	// Trigger file list update
-	c.Response().Header().Set("HX-Trigger", "fileListUpdate")
-	return render(c, home.UploadResponseTemplate(home.UploadResponse{
-		Status:  "success",
-		Message: "File uploaded successfully",
-	}))
+// saveKeyLog validates an uploaded SSLKEYLOGFILE and stores it at dstPath,
+// returning the number of sessions it holds secrets for
+func saveKeyLog(file *multipart.FileHeader, dstPath string) (int, error) {
+	src, err := file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, 10*1024*1024))
+	if err != nil {
+		return 0, err
+	}
+	keys, err := analysis.ParseKeyLog(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	if keys.Len() == 0 {
+		return 0, fmt.Errorf("no TLS secrets found")
+	}
+	if err := os.WriteFile(dstPath, data, 0600); err != nil {
+		return 0, err
+	}
+	return keys.Len(), nil
 }
 
 
@@ -173,13 +235,19 @@ func (h *UserHandler) HandleRefreshFiles(c echo.Context) error {
 	return render(c, home.FileListTemplate(files))
 }
 
+// isCaptureFile tells captures from the key logs and packet indexes kept
+// next to them in the uploads directory
+func isCaptureFile(name string) bool {
+	return !strings.HasSuffix(name, analysis.KeyLogPath("")) && !strings.HasSuffix(name, analysis.PacketIndexPath(""))
+}
+
 // getUploadedFiles returns a list of uploaded files with details
 func (h *UserHandler) getUploadedFiles() []home.UploadedFile {
 	files := []home.UploadedFile{}
 	entries, err := os.ReadDir("uploads")
 	if err == nil { // Don't fail if directory doesn't exist
 		for _, entry := range entries {
-			if !entry.IsDir() && (strings.HasSuffix(entry.Name(), ".pcap") || strings.HasSuffix(entry.Name(), ".pcapng")) {
+			if !entry.IsDir() && isCaptureFile(entry.Name()) {
 				info, err := entry.Info()
 				if err != nil {
 					continue
@@ -201,6 +269,113 @@ func (h *UserHandler) getUploadedFiles() []home.UploadedFile {
 	return files
 }
 
+// loadAnalysis analyses an uploaded capture, reusing the cached analysis if
+// the file has already been processed
+func (h *UserHandler) loadAnalysis(filename string) (*capture.Analysis, error) {
+	filename = filepath.Base(filename)
+
+	h.cacheMutex.Lock()
+	result, exists := h.analysisCache[filename]
+	opts := h.options[filename]
+	if exists {
+		h.touchCached(filename)
+	}
+	h.cacheMutex.Unlock()
+	if exists {
+		return result, nil
+	}
+
+	// Uploads keep their key log and packet index next to them
+	path := filepath.Join("uploads", filename)
+	opts.KeyLogFile = analysis.KeyLogPath(path)
+	opts.CacheDir = "uploads"
+	result, err := capture.Open(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range result.Warnings() {
+		log.Printf("%s: %v", filename, warning)
+	}
+
+	h.cacheMutex.Lock()
+	h.analysisCache[filename] = result
+	h.touchCached(filename)
+	var evicted []string
+	for len(h.cacheOrder) > maxCachedAnalyses {
+		evicted = append(evicted, h.cacheOrder[0])
+		delete(h.analysisCache, h.cacheOrder[0])
+		h.cacheOrder = h.cacheOrder[1:]
+	}
+	h.cacheMutex.Unlock()
+
+	// Evicted captures are analysed again when next asked for, so their
+	// finished jobs no longer apply
+	h.jobMutex.Lock()
+	for _, name := range evicted {
+		if job, exists := h.jobs[name]; exists && job.State == jobDone {
+			delete(h.jobs, name)
+		}
+	}
+	h.jobMutex.Unlock()
+
+	return result, nil
+}
+
+// touchCached marks a cached capture as the most recently used. Callers
+// hold cacheMutex.
+func (h *UserHandler) touchCached(filename string) {
+	h.dropCached(filename)
+	h.cacheOrder = append(h.cacheOrder, filename)
+}
+
+// dropCached removes a capture from the order of use. Callers hold
+// cacheMutex.
+func (h *UserHandler) dropCached(filename string) {
+	for i, name := range h.cacheOrder {
+		if name == filename {
+			h.cacheOrder = append(h.cacheOrder[:i], h.cacheOrder[i+1:]...)
+			return
+		}
+	}
+}
+
+// loadSession returns the session behind the analysis of an uploaded
+// capture, for the pages showing results the capture package does not have
+func (h *UserHandler) loadSession(filename string) (*analysis.Session, error) {
+	result, err := h.loadAnalysis(filename)
+	if err != nil {
+		return nil, err
+	}
+	return analysis.SessionOf(result), nil
+}
+
+// setAnalysisOptions chooses the analyzers and their options for a capture
+// and drops its analysis, so the next request analyses it again
+func (h *UserHandler) setAnalysisOptions(filename string, opts capture.Options) error {
+	if _, err := capture.New(opts); err != nil {
+		return err
+	}
+	h.evictSession(filename)
+	h.cacheMutex.Lock()
+	h.options[filepath.Base(filename)] = opts
+	h.cacheMutex.Unlock()
+	return nil
+}
+
+// evictSession drops a cached session after its capture changed or was
+// removed, along with the analyzers chosen for it
+func (h *UserHandler) evictSession(filename string) {
+	h.cacheMutex.Lock()
+	delete(h.analysisCache, filepath.Base(filename))
+	h.dropCached(filepath.Base(filename))
+	delete(h.options, filepath.Base(filename))
+	h.cacheMutex.Unlock()
+
+	h.jobMutex.Lock()
+	delete(h.jobs, filepath.Base(filename))
+	h.jobMutex.Unlock()
+}
+
 func (h *UserHandler) HandleOverview(c echo.Context) error {
 	filename := c.Param("filename")
 	if filename == "" {
@@ -214,17 +389,11 @@ func (h *UserHandler) HandleOverview(c echo.Context) error {
 	}
 
 	// Process file and create session if needed
-	filePath := "uploads/" + filename
-	packets, err := analysis.ExtractPackets(filePath)
+	session, err := h.loadSession(filename)
 	if err != nil {
 		return render(c, home.ErrorTemplate("Error processing PCAP file"))
 	}
 
-	session := analysis.NewSession()
-	for _, packet := range packets {
-		session.Process(packet)
-	}
-
 	viewData := overview.ViewData{
 		Filename:      filename,
 		TrafficStats:  session.TrafficStats(),
@@ -232,11 +401,52 @@ func (h *UserHandler) HandleOverview(c echo.Context) error {
 		Conversations: session.Conversations().Top(5),
 		NetworkNodes:  session.NetworkMap().GetActiveNodes(),
 		DNSQueries:    session.DNS().TopQueries(5),
+		DNS: overview.DNSSummary{
+			Stats:         session.DNS().GetStats(),
+			Types:         session.DNS().TypeDistribution(),
+			ResponseCodes: session.DNS().ResponseCodeDistribution(),
+			EDNSOptions:   session.DNS().EDNSOptionDistribution(),
+			Answers:       session.DNS().TopAnswers(20),
+			Resolvers:     session.DNS().ResolverStats(),
+			Slowest:       session.DNS().SlowestLookups(10),
+			Failing:       session.DNS().FailingLookups(20),
+			Threats:       session.DNSThreats().Findings(),
+		},
+		Streams:       session.Streams(),
+		HTTP:          httpSummary(session.HTTP()),
+		TLS: overview.TLSSummary{
+			Handshakes: session.TLS().GetSessions(),
+			SNIs:       session.TLS().TopSNIs(5),
+			JA3:        session.TLS().TopJA3(5),
+			JA4:        session.TLS().TopJA4(5),
+			Versions:   session.TLS().VersionDistribution(),
+		},
+		Names: session.Names().Map(),
 	}
 
 	return render(c, overview.Show(viewData))
 }
 
+// httpSummary gathers the HTTP tables shown on the overview page
+func httpSummary(analyzer *analysis.HTTPAnalyzer) overview.HTTPSummary {
+	transactions := analyzer.GetTransactions()
+	clientErrors, serverErrors := analyzer.ErrorRates()
+
+	summary := overview.HTTPSummary{
+		Hosts:           analyzer.TopHosts(5),
+		URIs:            analyzer.TopURIs(5),
+		UserAgents:      analyzer.TopUserAgents(5),
+		TotalRequests:   len(transactions),
+		ClientErrorRate: clientErrors,
+		ServerErrorRate: serverErrors,
+	}
+	if len(transactions) > 20 {
+		transactions = transactions[:20]
+	}
+	summary.Transactions = transactions
+	return summary
+}
+
 func (h *UserHandler) HandleAnalytics(c echo.Context) error {
 	filename := c.Param("filename")
 	if filename == "" {
@@ -250,22 +460,18 @@ func (h *UserHandler) HandleAnalytics(c echo.Context) error {
 	}
 
 	// Process file and create session
-	filePath := "uploads/" + filename
-	packets, err := analysis.ExtractPackets(filePath)
+	session, err := h.loadSession(filename)
 	if err != nil {
 		return render(c, home.ErrorTemplate("Error processing PCAP file"))
 	}
 
-	session := analysis.NewSession()
-	for _, packet := range packets {
-		session.Process(packet)
-	}
-
 	viewData := overview.ViewData{
 		Filename:      filename,
 		TrafficStats:  session.TrafficStats(),
 		TopProtocols:  session.Protocols().Top(10),
 		Conversations: session.Conversations().Top(10),
+		Streams:       session.Streams(),
+		Names:         session.Names().Map(),
 	}
 
 	return render(c, overview.Show(viewData))
@@ -304,25 +510,47 @@ func (h *UserHandler) HandleDeleteFile(c echo.Context) error {
 		return render(c, home.ErrorTemplate("No filename provided"))
 	}
 
+	if err := h.deleteCapture(filename); err != nil {
+		return render(c, home.ErrorTemplate(err.Error()))
+	}
+
+	// Return the updated file list template
+	files := h.getUploadedFiles()
+	return render(c, home.FileListTemplate(files))
+}
+
+// deleteCapture removes an uploaded capture with the files kept beside it
+// and forgets its analysis
+func (h *UserHandler) deleteCapture(filename string) error {
 	// Ensure the filename is safe and within the uploads directory
 	filePath := filepath.Join("uploads", filepath.Base(filename))
 
 	// Check if file exists
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		log.Printf("File not found for deletion: %s", filePath)
-		return render(c, home.ErrorTemplate("File not found"))
+		return &captureError{http.StatusNotFound, "File not found"}
 	}
 
 	// Delete the file
 	if err := os.Remove(filePath); err != nil {
 		log.Printf("Error deleting file %s: %v", filePath, err)
-		return render(c, home.ErrorTemplate("Failed to delete file"))
+		return &captureError{http.StatusInternalServerError, "Failed to delete file"}
+	}
+
+	// Remove the TLS key log uploaded with it, if any
+	if err := os.Remove(analysis.KeyLogPath(filePath)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error deleting key log for %s: %v", filePath, err)
+	}
+	if err := os.Remove(analysis.PacketIndexPath(filePath)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error deleting packet index for %s: %v", filePath, err)
 	}
 
+	h.evictSession(filename)
+
 	// If we have a hash for this file, remove it from our hash map
 	h.hashMutex.Lock()
 	for hash, fname := range h.fileHashes {
-		if fname == filename {
+		if fname == filePath {
 			delete(h.fileHashes, hash)
 			break
 		}
@@ -330,10 +558,7 @@ func (h *UserHandler) HandleDeleteFile(c echo.Context) error {
 	h.hashMutex.Unlock()
 
 	log.Printf("Successfully deleted file: %s", filePath)
-
-	// Return the updated file list template
-	files := h.getUploadedFiles()
-	return render(c, home.FileListTemplate(files))
+	return nil
 }
 
 // saveFileHash saves the hash to filename mapping
@@ -355,7 +580,7 @@ func (h *UserHandler) ProtocolChart(c echo.Context) error {
 	}
 
 	c.Response().Header().Set(echo.HeaderContentType, "image/svg+xml")
-	return session.ProtocolChart().Render(c.Response().Writer)
+	return analysis.SessionOf(session).ProtocolChart().Render(c.Response().Writer)
 }
 
 func (h *UserHandler) TrafficTimeline(c echo.Context) error {
@@ -370,7 +595,7 @@ func (h *UserHandler) TrafficTimeline(c echo.Context) error {
 	}
 
 	c.Response().Header().Set(echo.HeaderContentType, "image/svg+xml")
-	return session.TrafficTimeline().Render(c.Response().Writer)
+	return analysis.SessionOf(session).TrafficTimeline().Render(c.Response().Writer)
 }
 
 func (h *UserHandler) HandlePropertiesIndex(c echo.Context) error {
@@ -383,7 +608,7 @@ func (h *UserHandler) HandlePropertiesIndex(c echo.Context) error {
 	// Extract filenames
 	var filenames []string
 	for _, file := range files {
-		if !file.IsDir() {
+		if !file.IsDir() && isCaptureFile(file.Name()) {
 			filenames = append(filenames, file.Name())
 		}
 	}
@@ -442,7 +667,7 @@ func (h *UserHandler) HandleProperties(c echo.Context) error {
 	// Extract filenames
 	var filenames []string
 	for _, file := range files {
-		if !file.IsDir() {
+		if !file.IsDir() && isCaptureFile(file.Name()) {
 			filenames = append(filenames, file.Name())
 		}
 	}
@@ -474,6 +699,14 @@ func (h *UserHandler) HandleGeoIP(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process PCAP: " + err.Error()})
 	}
 
+	// Label addresses with the names they were seen with
+	if session, err := h.loadSession(filename); err == nil {
+		names := session.Names().Map()
+		for i := range geoData {
+			geoData[i].Hostname = names[geoData[i].IP]
+		}
+	}
+
 	// Return the geolocation data as JSON
 	return c.JSON(http.StatusOK, geoData)
 }
@@ -0,0 +1,312 @@
+package analysis
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"github.com/shreethaar/heroPacket/internal/models"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const tlsCertificate = 11
+
+// CertificateInfo describes one X.509 certificate seen in TLS handshakes,
+// together with every server that presented it.
+type CertificateInfo struct {
+	SHA256             string
+	SHA1               string
+	Subject            string
+	Issuer             string
+	SANs               []string
+	NotBefore          time.Time
+	NotAfter           time.Time
+	KeyType            string
+	KeySize            int
+	SignatureAlgorithm string
+	SelfSigned         bool
+	Expired            bool // Outside its validity period when any server presented it
+	WeakKey            bool
+	HostnameMismatch   bool // Leaf certificate does not cover the SNI
+	Servers            []CertificateServer
+	Raw                []byte
+}
+
+// CertificateServer records a server presenting a certificate.
+type CertificateServer struct {
+	IP          string
+	Port        uint16
+	SNI         string
+	StreamIndex int
+	ChainIndex  int  // 0 for the leaf certificate
+	Packet      int  // First packet of the server's handshake
+	Expired     bool // Outside the validity period when the stream started
+}
+
+// outsideValidity reports whether a certificate valid from notBefore to
+// notAfter was not valid at t
+func outsideValidity(t, notBefore, notAfter time.Time) bool {
+	return t.After(notAfter) || t.Before(notBefore)
+}
+
+type CertificateAnalyzer struct {
+	mu           sync.Mutex
+	Certificates map[string]*CertificateInfo // SHA256 fingerprint -> certificate
+}
+
+func NewCertificateAnalyzer() *CertificateAnalyzer {
+	return &CertificateAnalyzer{
+		Certificates: make(map[string]*CertificateInfo),
+	}
+}
+
+// Process is a no-op: certificate chains span several segments, so they
+// are parsed from reassembled streams in ProcessStream instead.
+func (a *CertificateAnalyzer) Process(packet models.Packet) {
+}
+
+// ProcessStream extracts the chain from the Certificate message. Only TLS
+// 1.2 and earlier send it in the clear.
+func (a *CertificateAnalyzer) ProcessStream(stream *Stream) {
+	if stream.Protocol != "TCP" {
+		return
+	}
+	client := stream.Data(ClientToServer)
+	if !looksLikeTLS(client) {
+		return
+	}
+
+	hello := &TLSSession{}
+	for _, msg := range tlsHandshakeMessages(client) {
+		if msg.Type == tlsClientHello {
+			parseClientHello(msg.Body, hello)
+			break
+		}
+	}
+
+	for _, msg := range tlsHandshakeMessages(stream.Data(ServerToClient)) {
+		if msg.Type != tlsCertificate {
+			continue
+		}
+		for i, der := range parseCertificateChain(msg.Body) {
+			a.add(der, stream, hello.SNI, i)
+		}
+		return
+	}
+}
+
+func parseCertificateChain(body []byte) [][]byte {
+	if len(body) < 3 {
+		return nil
+	}
+	total := int(body[0])<<16 | int(body[1])<<8 | int(body[2])
+	data := body[3:]
+	if total < len(data) {
+		data = data[:total]
+	}
+
+	var chain [][]byte
+	for len(data) >= 3 {
+		length := int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+		if len(data) < 3+length {
+			break
+		}
+		chain = append(chain, data[3:3+length])
+		data = data[3+length:]
+	}
+	return chain
+}
+
+func (a *CertificateAnalyzer) add(der []byte, stream *Stream, sni string, chainIndex int) {
+	sum := sha256.Sum256(der)
+	fingerprint := hex.EncodeToString(sum[:])
+	server := CertificateServer{
+		IP:          stream.ServerIP,
+		Port:        stream.ServerPort,
+		SNI:         sni,
+		StreamIndex: stream.Index,
+		ChainIndex:  chainIndex,
+		Packet:      stream.PacketAt(ServerToClient, 0),
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if info, exists := a.Certificates[fingerprint]; exists {
+		server.Expired = outsideValidity(stream.StartTime, info.NotBefore, info.NotAfter)
+		info.Expired = info.Expired || server.Expired
+		info.Servers = append(info.Servers, server)
+		if chainIndex == 0 && sni != "" && !info.HostnameMismatch {
+			info.HostnameMismatch = hostnameMismatch(info.Raw, sni)
+		}
+		return
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return
+	}
+
+	server.Expired = outsideValidity(stream.StartTime, cert.NotBefore, cert.NotAfter)
+	sha1Sum := sha1.Sum(der)
+	info := &CertificateInfo{
+		SHA256:             fingerprint,
+		SHA1:               hex.EncodeToString(sha1Sum[:]),
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		Expired:            server.Expired,
+		Servers:            []CertificateServer{server},
+		Raw:                append([]byte(nil), der...),
+	}
+	info.SANs = append(info.SANs, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+	info.SANs = append(info.SANs, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		info.SANs = append(info.SANs, uri.String())
+	}
+
+	info.KeyType, info.KeySize = publicKeyInfo(cert)
+	info.SelfSigned = bytes.Equal(cert.RawSubject, cert.RawIssuer) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+	info.WeakKey = weakKey(info.KeyType, info.KeySize) || weakSignature(cert.SignatureAlgorithm)
+	if chainIndex == 0 && sni != "" {
+		info.HostnameMismatch = cert.VerifyHostname(sni) != nil
+	}
+
+	a.Certificates[fingerprint] = info
+}
+
+func hostnameMismatch(der []byte, sni string) bool {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return false
+	}
+	return cert.VerifyHostname(sni) != nil
+}
+
+func publicKeyInfo(cert *x509.Certificate) (string, int) {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "Ed25519", 256
+	case *dsa.PublicKey:
+		return "DSA", key.P.BitLen()
+	}
+	return cert.PublicKeyAlgorithm.String(), 0
+}
+
+func weakKey(keyType string, size int) bool {
+	switch keyType {
+	case "RSA", "DSA":
+		return size < 2048
+	case "ECDSA":
+		return size < 224
+	}
+	return false
+}
+
+func weakSignature(algorithm x509.SignatureAlgorithm) bool {
+	switch algorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		return true
+	}
+	return false
+}
+
+// GetCertificates returns every certificate, leaf certificates first and
+// then by subject.
+func (a *CertificateAnalyzer) GetCertificates() []*CertificateInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	certs := make([]*CertificateInfo, 0, len(a.Certificates))
+	for _, cert := range a.Certificates {
+		certs = append(certs, cert)
+	}
+	sort.Slice(certs, func(i, j int) bool {
+		li, lj := certs[i].isLeaf(), certs[j].isLeaf()
+		if li != lj {
+			return li
+		}
+		return certs[i].Subject < certs[j].Subject
+	})
+	return certs
+}
+
+// Get returns the certificate with the given SHA256 fingerprint.
+func (a *CertificateAnalyzer) Get(fingerprint string) *CertificateInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.Certificates[fingerprint]
+}
+
+func (c *CertificateInfo) isLeaf() bool {
+	for _, server := range c.Servers {
+		if server.ChainIndex == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// PEM returns the certificate in PEM encoding.
+func (c *CertificateInfo) PEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+}
+
+// ExpertItems reports each problem with a certificate once per server that
+// presented it. Self-signed certificates only count as leaves, since every
+// root is self-signed.
+func (a *CertificateAnalyzer) ExpertItems() []ExpertItem {
+	var items []ExpertItem
+	for _, cert := range a.GetCertificates() {
+		for _, server := range cert.Servers {
+			report := func(severity, summary string) {
+				detail := cert.Subject + " from " + net.JoinHostPort(server.IP, strconv.Itoa(int(server.Port)))
+				if server.SNI != "" {
+					detail += " (" + server.SNI + ")"
+				}
+				items = append(items, ExpertItem{
+					Severity: severity,
+					Group:    ExpertSecurity,
+					Protocol: "TLS",
+					Summary:  summary,
+					Detail:   detail,
+					Packet:   server.Packet,
+				})
+			}
+			if server.Expired {
+				report(ExpertWarn, "Certificate expired or not yet valid")
+			}
+			if cert.WeakKey {
+				report(ExpertWarn, "Weak certificate key")
+			}
+			if cert.HostnameMismatch && server.ChainIndex == 0 {
+				report(ExpertWarn, "Certificate does not match the server name")
+			}
+			if cert.SelfSigned && server.ChainIndex == 0 {
+				report(ExpertNote, "Self-signed certificate")
+			}
+		}
+	}
+	return items
+}
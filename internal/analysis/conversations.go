@@ -1,8 +1,34 @@
 package analysis
 
 import (
-    "heroPacket/internal/models"
+    "github.com/shreethaar/heroPacket/internal/models"
+    "net"
+    "sort"
+    "strconv"
+    "strings"
     "sync"
+    "time"
+)
+
+// Conversation types, one per table on the Conversations page
+const (
+    ConversationEthernet = "Ethernet"
+    ConversationIPv4     = "IPv4"
+    ConversationIPv6     = "IPv6"
+    ConversationTCP      = "TCP"
+    ConversationUDP      = "UDP"
+)
+
+var ConversationTypes = []string{ConversationEthernet, ConversationIPv4, ConversationIPv6, ConversationTCP, ConversationUDP}
+
+// TCP connection states, as far as they can be told from the capture
+const (
+    TCPStateSynSent     = "SYN_SENT"
+    TCPStateSynReceived = "SYN_RECEIVED"
+    TCPStateEstablished = "ESTABLISHED"
+    TCPStateClosing     = "CLOSING" // One side has sent FIN
+    TCPStateClosed      = "CLOSED"
+    TCPStateReset       = "RESET"
 )
 
 type ConversationTracker struct {
@@ -10,12 +36,30 @@ type ConversationTracker struct {
     Conversations map[string]*Conversation
 }
 
+// Conversation is the traffic between two endpoints in both directions.
+// Side A is the endpoint that sent the first packet, or the side that sent
+// the SYN for TCP.
 type Conversation struct {
+    Type        string
+    SourceMAC   string // Ethernet conversations only
+    DestMAC     string
     SourceIP    string
     DestIP      string
-    Protocol    string
+    SourcePort  uint16 // TCP and UDP conversations only
+    DestPort    uint16
+    Protocol    string // Transport protocol, or the type for link and IP conversations
     PacketCount int
     TotalBytes  int
+    PacketsAB   int
+    BytesAB     int
+    PacketsBA   int
+    BytesBA     int
+    FirstSeen   time.Time
+    LastSeen    time.Time
+    State       string      // TCP conversations only
+    TLS         *TLSSession // Most recent TLS handshake, if any
+
+    finA, finB bool
 }
 
 func NewConversationTracker() *ConversationTracker {
@@ -24,26 +68,291 @@ func NewConversationTracker() *ConversationTracker {
     }
 }
 
+// Process adds a packet to its Ethernet, IP and transport conversations
 func (c *ConversationTracker) Process(packet models.Packet) {
-    key := conversationKey(packet)
-    
     c.mu.Lock()
     defer c.mu.Unlock()
-    
-    if conv, exists := c.Conversations[key]; exists {
-        conv.PacketCount++
-        conv.TotalBytes += packet.Length
+
+    if packet.SourceMAC != "" && packet.DestMAC != "" {
+        conv := c.conversation(ConversationEthernet, packet.SourceMAC, packet.DestMAC, packet)
+        if conv.PacketCount == 0 {
+            conv.SourceMAC, conv.DestMAC = packet.SourceMAC, packet.DestMAC
+        }
+        conv.add(packet, packet.SourceMAC == conv.SourceMAC)
+    }
+
+    if packet.SourceIP == "" || packet.DestIP == "" {
+        return
+    }
+    ipType := ConversationIPv4
+    if ip := net.ParseIP(packet.SourceIP); ip != nil && ip.To4() == nil {
+        ipType = ConversationIPv6
+    }
+    conv := c.conversation(ipType, packet.SourceIP, packet.DestIP, packet)
+    if conv.PacketCount == 0 {
+        conv.SourceIP, conv.DestIP = packet.SourceIP, packet.DestIP
+    }
+    conv.add(packet, packet.SourceIP == conv.SourceIP)
+
+    if packet.Protocol != ConversationTCP && packet.Protocol != ConversationUDP {
+        return
+    }
+    src := net.JoinHostPort(packet.SourceIP, strconv.Itoa(int(packet.SourcePort)))
+    dst := net.JoinHostPort(packet.DestIP, strconv.Itoa(int(packet.DestPort)))
+    conv = c.conversation(packet.Protocol, src, dst, packet)
+    if conv.PacketCount == 0 {
+        conv.SourceIP, conv.SourcePort = packet.SourceIP, packet.SourcePort
+        conv.DestIP, conv.DestPort = packet.DestIP, packet.DestPort
+        // A SYN/ACK seen before the SYN means the sender is the server
+        if packet.TCP != nil && packet.TCP.SYN && packet.TCP.ACK {
+            conv.SourceIP, conv.DestIP = conv.DestIP, conv.SourceIP
+            conv.SourcePort, conv.DestPort = conv.DestPort, conv.SourcePort
+        }
+    }
+    fromA := packet.SourceIP == conv.SourceIP && packet.SourcePort == conv.SourcePort
+    conv.add(packet, fromA)
+    if packet.TCP != nil {
+        conv.updateState(packet.TCP, fromA)
+    }
+}
+
+// conversation finds or creates the conversation between endpoints a and b
+// regardless of direction
+func (c *ConversationTracker) conversation(kind, a, b string, packet models.Packet) *Conversation {
+    key := conversationKey(kind, a, b)
+    conv, exists := c.Conversations[key]
+    if !exists {
+        conv = &Conversation{
+            Type:      kind,
+            Protocol:  kind,
+            FirstSeen: packet.Timestamp,
+        }
+        c.Conversations[key] = conv
+    }
+    return conv
+}
+
+func (conv *Conversation) add(packet models.Packet, fromA bool) {
+    length := packet.FrameLength
+    conv.PacketCount++
+    conv.TotalBytes += length
+    if fromA {
+        conv.PacketsAB++
+        conv.BytesAB += length
     } else {
-        c.Conversations[key] = &Conversation{
-            SourceIP:    packet.SourceIP,
-            DestIP:      packet.DestIP,
-            Protocol:    packet.Protocol,
-            PacketCount: 1,
-            TotalBytes:  packet.Length,
+        conv.PacketsBA++
+        conv.BytesBA += length
+    }
+    if packet.Timestamp.Before(conv.FirstSeen) {
+        conv.FirstSeen = packet.Timestamp
+    }
+    if packet.Timestamp.After(conv.LastSeen) {
+        conv.LastSeen = packet.Timestamp
+    }
+}
+
+func (conv *Conversation) updateState(tcp *models.TCPInfo, fromA bool) {
+    switch {
+    case tcp.RST:
+        conv.State = TCPStateReset
+        return
+    case conv.State == TCPStateReset || conv.State == TCPStateClosed:
+        return
+    case tcp.SYN && !tcp.ACK:
+        conv.State = TCPStateSynSent
+    case tcp.SYN && tcp.ACK:
+        conv.State = TCPStateSynReceived
+    case conv.State == "" || conv.State == TCPStateSynReceived:
+        // Joined mid-connection, or the ACK completing the handshake
+        conv.State = TCPStateEstablished
+    }
+
+    if tcp.FIN {
+        if fromA {
+            conv.finA = true
+        } else {
+            conv.finB = true
         }
+        conv.State = TCPStateClosing
+        if conv.finA && conv.finB {
+            conv.State = TCPStateClosed
+        }
+    }
+}
+
+// Duration is the time between the first and last packet
+func (conv *Conversation) Duration() time.Duration {
+    return conv.LastSeen.Sub(conv.FirstSeen)
+}
+
+// Throughput is in bits per second over the conversation's duration. A
+// conversation of a single instant has no meaningful rate and returns zero.
+func (conv *Conversation) Throughput() float64 {
+    seconds := conv.Duration().Seconds()
+    if seconds <= 0 {
+        return 0
+    }
+    return float64(conv.TotalBytes) * 8 / seconds
+}
+
+// AddressA formats side A as a MAC, IP or IP and port depending on the type
+func (conv *Conversation) AddressA() string {
+    return conv.address(conv.SourceMAC, conv.SourceIP, conv.SourcePort)
+}
+
+// AddressB formats side B as a MAC, IP or IP and port depending on the type
+func (conv *Conversation) AddressB() string {
+    return conv.address(conv.DestMAC, conv.DestIP, conv.DestPort)
+}
+
+func (conv *Conversation) address(mac, ip string, port uint16) string {
+    switch conv.Type {
+    case ConversationEthernet:
+        return mac
+    case ConversationTCP, ConversationUDP:
+        return net.JoinHostPort(ip, strconv.Itoa(int(port)))
     }
+    return ip
 }
 
-func conversationKey(packet models.Packet) string {
-    return packet.SourceIP + ":" + packet.DestIP + ":" + packet.Protocol
+// Key identifies the conversation regardless of direction, e.g. in export
+// URLs
+func (conv *Conversation) Key() string {
+    return conversationKey(conv.Type, conv.AddressA(), conv.AddressB())
 }
+
+func conversationKey(kind, a, b string) string {
+    if b < a {
+        a, b = b, a
+    }
+    return kind + "|" + a + "|" + b
+}
+
+// InConversation reports whether a packet belongs to the conversation with
+// the given key
+func InConversation(key string, packet models.Packet) bool {
+    kind := key
+    if i := strings.Index(key, "|"); i >= 0 {
+        kind = key[:i]
+    }
+
+    var a, b string
+    switch kind {
+    case ConversationEthernet:
+        a, b = packet.SourceMAC, packet.DestMAC
+    case ConversationIPv4, ConversationIPv6:
+        a, b = packet.SourceIP, packet.DestIP
+    case ConversationTCP, ConversationUDP:
+        if packet.Protocol != kind {
+            return false
+        }
+        a = net.JoinHostPort(packet.SourceIP, strconv.Itoa(int(packet.SourcePort)))
+        b = net.JoinHostPort(packet.DestIP, strconv.Itoa(int(packet.DestPort)))
+    }
+    return a != "" && b != "" && conversationKey(kind, a, b) == key
+}
+
+// AttachTLS records a TLS handshake on the conversation it was seen in
+func (c *ConversationTracker) AttachTLS(session *TLSSession) {
+    a := net.JoinHostPort(session.ClientIP, strconv.Itoa(int(session.ClientPort)))
+    b := net.JoinHostPort(session.ServerIP, strconv.Itoa(int(session.ServerPort)))
+    key := conversationKey(ConversationTCP, a, b)
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    if conv, exists := c.Conversations[key]; exists {
+        conv.TLS = session
+    }
+}
+
+// Columns the conversation tables can be sorted by
+var conversationSorts = map[string]func(a, b *Conversation) bool{
+    "a":          func(a, b *Conversation) bool { return compareAddresses(a.AddressA(), b.AddressA()) < 0 },
+    "b":          func(a, b *Conversation) bool { return compareAddresses(a.AddressB(), b.AddressB()) < 0 },
+    "packets":    func(a, b *Conversation) bool { return a.PacketCount < b.PacketCount },
+    "bytes":      func(a, b *Conversation) bool { return a.TotalBytes < b.TotalBytes },
+    "packets_ab": func(a, b *Conversation) bool { return a.PacketsAB < b.PacketsAB },
+    "bytes_ab":   func(a, b *Conversation) bool { return a.BytesAB < b.BytesAB },
+    "packets_ba": func(a, b *Conversation) bool { return a.PacketsBA < b.PacketsBA },
+    "bytes_ba":   func(a, b *Conversation) bool { return a.BytesBA < b.BytesBA },
+    "start":      func(a, b *Conversation) bool { return a.FirstSeen.Before(b.FirstSeen) },
+    "duration":   func(a, b *Conversation) bool { return a.Duration() < b.Duration() },
+    "throughput": func(a, b *Conversation) bool { return a.Throughput() < b.Throughput() },
+    "state":      func(a, b *Conversation) bool { return a.State < b.State },
+}
+
+// ValidConversationSort reports whether key names a sortable column
+func ValidConversationSort(key string) bool {
+    _, ok := conversationSorts[key]
+    return ok
+}
+
+// List returns one page of the conversations of a type, sorted by the given
+// column, along with the number of conversations of that type. Unknown
+// columns sort by bytes.
+func (c *ConversationTracker) List(kind, sortBy string, desc bool, offset, limit int) ([]*Conversation, int) {
+    c.mu.Lock()
+    var conversations []*Conversation
+    for _, conv := range c.Conversations {
+        if conv.Type == kind {
+            conversations = append(conversations, conv)
+        }
+    }
+    c.mu.Unlock()
+
+    less, ok := conversationSorts[sortBy]
+    if !ok {
+        less = conversationSorts["bytes"]
+    }
+    // Ties fall back to address order so pages are stable
+    sort.Slice(conversations, func(i, j int) bool {
+        a, b := conversations[i], conversations[j]
+        if less(a, b) != less(b, a) {
+            return less(a, b) != desc
+        }
+        if a.AddressA() != b.AddressA() {
+            return compareAddresses(a.AddressA(), b.AddressA()) < 0
+        }
+        return compareAddresses(a.AddressB(), b.AddressB()) < 0
+    })
+
+    total := len(conversations)
+    if offset > total {
+        offset = total
+    }
+    end := total
+    if limit > 0 && offset+limit < total {
+        end = offset + limit
+    }
+    return conversations[offset:end], total
+}
+
+// Count returns the number of conversations of each type
+func (c *ConversationTracker) Count() map[string]int {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    counts := make(map[string]int)
+    for _, conv := range c.Conversations {
+        counts[conv.Type]++
+    }
+    return counts
+}
+
+// compareAddresses orders IPs numerically, then by port, and anything else
+// as text
+func compareAddresses(a, b string) int {
+    hostA, portA, errA := net.SplitHostPort(a)
+    hostB, portB, errB := net.SplitHostPort(b)
+    if errA != nil || errB != nil {
+        return compareIPs(a, b)
+    }
+    if cmp := compareIPs(hostA, hostB); cmp != 0 {
+        return cmp
+    }
+    pA, _ := strconv.Atoi(portA)
+    pB, _ := strconv.Atoi(portB)
+    return pA - pB
+}
+
@@ -0,0 +1,415 @@
+package analysis
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const maxFieldValue = 120 // Characters shown of a long field value
+
+// DissectionField is a node of the dissection tree: a layer, or a field of
+// one, with the bytes of the frame it was decoded from.
+type DissectionField struct {
+	Name     string
+	Value    string
+	Offset   int // Into the frame
+	Length   int
+	Children []*DissectionField
+}
+
+// Dissection is one packet decoded layer by layer.
+type Dissection struct {
+	Number int
+	Info   gopacket.CaptureInfo
+	Data   []byte
+	Layers []*DissectionField
+}
+
+// Dissect builds the dissection tree of a packet. Fields whose position is
+// not known exactly cover the bytes of their layer.
+func Dissect(number int, packet gopacket.Packet) *Dissection {
+	data := packet.Data()
+	ci := packet.Metadata().CaptureInfo
+	d := &Dissection{Number: number, Info: ci, Data: data}
+
+	frame := &DissectionField{
+		Name:   fmt.Sprintf("Frame %d", number),
+		Value:  fmt.Sprintf("%d bytes on wire, %d bytes captured", ci.Length, ci.CaptureLength),
+		Length: len(data),
+		Children: []*DissectionField{
+			{Name: "Arrival time", Value: ci.Timestamp.Format("2006-01-02 15:04:05.000000000 MST")},
+			{Name: "Frame length", Value: fmt.Sprintf("%d bytes", ci.Length)},
+			{Name: "Capture length", Value: fmt.Sprintf("%d bytes", ci.CaptureLength)},
+			{Name: "Protocols", Value: strings.Join(protocolStack(packet), ":")},
+		},
+	}
+	d.Layers = append(d.Layers, frame)
+
+	offset := 0
+	var sport, dport uint16
+	for _, layer := range packet.Layers() {
+		contents := layer.LayerContents()
+		node := &DissectionField{Name: layer.LayerType().String(), Offset: offset, Length: len(contents)}
+
+		switch l := layer.(type) {
+		case *layers.TCP:
+			sport, dport = uint16(l.SrcPort), uint16(l.DstPort)
+		case *layers.UDP:
+			sport, dport = uint16(l.SrcPort), uint16(l.DstPort)
+		case *gopacket.DecodeFailure:
+			node.Name = "Malformed"
+			node.Value = l.Error().Error()
+		case *gopacket.Payload:
+			node.Name = "Data"
+			if name := payloadProtocol(contents, sport, dport); name != "" && name != "Data" {
+				node.Name = name
+			}
+			node.Value = fmt.Sprintf("%d bytes", len(contents))
+		}
+		if node.Value == "" {
+			node.Value = layerSummary(layer)
+		}
+		node.Children = layerFields(layer, offset)
+		d.Layers = append(d.Layers, node)
+		offset += len(contents)
+	}
+
+	for _, node := range d.Layers {
+		node.place(0, len(data), len(data))
+	}
+	return d
+}
+
+// place clamps a field to the captured bytes and gives fields without a
+// position the bytes of their parent
+func (f *DissectionField) place(parentOffset, parentLength, size int) {
+	if f.Length == 0 {
+		f.Offset, f.Length = parentOffset, parentLength
+	}
+	if f.Offset > size {
+		f.Offset = size
+	}
+	if f.Offset+f.Length > size {
+		f.Length = size - f.Offset
+	}
+	for _, child := range f.Children {
+		child.place(f.Offset, f.Length, size)
+	}
+}
+
+// field makes a field at offset and length within a layer starting at base
+func field(base, offset, length int, name string, format string, args ...interface{}) *DissectionField {
+	return &DissectionField{Name: name, Value: fmt.Sprintf(format, args...), Offset: base + offset, Length: length}
+}
+
+func layerFields(layer gopacket.Layer, base int) []*DissectionField {
+	switch l := layer.(type) {
+	case *layers.Ethernet:
+		return []*DissectionField{
+			field(base, 0, 6, "Destination", "%s (%s)", l.DstMAC, vendorOrUnknown(l.DstMAC.String())),
+			field(base, 6, 6, "Source", "%s (%s)", l.SrcMAC, vendorOrUnknown(l.SrcMAC.String())),
+			field(base, 12, 2, "Type", "%s (0x%04x)", l.EthernetType, uint16(l.EthernetType)),
+		}
+	case *layers.Dot1Q:
+		return []*DissectionField{
+			field(base, 0, 2, "Priority", "%d", l.Priority),
+			field(base, 0, 2, "Drop eligible", "%t", l.DropEligible),
+			field(base, 0, 2, "VLAN ID", "%d", l.VLANIdentifier),
+			field(base, 2, 2, "Type", "%s (0x%04x)", l.Type, uint16(l.Type)),
+		}
+	case *layers.ARP:
+		hw, proto := int(l.HwAddressSize), int(l.ProtAddressSize)
+		return []*DissectionField{
+			field(base, 0, 2, "Hardware type", "%s", l.AddrType),
+			field(base, 2, 2, "Protocol type", "%s", l.Protocol),
+			field(base, 4, 1, "Hardware size", "%d", l.HwAddressSize),
+			field(base, 5, 1, "Protocol size", "%d", l.ProtAddressSize),
+			field(base, 6, 2, "Opcode", "%s", arpOperation(l.Operation)),
+			field(base, 8, hw, "Sender MAC address", "%s", macString(l.SourceHwAddress)),
+			field(base, 8+hw, proto, "Sender IP address", "%s", ipString(l.SourceProtAddress)),
+			field(base, 8+hw+proto, hw, "Target MAC address", "%s", macString(l.DstHwAddress)),
+			field(base, 8+2*hw+proto, proto, "Target IP address", "%s", ipString(l.DstProtAddress)),
+		}
+	case *layers.IPv4:
+		fields := []*DissectionField{
+			field(base, 0, 1, "Version", "%d", l.Version),
+			field(base, 0, 1, "Header length", "%d bytes", int(l.IHL)*4),
+			field(base, 1, 1, "Type of service", "0x%02x", l.TOS),
+			field(base, 2, 2, "Total length", "%d", l.Length),
+			field(base, 4, 2, "Identification", "0x%04x (%d)", l.Id, l.Id),
+			field(base, 6, 2, "Flags", "0x%x %s", uint8(l.Flags), ipv4Flags(l.Flags)),
+			field(base, 6, 2, "Fragment offset", "%d", l.FragOffset),
+			field(base, 8, 1, "Time to live", "%d", l.TTL),
+			field(base, 9, 1, "Protocol", "%s (%d)", l.Protocol, uint8(l.Protocol)),
+			field(base, 10, 2, "Header checksum", "0x%04x", l.Checksum),
+			field(base, 12, 4, "Source address", "%s", l.SrcIP),
+			field(base, 16, 4, "Destination address", "%s", l.DstIP),
+		}
+		if l.IHL > 5 {
+			fields = append(fields, field(base, 20, int(l.IHL)*4-20, "Options", "%d bytes", int(l.IHL)*4-20))
+		}
+		return fields
+	case *layers.IPv6:
+		return []*DissectionField{
+			field(base, 0, 1, "Version", "%d", l.Version),
+			field(base, 0, 2, "Traffic class", "0x%02x", l.TrafficClass),
+			field(base, 1, 3, "Flow label", "0x%05x", l.FlowLabel),
+			field(base, 4, 2, "Payload length", "%d", l.Length),
+			field(base, 6, 1, "Next header", "%s (%d)", l.NextHeader, uint8(l.NextHeader)),
+			field(base, 7, 1, "Hop limit", "%d", l.HopLimit),
+			field(base, 8, 16, "Source address", "%s", l.SrcIP),
+			field(base, 24, 16, "Destination address", "%s", l.DstIP),
+		}
+	case *layers.TCP:
+		if len(l.Contents) < 20 {
+			return nil
+		}
+		headerLength := int(l.DataOffset) * 4
+		fields := []*DissectionField{
+			field(base, 0, 2, "Source port", "%d", l.SrcPort),
+			field(base, 2, 2, "Destination port", "%d", l.DstPort),
+			field(base, 4, 4, "Sequence number", "%d", l.Seq),
+			field(base, 8, 4, "Acknowledgment number", "%d", l.Ack),
+			field(base, 12, 1, "Header length", "%d bytes", headerLength),
+			field(base, 12, 2, "Flags", "[%s]", tcpFlags(l)),
+			field(base, 14, 2, "Window", "%d", l.Window),
+			field(base, 16, 2, "Checksum", "0x%04x", l.Checksum),
+			field(base, 18, 2, "Urgent pointer", "%d", l.Urgent),
+		}
+		if headerLength > 20 {
+			options := field(base, 20, headerLength-20, "Options", "%d bytes", headerLength-20)
+			at := 20
+			for _, opt := range l.Options {
+				length := int(opt.OptionLength)
+				if opt.OptionType == layers.TCPOptionKindEndList || opt.OptionType == layers.TCPOptionKindNop {
+					length = 1
+				}
+				options.Children = append(options.Children, field(base, at, length, opt.OptionType.String(), "%s", tcpOptionValue(opt)))
+				at += length
+			}
+			fields = append(fields, options)
+		}
+		return fields
+	case *layers.UDP:
+		return []*DissectionField{
+			field(base, 0, 2, "Source port", "%d", l.SrcPort),
+			field(base, 2, 2, "Destination port", "%d", l.DstPort),
+			field(base, 4, 2, "Length", "%d", l.Length),
+			field(base, 6, 2, "Checksum", "0x%04x", l.Checksum),
+		}
+	case *layers.ICMPv4:
+		return []*DissectionField{
+			field(base, 0, 2, "Type", "%s", l.TypeCode),
+			field(base, 2, 2, "Checksum", "0x%04x", l.Checksum),
+			field(base, 4, 2, "Identifier", "%d", l.Id),
+			field(base, 6, 2, "Sequence number", "%d", l.Seq),
+		}
+	case *layers.ICMPv6:
+		return []*DissectionField{
+			field(base, 0, 2, "Type", "%s", l.TypeCode),
+			field(base, 2, 2, "Checksum", "0x%04x", l.Checksum),
+		}
+	case *layers.DNS:
+		return dnsFields(l, base)
+	case *gopacket.Payload:
+		return payloadFields(l.LayerContents(), base)
+	case *gopacket.DecodeFailure:
+		return nil
+	}
+	return reflectFields(layer)
+}
+
+// layerSummary is shown next to the name of a layer
+func layerSummary(layer gopacket.Layer) string {
+	switch l := layer.(type) {
+	case *layers.Ethernet:
+		return fmt.Sprintf("%s → %s", l.SrcMAC, l.DstMAC)
+	case *layers.IPv4:
+		return fmt.Sprintf("%s → %s", l.SrcIP, l.DstIP)
+	case *layers.IPv6:
+		return fmt.Sprintf("%s → %s", l.SrcIP, l.DstIP)
+	case *layers.TCP:
+		if len(l.Contents) >= 20 {
+			return fmt.Sprintf("%d → %d, Seq %d, Ack %d, Len %d", l.SrcPort, l.DstPort, l.Seq, l.Ack, len(l.Payload))
+		}
+	case *layers.UDP:
+		return fmt.Sprintf("%d → %d", l.SrcPort, l.DstPort)
+	case *layers.ARP:
+		return arpOperation(l.Operation)
+	case *layers.DNS:
+		return dnsInfo(l)
+	}
+	return ""
+}
+
+func ipv4Flags(flags layers.IPv4Flag) string {
+	if flags == 0 {
+		return "(none)"
+	}
+	return "(" + flags.String() + ")"
+}
+
+func dnsFields(dns *layers.DNS, base int) []*DissectionField {
+	flags := "query"
+	if dns.QR {
+		flags = "response, " + dnsRCodeName(int(dns.ResponseCode))
+	}
+	fields := []*DissectionField{
+		field(base, 0, 2, "Transaction ID", "0x%04x", dns.ID),
+		field(base, 2, 2, "Flags", "%s, opcode %s", flags, dns.OpCode),
+		field(base, 4, 2, "Questions", "%d", dns.QDCount),
+		field(base, 6, 2, "Answer RRs", "%d", dns.ANCount),
+		field(base, 8, 2, "Authority RRs", "%d", dns.NSCount),
+		field(base, 10, 2, "Additional RRs", "%d", dns.ARCount),
+	}
+	if len(dns.Questions) > 0 {
+		queries := &DissectionField{Name: "Queries"}
+		for _, q := range dns.Questions {
+			queries.Children = append(queries.Children, &DissectionField{Name: string(q.Name), Value: dnsTypeName(q.Type) + " " + q.Class.String()})
+		}
+		fields = append(fields, queries)
+	}
+	for _, section := range []struct {
+		name    string
+		records []layers.DNSResourceRecord
+	}{{"Answers", dns.Answers}, {"Authorities", dns.Authorities}, {"Additional records", dns.Additionals}} {
+		if len(section.records) == 0 {
+			continue
+		}
+		node := &DissectionField{Name: section.name}
+		for _, rr := range section.records {
+			record := extractDNSRecord(rr)
+			node.Children = append(node.Children, &DissectionField{
+				Name:  record.Name,
+				Value: fmt.Sprintf("%s %s TTL %d %s", record.Type, record.Class, record.TTL, record.Data),
+			})
+		}
+		fields = append(fields, node)
+	}
+	return fields
+}
+
+// payloadFields splits text protocols such as HTTP into their lines
+func payloadFields(payload []byte, base int) []*DissectionField {
+	isText := false
+	for _, prefix := range httpPrefixes {
+		if strings.HasPrefix(string(payload), string(prefix)) {
+			isText = true
+		}
+	}
+	if !isText {
+		return nil
+	}
+
+	var fields []*DissectionField
+	at := 0
+	for at < len(payload) {
+		end := strings.Index(string(payload[at:]), "\r\n")
+		if end < 0 {
+			end = len(payload) - at
+		}
+		line := string(payload[at : at+end])
+		if line == "" {
+			// The body follows the blank line ending the headers
+			if rest := len(payload) - at - 2; rest > 0 {
+				fields = append(fields, field(base, at+2, rest, "Body", "%d bytes", rest))
+			}
+			break
+		}
+		fields = append(fields, field(base, at, end, truncate(line), ""))
+		at += end + 2
+	}
+	return fields
+}
+
+// reflectFields lists the exported fields of layers without a hand-written
+// dissector. Their positions are not known, so they cover the whole layer.
+func reflectFields(layer gopacket.Layer) []*DissectionField {
+	v := reflect.ValueOf(layer)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []*DissectionField
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Anonymous || f.Name == "Contents" || f.Name == "Payload" {
+			continue
+		}
+		value := v.Field(i)
+		var text string
+		switch x := value.Interface().(type) {
+		case net.IP:
+			text = x.String()
+		case net.HardwareAddr:
+			text = x.String()
+		case []byte:
+			text = hex.EncodeToString(x)
+		case fmt.Stringer:
+			text = x.String()
+		default:
+			switch value.Kind() {
+			case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.String:
+				text = fmt.Sprint(x)
+			case reflect.Slice:
+				text = fmt.Sprintf("%d items", value.Len())
+			default:
+				continue
+			}
+		}
+		fields = append(fields, &DissectionField{Name: f.Name, Value: truncate(text)})
+	}
+	return fields
+}
+
+func tcpOptionValue(opt layers.TCPOption) string {
+	switch opt.OptionType {
+	case layers.TCPOptionKindMSS:
+		if len(opt.OptionData) == 2 {
+			return fmt.Sprintf("%d", int(opt.OptionData[0])<<8|int(opt.OptionData[1]))
+		}
+	case layers.TCPOptionKindWindowScale:
+		if len(opt.OptionData) == 1 {
+			return fmt.Sprintf("shift %d (multiply by %d)", opt.OptionData[0], 1<<opt.OptionData[0])
+		}
+	}
+	if len(opt.OptionData) == 0 {
+		return ""
+	}
+	return hex.EncodeToString(opt.OptionData)
+}
+
+func arpOperation(op uint16) string {
+	switch op {
+	case layers.ARPRequest:
+		return "request (1)"
+	case layers.ARPReply:
+		return "reply (2)"
+	}
+	return fmt.Sprintf("%d", op)
+}
+
+func vendorOrUnknown(mac string) string {
+	if vendor := MACVendor(mac); vendor != "" {
+		return vendor
+	}
+	return "unknown vendor"
+}
+
+func truncate(s string) string {
+	if len(s) > maxFieldValue {
+		return s[:maxFieldValue] + "…"
+	}
+	return s
+}
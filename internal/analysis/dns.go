@@ -1,26 +1,114 @@
 package analysis
 
 import (
-	"heroPacket/internal/models"
+	"encoding/binary"
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/models"
+	"net"
 	"sort"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 )
 
 type DNSAnalyzer struct {
-	mu      sync.Mutex
-	Queries map[string]int // Domain -> count
-	Types   map[string]int // Query type -> count
-	Answers map[string]int // Answer -> count
+	mu            sync.Mutex
+	Queries       map[string]int        // Domain -> count
+	Types         map[string]int        // Query type -> count
+	Answers       map[string]*DNSAnswer // Name + type + data -> answer
+	ResponseCodes map[string]int        // Response code -> count
+	EDNSOptions   map[string]int        // EDNS option -> count
+	Stats         DNSStats
+	Transactions  []*DNSTransaction
+
+	pending map[string]*DNSTransaction // Transaction key -> latest query
+}
+
+// DNSStats counts DNS messages by kind.
+type DNSStats struct {
+	Messages  int
+	Queries   int
+	Responses int
+	Truncated int // Responses with the TC bit set
+	TCP       int // Messages carried over TCP
+	EDNS      int // Messages with an OPT record
+
+	// Computed from the paired transactions
+	Unanswered    int
+	Retransmitted int // Queries sent more than once
+	Errors        int // Responses other than NOERROR
+}
+
+// DNSTransaction pairs a query with its response by transaction ID,
+// 5-tuple and question.
+type DNSTransaction struct {
+	ID              uint16
+	ClientIP        string
+	ClientPort      uint16
+	ResolverIP      string
+	ResolverPort    uint16
+	Transport       string
+	Name            string
+	Type            string
+	QueryPacket     int
+	QueryTime       time.Time
+	ResponsePacket  int // Zero when unanswered
+	ResponseTime    time.Time
+	Latency         time.Duration
+	ResponseCode    string // Empty when unanswered
+	Answers         []models.DNSRecord
+	Retransmissions int // Repeats of the query before the response
+}
+
+// ResolverStats summarises the lookups sent to one resolver.
+type ResolverStats struct {
+	IP          string
+	Queries     int
+	Answered    int
+	Failures    int // Unanswered or not NOERROR
+	FailureRate float64
+	P50         time.Duration
+	P95         time.Duration
+	P99         time.Duration
+}
+
+// DNSAnswer is a distinct answer record and how often it was returned.
+type DNSAnswer struct {
+	Name  string
+	Type  string
+	Data  string
+	TTL   uint32 // Lowest TTL seen
+	Count int
+}
+
+type DNSCount struct {
+	Name  string
+	Count int
 }
 
 func NewDNSAnalyzer() *DNSAnalyzer {
 	return &DNSAnalyzer{
-		Queries: make(map[string]int),
-		Types:   make(map[string]int),
-		Answers: make(map[string]int),
+		Queries:       make(map[string]int),
+		Types:         make(map[string]int),
+		Answers:       make(map[string]*DNSAnswer),
+		ResponseCodes: make(map[string]int),
+		EDNSOptions:   make(map[string]int),
+		pending:       make(map[string]*DNSTransaction),
 	}
 }
 
+func (t *DNSTransaction) Answered() bool {
+	return t.ResponseCode != ""
+}
+
+// Failed reports whether the lookup went unanswered or returned an error.
+func (t *DNSTransaction) Failed() bool {
+	return t.ResponseCode != "NOERROR"
+}
+
 func (d *DNSAnalyzer) Process(packet models.Packet) {
 	if packet.DNS == nil {
 		return
@@ -29,18 +117,171 @@ func (d *DNSAnalyzer) Process(packet models.Packet) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	// Process DNS queries
-	for _, q := range packet.DNS.Questions {
-		d.Queries[q]++
+	msg := packet.DNS
+	d.Stats.Messages++
+	if msg.Transport == "TCP" {
+		d.Stats.TCP++
+	}
+	if msg.EDNS != nil {
+		d.Stats.EDNS++
+		for _, opt := range msg.EDNS.Options {
+			d.EDNSOptions[strings.Fields(opt)[0]]++
+		}
+	}
+
+	// Questions are counted once, on the query
+	if !msg.QR {
+		d.Stats.Queries++
+		for _, q := range msg.Questions {
+			d.Queries[q.Name]++
+			d.Types[q.Type]++
+		}
+		d.trackQuery(packet)
+		return
 	}
 
-	// Process DNS answers
-	for _, a := range packet.DNS.Answers {
-		d.Answers[a]++
+	d.Stats.Responses++
+	d.trackResponse(packet)
+	d.ResponseCodes[msg.ResponseCode]++
+	if msg.Truncated {
+		d.Stats.Truncated++
 	}
 
-	// Process operation type
-	d.Types[packet.DNS.OpCode]++
+	for _, a := range msg.Answers {
+		key := a.Name + "|" + a.Type + "|" + a.Data
+		answer, exists := d.Answers[key]
+		if !exists {
+			answer = &DNSAnswer{Name: a.Name, Type: a.Type, Data: a.Data, TTL: a.TTL}
+			d.Answers[key] = answer
+		}
+		answer.Count++
+		if a.TTL < answer.TTL {
+			answer.TTL = a.TTL
+		}
+	}
+}
+
+// transactionKey identifies a lookup from the client's point of view.
+// Queries to a multicast group, as in mDNS and LLMNR, are answered by
+// whichever host has the name, so they are keyed without the addresses.
+func transactionKey(msg *models.DNSInfo, client string, clientPort uint16, server string, serverPort uint16, transport string) string {
+	if ip := net.ParseIP(server); ip != nil && ip.IsMulticast() {
+		return multicastTransactionKey(msg, transport)
+	}
+	name, qtype := dnsQuestion(msg)
+	return fmt.Sprintf("%d|%s|%s:%d|%s:%d|%s|%s", msg.ID, transport, client, clientPort, server, serverPort, name, qtype)
+}
+
+func multicastTransactionKey(msg *models.DNSInfo, transport string) string {
+	name, qtype := dnsQuestion(msg)
+	return fmt.Sprintf("%d|%s|multicast|%s|%s", msg.ID, transport, name, qtype)
+}
+
+func dnsQuestion(msg *models.DNSInfo) (name, qtype string) {
+	if len(msg.Questions) > 0 {
+		return strings.ToLower(msg.Questions[0].Name), msg.Questions[0].Type
+	}
+	return "", ""
+}
+
+func (d *DNSAnalyzer) trackQuery(packet models.Packet) {
+	msg := packet.DNS
+	key := transactionKey(msg, packet.SourceIP, packet.SourcePort, packet.DestIP, packet.DestPort, msg.Transport)
+
+	// A repeat of an unanswered query is a retransmission, not a new lookup
+	if tx, exists := d.pending[key]; exists && !tx.Answered() {
+		tx.Retransmissions++
+		return
+	}
+
+	tx := &DNSTransaction{
+		ID:           msg.ID,
+		ClientIP:     packet.SourceIP,
+		ClientPort:   packet.SourcePort,
+		ResolverIP:   packet.DestIP,
+		ResolverPort: packet.DestPort,
+		Transport:    msg.Transport,
+		QueryPacket:  packet.Number,
+		QueryTime:    packet.Timestamp,
+	}
+	if len(msg.Questions) > 0 {
+		tx.Name, tx.Type = msg.Questions[0].Name, msg.Questions[0].Type
+	}
+	d.pending[key] = tx
+	d.Transactions = append(d.Transactions, tx)
+}
+
+func (d *DNSAnalyzer) trackResponse(packet models.Packet) {
+	msg := packet.DNS
+	key := transactionKey(msg, packet.DestIP, packet.DestPort, packet.SourceIP, packet.SourcePort, msg.Transport)
+
+	tx, exists := d.pending[key]
+	if !exists {
+		// The answer to a multicast query comes from the responder's own
+		// address, and in mDNS may go to the group
+		tx, exists = d.pending[multicastTransactionKey(msg, msg.Transport)]
+	}
+	if !exists || tx.Answered() {
+		return // Unsolicited or duplicate response
+	}
+	tx.ResponsePacket = packet.Number
+	tx.ResponseTime = packet.Timestamp
+	tx.Latency = packet.Timestamp.Sub(tx.QueryTime)
+	tx.ResponseCode = msg.ResponseCode
+	tx.Answers = msg.Answers
+}
+
+// ProcessStream decodes DNS over TCP.
+func (d *DNSAnalyzer) ProcessStream(stream *Stream) {
+	for _, packet := range dnsStreamMessages(stream) {
+		d.Process(packet)
+	}
+}
+
+// dnsStreamMessages decodes the DNS messages of a TCP stream, where every
+// message is preceded by a two byte length and may span several segments.
+func dnsStreamMessages(stream *Stream) []models.Packet {
+	if stream.Protocol != "TCP" || (stream.ServerPort != 53 && stream.ClientPort != 53) {
+		return nil
+	}
+
+	var packets []models.Packet
+	for _, dir := range []StreamDirection{ClientToServer, ServerToClient} {
+		data := stream.Data(dir)
+		for offset := 0; offset+2 <= len(data); {
+			length := int(binary.BigEndian.Uint16(data[offset:]))
+			if offset+2+length > len(data) {
+				break
+			}
+
+			dns := &layers.DNS{}
+			if err := dns.DecodeFromBytes(data[offset+2:offset+2+length], gopacket.NilDecodeFeedback); err == nil {
+				packets = append(packets, dnsStreamPacket(stream, dir, offset, dnsMessageInfo(dns, "TCP")))
+			}
+			offset += 2 + length
+		}
+	}
+	return packets
+}
+
+// dnsStreamPacket describes a message decoded from a stream as if it had
+// arrived in a packet of its own.
+func dnsStreamPacket(stream *Stream, dir StreamDirection, offset int, info *models.DNSInfo) models.Packet {
+	packet := models.Packet{
+		Number:     stream.Chunks[stream.chunkIndex(dir, offset)].Packet,
+		Timestamp:  stream.TimeAt(dir, offset),
+		SourceIP:   stream.ClientIP,
+		DestIP:     stream.ServerIP,
+		Protocol:   stream.Protocol,
+		SourcePort: stream.ClientPort,
+		DestPort:   stream.ServerPort,
+		DNS:        info,
+	}
+	if dir == ServerToClient {
+		packet.SourceIP, packet.DestIP = packet.DestIP, packet.SourceIP
+		packet.SourcePort, packet.DestPort = packet.DestPort, packet.SourcePort
+	}
+	return packet
 }
 
 func (d *DNSAnalyzer) TopQueries(n int) []QueryCount {
@@ -66,3 +307,207 @@ type QueryCount struct {
 	Domain string
 	Count  int
 }
+
+// TypeDistribution returns how often each record type was queried.
+func (d *DNSAnalyzer) TypeDistribution() []DNSCount {
+	return d.counts(d.Types)
+}
+
+// ResponseCodeDistribution returns how often each response code was seen,
+// e.g. NOERROR, NXDOMAIN or SERVFAIL.
+func (d *DNSAnalyzer) ResponseCodeDistribution() []DNSCount {
+	return d.counts(d.ResponseCodes)
+}
+
+func (d *DNSAnalyzer) EDNSOptionDistribution() []DNSCount {
+	return d.counts(d.EDNSOptions)
+}
+
+func (d *DNSAnalyzer) counts(m map[string]int) []DNSCount {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var counts []DNSCount
+	for name, count := range m {
+		counts = append(counts, DNSCount{Name: name, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	return counts
+}
+
+// TopAnswers returns the most frequently returned answer records.
+func (d *DNSAnalyzer) TopAnswers(n int) []*DNSAnswer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	answers := make([]*DNSAnswer, 0, len(d.Answers))
+	for _, answer := range d.Answers {
+		answers = append(answers, answer)
+	}
+	sort.Slice(answers, func(i, j int) bool {
+		if answers[i].Count != answers[j].Count {
+			return answers[i].Count > answers[j].Count
+		}
+		if answers[i].Name != answers[j].Name {
+			return answers[i].Name < answers[j].Name
+		}
+		return answers[i].Data < answers[j].Data
+	})
+
+	if len(answers) > n {
+		return answers[:n]
+	}
+	return answers
+}
+
+func (d *DNSAnalyzer) GetStats() DNSStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := d.Stats
+	for _, tx := range d.Transactions {
+		switch {
+		case !tx.Answered():
+			stats.Unanswered++
+		case tx.Failed():
+			stats.Errors++
+		}
+		if tx.Retransmissions > 0 {
+			stats.Retransmitted++
+		}
+	}
+	return stats
+}
+
+// GetTransactions returns every lookup in the order queries were sent.
+func (d *DNSAnalyzer) GetTransactions() []*DNSTransaction {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	transactions := make([]*DNSTransaction, len(d.Transactions))
+	copy(transactions, d.Transactions)
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].QueryTime.Before(transactions[j].QueryTime)
+	})
+	return transactions
+}
+
+// SlowestLookups returns the answered lookups with the highest latency.
+func (d *DNSAnalyzer) SlowestLookups(n int) []*DNSTransaction {
+	var answered []*DNSTransaction
+	for _, tx := range d.GetTransactions() {
+		if tx.Answered() {
+			answered = append(answered, tx)
+		}
+	}
+	sort.SliceStable(answered, func(i, j int) bool {
+		return answered[i].Latency > answered[j].Latency
+	})
+
+	if len(answered) > n {
+		return answered[:n]
+	}
+	return answered
+}
+
+// FailingLookups returns unanswered lookups and error responses in the
+// order they were sent.
+func (d *DNSAnalyzer) FailingLookups(n int) []*DNSTransaction {
+	var failing []*DNSTransaction
+	for _, tx := range d.GetTransactions() {
+		if tx.Failed() {
+			failing = append(failing, tx)
+		}
+	}
+
+	if len(failing) > n {
+		return failing[:n]
+	}
+	return failing
+}
+
+// ResolverStats returns lookup counts, latency percentiles and failure rate
+// per resolver, busiest first.
+func (d *DNSAnalyzer) ResolverStats() []ResolverStats {
+	byResolver := make(map[string][]*DNSTransaction)
+	for _, tx := range d.GetTransactions() {
+		byResolver[tx.ResolverIP] = append(byResolver[tx.ResolverIP], tx)
+	}
+
+	var stats []ResolverStats
+	for ip, transactions := range byResolver {
+		rs := ResolverStats{IP: ip, Queries: len(transactions)}
+		var latencies []time.Duration
+		for _, tx := range transactions {
+			if tx.Answered() {
+				rs.Answered++
+				latencies = append(latencies, tx.Latency)
+			}
+			if tx.Failed() {
+				rs.Failures++
+			}
+		}
+		rs.FailureRate = float64(rs.Failures) / float64(rs.Queries)
+
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		rs.P50 = percentile(latencies, 50)
+		rs.P95 = percentile(latencies, 95)
+		rs.P99 = percentile(latencies, 99)
+		stats = append(stats, rs)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Queries != stats[j].Queries {
+			return stats[i].Queries > stats[j].Queries
+		}
+		return stats[i].IP < stats[j].IP
+	})
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// ExpertItems reports unanswered lookups and error responses
+func (d *DNSAnalyzer) ExpertItems() []ExpertItem {
+	var items []ExpertItem
+	for _, tx := range d.GetTransactions() {
+		switch {
+		case !tx.Answered():
+			items = append(items, ExpertItem{
+				Severity: ExpertWarn,
+				Group:    ExpertProtocol,
+				Protocol: "DNS",
+				Summary:  "Query unanswered",
+				Detail:   tx.Type + " " + tx.Name,
+				Packet:   tx.QueryPacket,
+				Time:     tx.QueryTime,
+			})
+		case tx.Failed():
+			items = append(items, ExpertItem{
+				Severity: ExpertNote,
+				Group:    ExpertProtocol,
+				Protocol: "DNS",
+				Summary:  "Response " + tx.ResponseCode,
+				Detail:   tx.Type + " " + tx.Name,
+				Packet:   tx.ResponsePacket,
+				Time:     tx.ResponseTime,
+			})
+		}
+	}
+	return items
+}
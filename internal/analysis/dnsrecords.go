@@ -0,0 +1,255 @@
+package analysis
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/models"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	dnsTypeSVCB  layers.DNSType = 64
+	dnsTypeHTTPS layers.DNSType = 65
+)
+
+// Record types gopacket has no name for.
+var dnsTypeNames = map[layers.DNSType]string{
+	35:           "NAPTR",
+	39:           "DNAME",
+	43:           "DS",
+	46:           "RRSIG",
+	47:           "NSEC",
+	48:           "DNSKEY",
+	50:           "NSEC3",
+	51:           "NSEC3PARAM",
+	52:           "TLSA",
+	dnsTypeSVCB:  "SVCB",
+	dnsTypeHTTPS: "HTTPS",
+	99:           "SPF",
+	251:          "IXFR",
+	252:          "AXFR",
+	255:          "ANY",
+	257:          "CAA",
+}
+
+var dnsRCodeNames = map[int]string{
+	0:  "NOERROR",
+	1:  "FORMERR",
+	2:  "SERVFAIL",
+	3:  "NXDOMAIN",
+	4:  "NOTIMP",
+	5:  "REFUSED",
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NOTAUTH",
+	10: "NOTZONE",
+	16: "BADVERS",
+}
+
+func dnsName(name []byte) string {
+	if len(name) == 0 {
+		return "."
+	}
+	return string(name)
+}
+
+// dnsTypeName returns the mnemonic of a record type, or TYPEn as in RFC 3597.
+func dnsTypeName(t layers.DNSType) string {
+	if name := t.String(); name != "Unknown" {
+		return name
+	}
+	if name, ok := dnsTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", t)
+}
+
+// dnsClassName ignores the mDNS unicast-response / cache-flush bit.
+func dnsClassName(c layers.DNSClass) string {
+	c &= 0x7fff
+	switch name := c.String(); name {
+	case "Unknown":
+		return fmt.Sprintf("CLASS%d", c)
+	case "Any":
+		return "ANY"
+	default:
+		return name
+	}
+}
+
+func dnsRCodeName(code int) string {
+	if name, ok := dnsRCodeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", code)
+}
+
+// dnsRecordData renders record data in presentation format. Types that are
+// not decoded use the generic \# encoding of RFC 3597.
+func dnsRecordData(rr layers.DNSResourceRecord) string {
+	switch rr.Type {
+	case layers.DNSTypeA, layers.DNSTypeAAAA:
+		return rr.IP.String()
+	case layers.DNSTypeCNAME:
+		return dnsName(rr.CNAME)
+	case layers.DNSTypeNS:
+		return dnsName(rr.NS)
+	case layers.DNSTypePTR:
+		return dnsName(rr.PTR)
+	case layers.DNSTypeMX:
+		return fmt.Sprintf("%d %s", rr.MX.Preference, dnsName(rr.MX.Name))
+	case layers.DNSTypeTXT:
+		parts := make([]string, len(rr.TXTs))
+		for i, txt := range rr.TXTs {
+			parts[i] = strconv.Quote(string(txt))
+		}
+		return strings.Join(parts, " ")
+	case layers.DNSTypeSRV:
+		return fmt.Sprintf("%d %d %d %s", rr.SRV.Priority, rr.SRV.Weight, rr.SRV.Port, dnsName(rr.SRV.Name))
+	case layers.DNSTypeSOA:
+		return fmt.Sprintf("%s %s %d %d %d %d %d", dnsName(rr.SOA.MName), dnsName(rr.SOA.RName),
+			rr.SOA.Serial, rr.SOA.Refresh, rr.SOA.Retry, rr.SOA.Expire, rr.SOA.Minimum)
+	case dnsTypeSVCB, dnsTypeHTTPS:
+		if data, err := svcbData(rr.Data); err == nil {
+			return data
+		}
+	}
+	return fmt.Sprintf("\\# %d %x", len(rr.Data), rr.Data)
+}
+
+var svcbKeys = []string{"mandatory", "alpn", "no-default-alpn", "port", "ipv4hint", "ech", "ipv6hint"}
+
+// svcbData renders SVCB and HTTPS record data (RFC 9460), whose target name
+// is never compressed.
+func svcbData(data []byte) (string, error) {
+	errShort := fmt.Errorf("truncated SVCB record")
+	if len(data) < 3 {
+		return "", errShort
+	}
+	priority := binary.BigEndian.Uint16(data)
+	data = data[2:]
+
+	var labels []string
+	for {
+		if len(data) == 0 || len(data) < 1+int(data[0]) {
+			return "", errShort
+		}
+		length := int(data[0])
+		if length == 0 {
+			data = data[1:]
+			break
+		}
+		labels = append(labels, string(data[1:1+length]))
+		data = data[1+length:]
+	}
+	parts := []string{strconv.Itoa(int(priority)), strings.Join(labels, ".") + "."}
+
+	for len(data) > 0 {
+		if len(data) < 4 || len(data) < 4+int(binary.BigEndian.Uint16(data[2:])) {
+			return "", errShort
+		}
+		key := int(binary.BigEndian.Uint16(data))
+		value := data[4 : 4+int(binary.BigEndian.Uint16(data[2:]))]
+		data = data[4+len(value):]
+
+		name := fmt.Sprintf("key%d", key)
+		if key < len(svcbKeys) {
+			name = svcbKeys[key]
+		}
+		if rendered := svcbValue(key, value); rendered != "" {
+			name += "=" + rendered
+		}
+		parts = append(parts, name)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+func svcbValue(key int, value []byte) string {
+	var items []string
+	switch key {
+	case 0: // mandatory
+		for i := 0; i+2 <= len(value); i += 2 {
+			k := int(binary.BigEndian.Uint16(value[i:]))
+			if k < len(svcbKeys) {
+				items = append(items, svcbKeys[k])
+			} else {
+				items = append(items, fmt.Sprintf("key%d", k))
+			}
+		}
+	case 1: // alpn
+		for len(value) > 0 && len(value) >= 1+int(value[0]) {
+			items = append(items, string(value[1:1+int(value[0])]))
+			value = value[1+int(value[0]):]
+		}
+	case 2: // no-default-alpn
+		return ""
+	case 3: // port
+		if len(value) == 2 {
+			return strconv.Itoa(int(binary.BigEndian.Uint16(value)))
+		}
+	case 4: // ipv4hint
+		for i := 0; i+4 <= len(value); i += 4 {
+			items = append(items, net.IP(value[i:i+4]).String())
+		}
+	case 5: // ech
+		return base64.StdEncoding.EncodeToString(value)
+	case 6: // ipv6hint
+		for i := 0; i+16 <= len(value); i += 16 {
+			items = append(items, net.IP(value[i:i+16]).String())
+		}
+	default:
+		return hex.EncodeToString(value)
+	}
+	return strings.Join(items, ",")
+}
+
+// extractEDNS decodes an OPT pseudo-record, which reuses the class field for
+// the UDP payload size and the TTL for flags (RFC 6891).
+func extractEDNS(rr layers.DNSResourceRecord) *models.EDNSInfo {
+	edns := &models.EDNSInfo{
+		UDPSize:  uint16(rr.Class),
+		Version:  uint8(rr.TTL >> 16),
+		DNSSECOK: rr.TTL&0x8000 != 0,
+	}
+	for _, opt := range rr.OPT {
+		edns.Options = append(edns.Options, ednsOption(opt))
+	}
+	return edns
+}
+
+func ednsOption(opt layers.DNSOPT) string {
+	switch opt.Code {
+	case layers.DNSOptionCodeNSID:
+		return "NSID " + hex.EncodeToString(opt.Data)
+	case layers.DNSOptionCodeEDNSClientSubnet:
+		if len(opt.Data) >= 4 {
+			family, prefix := binary.BigEndian.Uint16(opt.Data), int(opt.Data[2])
+			size := map[uint16]int{1: net.IPv4len, 2: net.IPv6len}[family]
+			if size > 0 && len(opt.Data)-4 <= size {
+				ip := make(net.IP, size)
+				copy(ip, opt.Data[4:])
+				return fmt.Sprintf("ECS %s/%d", ip, prefix)
+			}
+		}
+		return "ECS"
+	case layers.DNSOptionCodeCookie:
+		return "COOKIE " + hex.EncodeToString(opt.Data)
+	case layers.DNSOptionCodeEDNSKeepAlive:
+		return "KEEPALIVE"
+	case layers.DNSOptionCodePadding:
+		return fmt.Sprintf("PADDING %d bytes", len(opt.Data))
+	case 15: // Extended DNS Error, RFC 8914
+		if len(opt.Data) >= 2 {
+			return strings.TrimSpace(fmt.Sprintf("EDE %d %s", binary.BigEndian.Uint16(opt.Data), opt.Data[2:]))
+		}
+		return "EDE"
+	}
+	return fmt.Sprintf("OPT%d %x", opt.Code, opt.Data)
+}
@@ -0,0 +1,492 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/models"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Thresholds for the tunnelling indicators. Each one that a domain crosses
+// adds to its score.
+const (
+	tunnelMinQueries          = 10
+	tunnelUniqueSubdomains    = 50
+	tunnelSubdomainLength     = 40  // Average characters left of the registered domain
+	tunnelLabelLength         = 50  // Longest single label
+	tunnelSubdomainEntropy    = 3.5 // Average bits per character
+	tunnelRecordTypeShare     = 0.5 // Share of TXT/NULL queries
+	tunnelQueriesPerMinute    = 60  // From a single client
+	dgaMinScore               = 0.6
+	dnsThreatSamples          = 5
+	dnsThreatTrackedSubdomain = 10000
+)
+
+// Two-label public suffixes under which the registered domain has three
+// labels. Not exhaustive, but covers the common country code zones.
+var dnsSecondLevelSuffixes = map[string]bool{
+	"co.uk": true, "org.uk": true, "ac.uk": true, "gov.uk": true,
+	"com.au": true, "net.au": true, "org.au": true,
+	"co.jp": true, "ne.jp": true, "or.jp": true,
+	"com.br": true, "com.cn": true, "com.mx": true, "com.tr": true,
+	"co.in": true, "co.kr": true, "co.nz": true, "co.za": true,
+	"com.my": true, "com.sg": true,
+}
+
+// DNSThreat is a suspected tunnel or DGA finding with the evidence behind it.
+type DNSThreat struct {
+	Kind       string // "Tunneling" or "DGA"
+	Severity   string // "high", "medium" or "low"
+	Domain     string // Registered domain, or the client for DGA findings
+	Score      float64
+	Indicators []string
+	Evidence   DNSThreatEvidence
+}
+
+type DNSThreatEvidence struct {
+	Queries          int
+	UniqueSubdomains int
+	TXTQueries       int // TXT and NULL
+	NXDomain         int
+	AvgLength        float64
+	MaxLabelLength   int
+	AvgEntropy       float64
+	MaxRate          float64 // Queries per minute from the busiest client
+	Clients          []string
+	Samples          []string
+	FirstSeen        time.Time
+	LastSeen         time.Time
+}
+
+// DNSThreatAnalyzer looks for DNS tunnelling and algorithmically generated
+// domains in the queries of a capture.
+type DNSThreatAnalyzer struct {
+	mu      sync.Mutex
+	Domains map[string]*dnsDomainActivity // Registered domain -> activity
+	Names   map[string]*dnsNameActivity   // Queried name -> activity
+}
+
+type dnsDomainActivity struct {
+	queries     int
+	txtQueries  int
+	nxdomain    int
+	subdomains  map[string]bool
+	totalLength int
+	maxLabel    int
+	entropy     float64 // Sum over queries with a subdomain
+	withSub     int
+	clients     map[string]*dnsClientActivity
+	samples     []string
+	firstSeen   time.Time
+	lastSeen    time.Time
+}
+
+type dnsClientActivity struct {
+	queries   int
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+type dnsNameActivity struct {
+	domain   string
+	queries  int
+	nxdomain int
+	clients  map[string]bool
+}
+
+func NewDNSThreatAnalyzer() *DNSThreatAnalyzer {
+	return &DNSThreatAnalyzer{
+		Domains: make(map[string]*dnsDomainActivity),
+		Names:   make(map[string]*dnsNameActivity),
+	}
+}
+
+func (d *DNSThreatAnalyzer) Process(packet models.Packet) {
+	msg := packet.DNS
+	if msg == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, q := range msg.Questions {
+		name := strings.TrimSuffix(strings.ToLower(q.Name), ".")
+		domain, subdomain := registeredDomain(name)
+		if domain == "" {
+			continue
+		}
+
+		if msg.QR {
+			if msg.ResponseCode == "NXDOMAIN" {
+				if activity, exists := d.Domains[domain]; exists {
+					activity.nxdomain++
+				}
+				if activity, exists := d.Names[name]; exists {
+					activity.nxdomain++
+				}
+			}
+			continue
+		}
+
+		activity, exists := d.Domains[domain]
+		if !exists {
+			activity = &dnsDomainActivity{
+				subdomains: make(map[string]bool),
+				clients:    make(map[string]*dnsClientActivity),
+				firstSeen:  packet.Timestamp,
+			}
+			d.Domains[domain] = activity
+		}
+		activity.queries++
+		activity.lastSeen = packet.Timestamp
+		if q.Type == "TXT" || q.Type == "NULL" {
+			activity.txtQueries++
+		}
+		if subdomain != "" {
+			if len(activity.subdomains) < dnsThreatTrackedSubdomain {
+				activity.subdomains[subdomain] = true
+			}
+			activity.totalLength += len(subdomain)
+			activity.entropy += shannonEntropy(strings.ReplaceAll(subdomain, ".", ""))
+			activity.withSub++
+			for _, label := range strings.Split(subdomain, ".") {
+				if len(label) > activity.maxLabel {
+					activity.maxLabel = len(label)
+				}
+			}
+		}
+		if len(activity.samples) < dnsThreatSamples && !contains(activity.samples, name) {
+			activity.samples = append(activity.samples, name)
+		}
+
+		client, exists := activity.clients[packet.SourceIP]
+		if !exists {
+			client = &dnsClientActivity{firstSeen: packet.Timestamp}
+			activity.clients[packet.SourceIP] = client
+		}
+		client.queries++
+		client.lastSeen = packet.Timestamp
+
+		nameActivity, exists := d.Names[name]
+		if !exists {
+			nameActivity = &dnsNameActivity{domain: domain, clients: make(map[string]bool)}
+			d.Names[name] = nameActivity
+		}
+		nameActivity.queries++
+		nameActivity.clients[packet.SourceIP] = true
+	}
+}
+
+// ProcessStream picks up DNS over TCP, which tunnels use for large answers.
+func (d *DNSThreatAnalyzer) ProcessStream(stream *Stream) {
+	for _, packet := range dnsStreamMessages(stream) {
+		d.Process(packet)
+	}
+}
+
+// Findings returns the suspected tunnels and DGA activity, most severe first.
+func (d *DNSThreatAnalyzer) Findings() []*DNSThreat {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	findings := append(d.tunnelFindings(), d.dgaFindings()...)
+	sort.SliceStable(findings, func(i, j int) bool {
+		if severityRank(findings[i].Severity) != severityRank(findings[j].Severity) {
+			return severityRank(findings[i].Severity) > severityRank(findings[j].Severity)
+		}
+		return findings[i].Score > findings[j].Score
+	})
+	return findings
+}
+
+func (d *DNSThreatAnalyzer) tunnelFindings() []*DNSThreat {
+	var findings []*DNSThreat
+	for domain, activity := range d.Domains {
+		if activity.queries < tunnelMinQueries {
+			continue
+		}
+
+		evidence := activity.evidence()
+		var indicators []string
+		if evidence.UniqueSubdomains >= tunnelUniqueSubdomains {
+			indicators = append(indicators, fmt.Sprintf("%d unique subdomains", evidence.UniqueSubdomains))
+		}
+		if evidence.AvgLength >= tunnelSubdomainLength {
+			indicators = append(indicators, fmt.Sprintf("average subdomain length %.0f", evidence.AvgLength))
+		}
+		if evidence.MaxLabelLength >= tunnelLabelLength {
+			indicators = append(indicators, fmt.Sprintf("label of %d characters", evidence.MaxLabelLength))
+		}
+		if evidence.AvgEntropy >= tunnelSubdomainEntropy {
+			indicators = append(indicators, fmt.Sprintf("subdomain entropy %.2f bits/char", evidence.AvgEntropy))
+		}
+		if share := float64(evidence.TXTQueries) / float64(evidence.Queries); share >= tunnelRecordTypeShare {
+			indicators = append(indicators, fmt.Sprintf("%.0f%% TXT/NULL queries", share*100))
+		}
+		if evidence.MaxRate >= tunnelQueriesPerMinute {
+			indicators = append(indicators, fmt.Sprintf("%.0f queries/min from one client", evidence.MaxRate))
+		}
+
+		// A single indicator is common for CDNs and anti-virus lookups
+		if len(indicators) < 2 {
+			continue
+		}
+		severity := "medium"
+		if len(indicators) >= 4 {
+			severity = "high"
+		}
+		findings = append(findings, &DNSThreat{
+			Kind:       "Tunneling",
+			Severity:   severity,
+			Domain:     domain,
+			Score:      float64(len(indicators)) / 6,
+			Indicators: indicators,
+			Evidence:   evidence,
+		})
+	}
+	return findings
+}
+
+func (a *dnsDomainActivity) evidence() DNSThreatEvidence {
+	evidence := DNSThreatEvidence{
+		Queries:          a.queries,
+		UniqueSubdomains: len(a.subdomains),
+		TXTQueries:       a.txtQueries,
+		NXDomain:         a.nxdomain,
+		MaxLabelLength:   a.maxLabel,
+		Samples:          a.samples,
+		FirstSeen:        a.firstSeen,
+		LastSeen:         a.lastSeen,
+	}
+	if a.withSub > 0 {
+		evidence.AvgLength = float64(a.totalLength) / float64(a.withSub)
+		evidence.AvgEntropy = a.entropy / float64(a.withSub)
+	}
+	for ip, client := range a.clients {
+		evidence.Clients = append(evidence.Clients, ip)
+		if rate := queryRate(client); rate > evidence.MaxRate {
+			evidence.MaxRate = rate
+		}
+	}
+	sort.Strings(evidence.Clients)
+	return evidence
+}
+
+// queryRate is in queries per minute. Bursts shorter than a minute count as
+// one minute so a handful of lookups is not mistaken for a flood.
+func queryRate(client *dnsClientActivity) float64 {
+	minutes := client.lastSeen.Sub(client.firstSeen).Minutes()
+	if minutes < 1 {
+		minutes = 1
+	}
+	return float64(client.queries) / minutes
+}
+
+// dgaFindings groups the names that look machine generated by the client
+// that queried them. Bots walking a DGA list mostly hit NXDOMAIN.
+func (d *DNSThreatAnalyzer) dgaFindings() []*DNSThreat {
+	type clientActivity struct {
+		names    []string
+		queries  int
+		nxdomain int
+		score    float64
+		first    time.Time
+		last     time.Time
+	}
+	byClient := make(map[string]*clientActivity)
+
+	for name, activity := range d.Names {
+		score := dgaScore(activity.domain)
+		if score < dgaMinScore {
+			continue
+		}
+		domain := d.Domains[activity.domain]
+		for ip := range activity.clients {
+			seen := domain.clients[ip]
+			client, exists := byClient[ip]
+			if !exists {
+				client = &clientActivity{first: seen.firstSeen, last: seen.lastSeen}
+				byClient[ip] = client
+			}
+			client.names = append(client.names, name)
+			client.queries += activity.queries
+			client.nxdomain += activity.nxdomain
+			client.score = math.Max(client.score, score)
+			if seen.firstSeen.Before(client.first) {
+				client.first = seen.firstSeen
+			}
+			if seen.lastSeen.After(client.last) {
+				client.last = seen.lastSeen
+			}
+		}
+	}
+
+	var findings []*DNSThreat
+	for ip, client := range byClient {
+		sort.Strings(client.names)
+		indicators := []string{fmt.Sprintf("%d random-looking names", len(client.names))}
+		if client.nxdomain > 0 {
+			indicators = append(indicators, fmt.Sprintf("%d NXDOMAIN responses", client.nxdomain))
+		}
+
+		severity := "low"
+		switch {
+		case len(client.names) >= 10 && client.nxdomain >= 10:
+			severity = "high"
+		case len(client.names) >= 3 && client.nxdomain > 0:
+			severity = "medium"
+		}
+
+		samples := client.names
+		if len(samples) > dnsThreatSamples {
+			samples = samples[:dnsThreatSamples]
+		}
+		findings = append(findings, &DNSThreat{
+			Kind:       "DGA",
+			Severity:   severity,
+			Domain:     ip,
+			Score:      client.score,
+			Indicators: indicators,
+			Evidence: DNSThreatEvidence{
+				Queries:          client.queries,
+				UniqueSubdomains: len(client.names),
+				NXDomain:         client.nxdomain,
+				Clients:          []string{ip},
+				Samples:          samples,
+				FirstSeen:        client.first,
+				LastSeen:         client.last,
+			},
+		})
+	}
+	return findings
+}
+
+// dgaScore rates how machine generated the leftmost label of a registered
+// domain looks, from 0 to 1. Generated names are long, have high entropy,
+// few vowels, long consonant runs and digits mixed with letters.
+func dgaScore(domain string) float64 {
+	label := domain
+	if i := strings.IndexByte(domain, '.'); i > 0 {
+		label = domain[:i]
+	}
+	if len(label) < 8 {
+		return 0
+	}
+
+	var vowels, digits, run, maxRun int
+	for _, c := range label {
+		switch {
+		case strings.ContainsRune("aeiouy", c):
+			vowels++
+			run = 0
+		case c >= '0' && c <= '9':
+			digits++
+			run = 0
+		case c >= 'a' && c <= 'z':
+			run++
+			if run > maxRun {
+				maxRun = run
+			}
+		default:
+			run = 0
+		}
+	}
+
+	length := float64(len(label))
+	score := 0.0
+	score += 0.3 * math.Min(shannonEntropy(label)/4, 1)
+	score += 0.2 * math.Min((length-8)/12, 1)
+	if ratio := float64(vowels) / length; ratio < 0.3 {
+		score += 0.2 * (0.3 - ratio) / 0.3
+	}
+	score += 0.2 * math.Min(float64(maxRun)/6, 1)
+	if digits > 0 && digits < len(label) {
+		score += 0.1 * math.Min(float64(digits)/length*4, 1)
+	}
+	return score
+}
+
+// registeredDomain splits a name into its registered domain and the
+// subdomain in front of it. Reverse lookups and link-local names are not
+// registered and return an empty domain.
+func registeredDomain(name string) (string, string) {
+	if name == "" || strings.HasSuffix(name, ".arpa") || strings.HasSuffix(name, ".local") {
+		return "", ""
+	}
+	labels := strings.Split(name, ".")
+	size := 2
+	if len(labels) >= 3 && dnsSecondLevelSuffixes[strings.Join(labels[len(labels)-2:], ".")] {
+		size = 3
+	}
+	if len(labels) < size {
+		return "", ""
+	}
+	return strings.Join(labels[len(labels)-size:], "."), strings.Join(labels[:len(labels)-size], ".")
+}
+
+// shannonEntropy returns the entropy of s in bits per character.
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	for _, c := range s {
+		counts[c]++
+	}
+	entropy := 0.0
+	length := float64(len([]rune(s)))
+	for _, count := range counts {
+		p := float64(count) / length
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case "high":
+		return 3
+	case "medium":
+		return 2
+	case "low":
+		return 1
+	}
+	return 0
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Expert info severity of each finding severity
+var dnsThreatExpertSeverity = map[string]string{
+	"high":   ExpertError,
+	"medium": ExpertWarn,
+	"low":    ExpertNote,
+}
+
+// ExpertItems reports each finding in the security group. Findings span
+// many packets, so the items are not tied to one.
+func (d *DNSThreatAnalyzer) ExpertItems() []ExpertItem {
+	var items []ExpertItem
+	for _, threat := range d.Findings() {
+		items = append(items, ExpertItem{
+			Severity: dnsThreatExpertSeverity[threat.Severity],
+			Group:    ExpertSecurity,
+			Protocol: "DNS",
+			Summary:  threat.Kind + " suspected",
+			Detail:   threat.Domain + ": " + strings.Join(threat.Indicators, ", "),
+			Time:     threat.Evidence.FirstSeen,
+		})
+	}
+	return items
+}
@@ -0,0 +1,319 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/models"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint types, one per table on the Endpoints page
+const (
+	EndpointEthernet = "Ethernet"
+	EndpointIPv4     = "IPv4"
+	EndpointIPv6     = "IPv6"
+)
+
+var EndpointTypes = []string{EndpointEthernet, EndpointIPv4, EndpointIPv6}
+
+// Endpoint is the traffic of one MAC or IP address.
+type Endpoint struct {
+	Type            string
+	Address         string
+	MAC             string // Source MAC last seen for an IP endpoint
+	Name            string // Passively resolved name of an IP endpoint
+	PacketsSent     int
+	BytesSent       int
+	PacketsReceived int
+	BytesReceived   int
+	FirstSeen       time.Time
+	LastSeen        time.Time
+	Peers           map[string]int // Peer address -> packets
+	Protocols       map[string]int // Protocol -> packets
+	ListeningPorts  map[uint16]bool
+
+	// IP endpoints only
+	Traffic   map[int64]*TrafficBucket // Unix second -> traffic
+	TTL       uint8                    // Of the first SYN or SYN/ACK sent
+	SYNWindow uint16                   // Window of the first SYN or SYN/ACK sent
+}
+
+// TrafficBucket is an endpoint's traffic during one second.
+type TrafficBucket struct {
+	PacketsSent     int
+	BytesSent       int
+	PacketsReceived int
+	BytesReceived   int
+}
+
+type EndpointAnalyzer struct {
+	mu        sync.Mutex
+	Endpoints map[string]*Endpoint // Type + "|" + address -> endpoint
+}
+
+func NewEndpointAnalyzer() *EndpointAnalyzer {
+	return &EndpointAnalyzer{
+		Endpoints: make(map[string]*Endpoint),
+	}
+}
+
+func (e *EndpointAnalyzer) Process(packet models.Packet) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if packet.SourceMAC != "" && packet.DestMAC != "" {
+		e.add(EndpointEthernet, packet.SourceMAC, packet.DestMAC, packet)
+	}
+	if packet.SourceIP == "" || packet.DestIP == "" {
+		return
+	}
+
+	kind := EndpointIPv4
+	if ip := net.ParseIP(packet.SourceIP); ip != nil && ip.To4() == nil {
+		kind = EndpointIPv6
+	}
+	src, dst := e.add(kind, packet.SourceIP, packet.DestIP, packet)
+	if packet.SourceMAC != "" {
+		src.MAC = packet.SourceMAC
+	}
+
+	second := packet.Timestamp.Unix()
+	sent := src.bucket(second)
+	sent.PacketsSent++
+	sent.BytesSent += packet.FrameLength
+	received := dst.bucket(second)
+	received.PacketsReceived++
+	received.BytesReceived += packet.FrameLength
+
+	if packet.TCP != nil && packet.TCP.SYN {
+		// Initial TTL and window size hint at the operating system
+		if src.TTL == 0 {
+			src.TTL = packet.TTL
+			src.SYNWindow = packet.TCP.Window
+		}
+		// A SYN/ACK means the sender accepted a connection on that port
+		if packet.TCP.ACK {
+			src.ListeningPorts[packet.SourcePort] = true
+		}
+	}
+}
+
+func (ep *Endpoint) bucket(second int64) *TrafficBucket {
+	if ep.Traffic == nil {
+		ep.Traffic = make(map[int64]*TrafficBucket)
+	}
+	bucket, exists := ep.Traffic[second]
+	if !exists {
+		bucket = &TrafficBucket{}
+		ep.Traffic[second] = bucket
+	}
+	return bucket
+}
+
+func (e *EndpointAnalyzer) add(kind, src, dst string, packet models.Packet) (*Endpoint, *Endpoint) {
+	sender := e.endpoint(kind, src, packet.Timestamp)
+	sender.PacketsSent++
+	sender.BytesSent += packet.FrameLength
+	sender.Peers[dst]++
+
+	receiver := e.endpoint(kind, dst, packet.Timestamp)
+	receiver.PacketsReceived++
+	receiver.BytesReceived += packet.FrameLength
+	receiver.Peers[src]++
+
+	if packet.Protocol != "" {
+		sender.Protocols[packet.Protocol]++
+		if receiver != sender {
+			receiver.Protocols[packet.Protocol]++
+		}
+	}
+	return sender, receiver
+}
+
+func (e *EndpointAnalyzer) endpoint(kind, address string, ts time.Time) *Endpoint {
+	key := kind + "|" + address
+	endpoint, exists := e.Endpoints[key]
+	if !exists {
+		endpoint = &Endpoint{
+			Type:           kind,
+			Address:        address,
+			FirstSeen:      ts,
+			Peers:          make(map[string]int),
+			Protocols:      make(map[string]int),
+			ListeningPorts: make(map[uint16]bool),
+		}
+		e.Endpoints[key] = endpoint
+	}
+	if ts.Before(endpoint.FirstSeen) {
+		endpoint.FirstSeen = ts
+	}
+	if ts.After(endpoint.LastSeen) {
+		endpoint.LastSeen = ts
+	}
+	return endpoint
+}
+
+// SetNames labels IP endpoints with their passively resolved names
+func (e *EndpointAnalyzer) SetNames(names map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, endpoint := range e.Endpoints {
+		if endpoint.Type != EndpointEthernet {
+			endpoint.Name = names[endpoint.Address]
+		}
+	}
+}
+
+// Get returns the IP endpoint with the given address, or nil
+func (e *EndpointAnalyzer) Get(address string) *Endpoint {
+	kind := EndpointIPv4
+	if ip := net.ParseIP(address); ip == nil {
+		return nil
+	} else if ip.To4() == nil {
+		kind = EndpointIPv6
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.Endpoints[kind+"|"+address]
+}
+
+func (ep *Endpoint) Packets() int {
+	return ep.PacketsSent + ep.PacketsReceived
+}
+
+func (ep *Endpoint) Bytes() int {
+	return ep.BytesSent + ep.BytesReceived
+}
+
+// ProtocolList returns the protocols used, most packets first
+func (ep *Endpoint) ProtocolList() []string {
+	protocols := make([]string, 0, len(ep.Protocols))
+	for protocol := range ep.Protocols {
+		protocols = append(protocols, protocol)
+	}
+	sort.Slice(protocols, func(i, j int) bool {
+		if ep.Protocols[protocols[i]] != ep.Protocols[protocols[j]] {
+			return ep.Protocols[protocols[i]] > ep.Protocols[protocols[j]]
+		}
+		return protocols[i] < protocols[j]
+	})
+	return protocols
+}
+
+// EndpointPeer is an address an endpoint exchanged packets with.
+type EndpointPeer struct {
+	Address string
+	Packets int
+}
+
+// TopPeers returns up to n peers, most packets first. n <= 0 returns all.
+func (ep *Endpoint) TopPeers(n int) []EndpointPeer {
+	peers := make([]EndpointPeer, 0, len(ep.Peers))
+	for address, packets := range ep.Peers {
+		peers = append(peers, EndpointPeer{Address: address, Packets: packets})
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		if peers[i].Packets != peers[j].Packets {
+			return peers[i].Packets > peers[j].Packets
+		}
+		return compareIPs(peers[i].Address, peers[j].Address) < 0
+	})
+	if n > 0 && len(peers) > n {
+		return peers[:n]
+	}
+	return peers
+}
+
+// PortList returns the listening TCP ports in ascending order
+func (ep *Endpoint) PortList() []uint16 {
+	ports := make([]uint16, 0, len(ep.ListeningPorts))
+	for port := range ep.ListeningPorts {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	return ports
+}
+
+// PortSummary formats the listening ports as "80/tcp, 443/tcp"
+func (ep *Endpoint) PortSummary() string {
+	var parts []string
+	for _, port := range ep.PortList() {
+		parts = append(parts, fmt.Sprintf("%d/tcp", port))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Columns the endpoint tables can be sorted by
+var endpointSorts = map[string]func(a, b *Endpoint) bool{
+	"address":    func(a, b *Endpoint) bool { return compareIPs(a.Address, b.Address) < 0 },
+	"name":       func(a, b *Endpoint) bool { return a.Name < b.Name },
+	"packets":    func(a, b *Endpoint) bool { return a.Packets() < b.Packets() },
+	"bytes":      func(a, b *Endpoint) bool { return a.Bytes() < b.Bytes() },
+	"tx_packets": func(a, b *Endpoint) bool { return a.PacketsSent < b.PacketsSent },
+	"tx_bytes":   func(a, b *Endpoint) bool { return a.BytesSent < b.BytesSent },
+	"rx_packets": func(a, b *Endpoint) bool { return a.PacketsReceived < b.PacketsReceived },
+	"rx_bytes":   func(a, b *Endpoint) bool { return a.BytesReceived < b.BytesReceived },
+	"peers":      func(a, b *Endpoint) bool { return len(a.Peers) < len(b.Peers) },
+	"first_seen": func(a, b *Endpoint) bool { return a.FirstSeen.Before(b.FirstSeen) },
+	"last_seen":  func(a, b *Endpoint) bool { return a.LastSeen.Before(b.LastSeen) },
+}
+
+// ValidEndpointSort reports whether key names a sortable column
+func ValidEndpointSort(key string) bool {
+	_, ok := endpointSorts[key]
+	return ok
+}
+
+// List returns one page of the endpoints of a type, sorted by the given
+// column, along with the number of endpoints of that type. Unknown columns
+// sort by bytes.
+func (e *EndpointAnalyzer) List(kind, sortBy string, desc bool, offset, limit int) ([]*Endpoint, int) {
+	e.mu.Lock()
+	var endpoints []*Endpoint
+	for _, endpoint := range e.Endpoints {
+		if endpoint.Type == kind {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	e.mu.Unlock()
+
+	less, ok := endpointSorts[sortBy]
+	if !ok {
+		less = endpointSorts["bytes"]
+	}
+	// Ties fall back to address order so pages are stable
+	sort.Slice(endpoints, func(i, j int) bool {
+		a, b := endpoints[i], endpoints[j]
+		if less(a, b) != less(b, a) {
+			return less(a, b) != desc
+		}
+		return compareIPs(a.Address, b.Address) < 0
+	})
+
+	total := len(endpoints)
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return endpoints[offset:end], total
+}
+
+// Count returns the number of endpoints of each type
+func (e *EndpointAnalyzer) Count() map[string]int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, endpoint := range e.Endpoints {
+		counts[endpoint.Type]++
+	}
+	return counts
+}
@@ -0,0 +1,263 @@
+package analysis
+
+import (
+	"github.com/shreethaar/heroPacket/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Expert info severities, as in Wireshark
+const (
+	ExpertChat  = "chat"  // Normal events worth knowing about
+	ExpertNote  = "note"  // Unusual but not necessarily a problem
+	ExpertWarn  = "warn"  // Likely a problem
+	ExpertError = "error" // Malformed packets and serious findings
+)
+
+// ExpertSeverities lists the severities, most severe first
+var ExpertSeverities = []string{ExpertError, ExpertWarn, ExpertNote, ExpertChat}
+
+// Expert info groups
+const (
+	ExpertMalformed = "malformed"
+	ExpertSequence  = "sequence"
+	ExpertProtocol  = "protocol"
+	ExpertSecurity  = "security"
+)
+
+var ExpertGroups = []string{ExpertMalformed, ExpertSequence, ExpertProtocol, ExpertSecurity}
+
+// ExpertItem is one observation about the capture, usually tied to a packet.
+type ExpertItem struct {
+	Severity string
+	Group    string
+	Protocol string
+	Summary  string // Shared by every item of the same type
+	Detail   string // Specific to this item
+	Packet   int    // Zero when the item is not tied to one packet
+	Time     time.Time
+}
+
+// ExpertSource is implemented by analyzers that report expert items once
+// the capture has been processed.
+type ExpertSource interface {
+	ExpertItems() []ExpertItem
+}
+
+// ExpertType is every item with the same severity, group, protocol and
+// summary.
+type ExpertType struct {
+	Severity string
+	Group    string
+	Protocol string
+	Summary  string
+	Count    int
+}
+
+// Key identifies the type in URLs
+func (t *ExpertType) Key() string {
+	return t.Severity + "|" + t.Group + "|" + t.Protocol + "|" + t.Summary
+}
+
+func (item *ExpertItem) key() string {
+	return item.Severity + "|" + item.Group + "|" + item.Protocol + "|" + item.Summary
+}
+
+// ExpertSeverityRank orders severities, zero being the most severe.
+// Unknown severities rank after chat.
+func ExpertSeverityRank(severity string) int {
+	for i, s := range ExpertSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return len(ExpertSeverities)
+}
+
+// ExpertInfo collects the expert items of a capture. It reports decode
+// errors and TCP connection events itself and gathers the rest from the
+// analyzers when the session finishes.
+type ExpertInfo struct {
+	mu    sync.Mutex
+	items []ExpertItem
+}
+
+func NewExpertInfo() *ExpertInfo {
+	return &ExpertInfo{}
+}
+
+func (e *ExpertInfo) Process(packet models.Packet) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if packet.DecodeError != "" {
+		protocol := "Malformed"
+		// The layer that failed is the one after the last decoded one
+		for i := len(packet.Layers) - 1; i >= 0; i-- {
+			if packet.Layers[i] != "Malformed" {
+				protocol = packet.Layers[i]
+				break
+			}
+		}
+		e.add(ExpertItem{
+			Severity: ExpertError,
+			Group:    ExpertMalformed,
+			Protocol: protocol,
+			Summary:  "Malformed packet",
+			Detail:   packet.DecodeError,
+			Packet:   packet.Number,
+			Time:     packet.Timestamp,
+		})
+	}
+
+	if tcp := packet.TCP; tcp != nil {
+		summary := ""
+		switch {
+		case tcp.SYN && tcp.ACK:
+			summary = "Connection establish acknowledge (SYN+ACK)"
+		case tcp.SYN:
+			summary = "Connection establish request (SYN)"
+		case tcp.FIN:
+			summary = "Connection finish (FIN)"
+		}
+		if summary != "" {
+			e.add(ExpertItem{
+				Severity: ExpertChat,
+				Group:    ExpertSequence,
+				Protocol: "TCP",
+				Summary:  summary,
+				Detail:   packet.SourceIP + " → " + packet.DestIP,
+				Packet:   packet.Number,
+				Time:     packet.Timestamp,
+			})
+		}
+	}
+}
+
+func (e *ExpertInfo) add(item ExpertItem) {
+	e.items = append(e.items, item)
+}
+
+// Collect gathers the items of each source. Items are kept in packet order,
+// with items not tied to a packet first.
+func (e *ExpertInfo) Collect(sources ...ExpertSource) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, source := range sources {
+		e.items = append(e.items, source.ExpertItems()...)
+	}
+	sort.SliceStable(e.items, func(i, j int) bool {
+		return e.items[i].Packet < e.items[j].Packet
+	})
+}
+
+// Types aggregates the items by type, most severe first and then by count.
+// Empty severity or group match every item.
+func (e *ExpertInfo) Types(severity, group string) []*ExpertType {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	types := make(map[string]*ExpertType)
+	for _, item := range e.items {
+		if (severity != "" && item.Severity != severity) || (group != "" && item.Group != group) {
+			continue
+		}
+		t, exists := types[item.key()]
+		if !exists {
+			t = &ExpertType{Severity: item.Severity, Group: item.Group, Protocol: item.Protocol, Summary: item.Summary}
+			types[item.key()] = t
+		}
+		t.Count++
+	}
+
+	result := make([]*ExpertType, 0, len(types))
+	for _, t := range types {
+		result = append(result, t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if ExpertSeverityRank(a.Severity) != ExpertSeverityRank(b.Severity) {
+			return ExpertSeverityRank(a.Severity) < ExpertSeverityRank(b.Severity)
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Key() < b.Key()
+	})
+	return result
+}
+
+// Items returns one page of the items of a type, identified by its Key,
+// along with the number of items of that type.
+func (e *ExpertInfo) Items(key string, offset, limit int) ([]ExpertItem, int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var items []ExpertItem
+	for _, item := range e.items {
+		if item.key() == key {
+			items = append(items, item)
+		}
+	}
+
+	total := len(items)
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return items[offset:end], total
+}
+
+// All returns every item
+func (e *ExpertInfo) All() []ExpertItem {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	items := make([]ExpertItem, len(e.items))
+	copy(items, e.items)
+	return items
+}
+
+// Findings returns the items more severe than chat, leaving out the normal
+// events
+func (e *ExpertInfo) Findings() []ExpertItem {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var items []ExpertItem
+	for _, item := range e.items {
+		if ExpertSeverityRank(item.Severity) < ExpertSeverityRank(ExpertChat) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// SeverityCounts returns the number of items of each severity
+func (e *ExpertInfo) SeverityCounts() map[string]int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, item := range e.items {
+		counts[item.Severity]++
+	}
+	return counts
+}
+
+// GroupCounts returns the number of items in each group
+func (e *ExpertInfo) GroupCounts() map[string]int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, item := range e.items {
+		counts[item.Group]++
+	}
+	return counts
+}
@@ -0,0 +1,283 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// PacketSelection chooses packets of a capture to export. A packet is
+// selected when it meets every criterion given, so the zero value selects
+// them all.
+type PacketSelection struct {
+	BPF          string        // Capture filter, e.g. "tcp port 443"
+	Filter       string        // Display filter, see ParseDisplayFilter
+	Conversation string        // Conversation.Key
+	From, To     time.Time     // Inclusive, zero for no limit
+	Packets      []PacketRange // Packet numbers, nil for any
+}
+
+// PacketRange is the packets numbered From to To, inclusive
+type PacketRange struct {
+	From, To int
+}
+
+// String describes the selection, as recorded in exported files
+func (s PacketSelection) String() string {
+	var parts []string
+	if s.BPF != "" {
+		parts = append(parts, "bpf: "+s.BPF)
+	}
+	if s.Filter != "" {
+		parts = append(parts, "display filter: "+s.Filter)
+	}
+	if s.Conversation != "" {
+		parts = append(parts, "conversation: "+strings.ReplaceAll(s.Conversation, "|", " "))
+	}
+	if !s.From.IsZero() {
+		parts = append(parts, "from: "+s.From.Format(time.RFC3339Nano))
+	}
+	if !s.To.IsZero() {
+		parts = append(parts, "to: "+s.To.Format(time.RFC3339Nano))
+	}
+	if s.Packets != nil {
+		parts = append(parts, "packets: "+FormatPacketRanges(s.Packets))
+	}
+	if len(parts) == 0 {
+		return "all packets"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ParsePacketRanges reads a list of packet numbers and ranges such as
+// "1-10,15,20-22"
+func ParsePacketRanges(value string) ([]PacketRange, error) {
+	var ranges []PacketRange
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil || from < 1 {
+			return nil, fmt.Errorf("invalid packet number %q", part)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(strings.TrimSpace(last)); err != nil || to < from {
+				return nil, fmt.Errorf("invalid packet range %q", part)
+			}
+		}
+		ranges = append(ranges, PacketRange{from, to})
+	}
+	if len(ranges) == 0 {
+		return nil, errors.New("no packet numbers given")
+	}
+	return ranges, nil
+}
+
+// mergePacketRanges sorts ranges and joins those that overlap or touch
+func mergePacketRanges(ranges []PacketRange) []PacketRange {
+	sorted := append([]PacketRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].From < sorted[j].From })
+
+	var merged []PacketRange
+	for _, r := range sorted {
+		if last := len(merged) - 1; last >= 0 && r.From-1 <= merged[last].To {
+			if r.To > merged[last].To {
+				merged[last].To = r.To
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// FormatPacketRanges is the inverse of ParsePacketRanges, with the ranges
+// sorted and merged
+func FormatPacketRanges(ranges []PacketRange) string {
+	var parts []string
+	for _, r := range mergePacketRanges(ranges) {
+		if r.From == r.To {
+			parts = append(parts, strconv.Itoa(r.From))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", r.From, r.To))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// ExportPackets writes the selected packets of an indexed capture to w as a
+// pcap or pcapng file, keeping their timestamps and link types, and returns
+// how many it wrote. A pcapng file records the selection in its section
+// comment. A pcap file has no room for comments and only one link type, so
+// it cannot be written from a capture mixing link types. Errors in the
+// selection are reported before anything is written.
+func ExportPackets(index *PacketIndex, selection PacketSelection, format string, w io.Writer) (int, error) {
+	return exportPackets(index, selection, format, selection.String(), nil, w)
+}
+
+// SanitizePackets exports like ExportPackets with each packet rewritten by
+// a Sanitizer. The selection is left out of the file, as its filters may
+// name the addresses being hidden.
+func SanitizePackets(index *PacketIndex, selection PacketSelection, sanitizer *Sanitizer, format string, w io.Writer) (int, error) {
+	return exportPackets(index, selection, format, "Sanitized by heroPacket", sanitizer.Packet, w)
+}
+
+type packetRewriter func(data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) ([]byte, gopacket.CaptureInfo)
+
+func exportPackets(index *PacketIndex, selection PacketSelection, format, comment string, rewrite packetRewriter, w io.Writer) (int, error) {
+	filter, err := ParseDisplayFilter(selection.Filter)
+	if err != nil {
+		return 0, fmt.Errorf("display filter: %v", err)
+	}
+
+	for _, r := range selection.Packets {
+		if r.From > index.Len() {
+			return 0, fmt.Errorf("packet %d is past the end of the capture, which has %d packets", r.From, index.Len())
+		}
+	}
+
+	interfaces := index.Interfaces
+	if len(interfaces) == 0 {
+		interfaces = []IndexInterface{{LinkType: layers.LinkTypeEthernet}}
+	}
+
+	// A capture filter compiles for one link type
+	var bpfs []*pcap.BPF
+	if selection.BPF != "" {
+		for _, iface := range interfaces {
+			bpf, err := pcap.NewBPF(iface.LinkType, snapLength(iface), selection.BPF)
+			if err != nil {
+				return 0, fmt.Errorf("capture filter: %v", err)
+			}
+			bpfs = append(bpfs, bpf)
+		}
+	}
+
+	var write func(ci gopacket.CaptureInfo, data []byte) error
+	var flush func() error
+	switch format {
+	case FormatPcap:
+		snap := 0
+		for _, iface := range interfaces {
+			if iface.LinkType != interfaces[0].LinkType {
+				return 0, errors.New("the capture mixes link types, which pcap cannot hold; export as pcapng")
+			}
+			if snapLength(iface) > snap {
+				snap = snapLength(iface)
+			}
+		}
+		writer := pcapgo.NewWriterNanos(w)
+		if err := writer.WriteFileHeader(uint32(snap), interfaces[0].LinkType); err != nil {
+			return 0, err
+		}
+		write = writer.WritePacket
+		flush = func() error { return nil }
+
+	case FormatPcapNG:
+		// Interfaces keep their numbers, which the index counts across
+		// sections
+		options := pcapgo.NgWriterOptions{SectionInfo: pcapgo.NgSectionInfo{
+			Application: "heroPacket",
+			Comment:     comment,
+		}}
+		writer, err := pcapgo.NewNgWriterInterface(w, ngInterface(interfaces[0]), options)
+		if err != nil {
+			return 0, err
+		}
+		for _, iface := range interfaces[1:] {
+			if _, err := writer.AddInterface(ngInterface(iface)); err != nil {
+				return 0, err
+			}
+		}
+		write = writer.WritePacket
+		flush = writer.Flush
+
+	default:
+		return 0, fmt.Errorf("unknown capture format %q", format)
+	}
+
+	// The time range is checked against the index without reading packets
+	var numbers []int
+	candidate := func(n int) {
+		e := index.Entry(n)
+		if e == nil || (!selection.From.IsZero() && e.Timestamp.Before(selection.From)) || (!selection.To.IsZero() && e.Timestamp.After(selection.To)) {
+			return
+		}
+		numbers = append(numbers, n)
+	}
+	if selection.Packets != nil {
+		// Ranges are clamped to the capture before expanding, so a huge range
+		// costs no more than selecting every packet
+		for _, r := range mergePacketRanges(selection.Packets) {
+			to := r.To
+			if to > index.Len() {
+				to = index.Len()
+			}
+			for n := r.From; n <= to; n++ {
+				candidate(n)
+			}
+		}
+	} else {
+		for n := 1; n <= index.Len(); n++ {
+			candidate(n)
+		}
+	}
+
+	written := 0
+	decode := selection.Filter != "" || selection.Conversation != ""
+	err = index.packetData(numbers, func(number int, data []byte, ci gopacket.CaptureInfo) error {
+		if bpfs != nil && !bpfs[ci.InterfaceIndex].Matches(ci, data) {
+			return nil
+		}
+		if decode {
+			packet := gopacket.NewPacket(data, index.LinkType(number), gopacket.Default)
+			packet.Metadata().CaptureInfo = ci
+			info := extractPacketInfo(packet)
+			info.Number = number
+			if !filter.Match(info) || (selection.Conversation != "" && !InConversation(selection.Conversation, info)) {
+				return nil
+			}
+		}
+		if rewrite != nil {
+			data, ci = rewrite(data, ci, index.LinkType(number))
+		}
+		if err := write(ci, data); err != nil {
+			return err
+		}
+		written++
+		return nil
+	})
+	if err != nil {
+		return written, err
+	}
+	return written, flush()
+}
+
+// snapLength is the snap length of an interface, where zero means none
+func snapLength(iface IndexInterface) int {
+	if iface.SnapLen > 0 {
+		return iface.SnapLen
+	}
+	return 262144
+}
+
+func ngInterface(iface IndexInterface) pcapgo.NgInterface {
+	return pcapgo.NgInterface{
+		LinkType:            iface.LinkType,
+		SnapLength:          uint32(iface.SnapLen),
+		TimestampResolution: 9,
+	}
+}
@@ -5,7 +5,7 @@ import (
     "github.com/google/gopacket"
     "github.com/google/gopacket/layers"
     "github.com/google/gopacket/pcap"
-    "heroPacket/internal/models"
+    "github.com/shreethaar/heroPacket/internal/models"
 )
 
 type PacketMetadata struct {
@@ -61,26 +61,46 @@ func ExtractPackets(filePath string) ([]models.Packet, error) {
     var packets []models.Packet
 
     for packet := range source.Packets() {
-        packets = append(packets, extractPacketInfo(packet))
+        packets = append(packets, DecodePacket(packet, len(packets)+1))
     }
 
     return packets, nil
 }
 
+// DecodePacket prepares a packet for the analyzers. Number is its position
+// in the capture, counting from 1.
+func DecodePacket(packet gopacket.Packet, number int) models.Packet {
+    info := extractPacketInfo(packet)
+    info.Number = number
+    return info
+}
+
 func extractPacketInfo(packet gopacket.Packet) models.Packet {
     metadata := extractMetadata(packet)
     details := extractDetails(packet)
     dnsInfo := extractDNSInfo(packet)
+    tcpInfo := extractTCPInfo(packet)
+    stack := protocolStack(packet)
 
     return models.Packet{
         Timestamp:   metadata.Timestamp,
+        SourceMAC:   details.LinkLayer.Source,
+        DestMAC:     details.LinkLayer.Destination,
         SourceIP:    details.NetworkLayer.Source,
         DestIP:      details.NetworkLayer.Destination,
-        Protocol:    details.TransportLayer.Protocol,
+        Protocol:    packetProtocol(details.TransportLayer.Protocol, stack),
+        Layers:      stack,
         Length:      int(details.NetworkLayer.Length),
+        FrameLength: metadata.CaptureInfo.Length,
+        TTL:         details.NetworkLayer.TTL,
         SourcePort:  details.TransportLayer.SourcePort,
         DestPort:    details.TransportLayer.DestPort,
+        TCP:         tcpInfo,
+        Payload:     details.TransportLayer.Payload,
         DNS:         dnsInfo,
+        HostNames:   extractHostNames(packet),
+        DecodeError: metadata.ErrorMessage,
+        Info:        packetInfo(packet),
     }
 }
 
@@ -121,6 +141,7 @@ func extractDetails(packet gopacket.Packet) *PacketDetails {
         details.NetworkLayer.Source = ipv6.SrcIP.String()
         details.NetworkLayer.Destination = ipv6.DstIP.String()
         details.NetworkLayer.Protocol = ipv6.NextHeader.String()
+        details.NetworkLayer.TTL = ipv6.HopLimit
         details.NetworkLayer.Length = uint16(ipv6.Length)
     }
     if tcpLayer := packet.Layer(layers.LayerTypeTCP); tcpLayer != nil {
@@ -145,41 +166,98 @@ func extractDetails(packet gopacket.Packet) *PacketDetails {
     
     return details
 }
+func extractTCPInfo(packet gopacket.Packet) *models.TCPInfo {
+    tcpLayer := packet.Layer(layers.LayerTypeTCP)
+    if tcpLayer == nil {
+        return nil
+    }
+
+    tcp, _ := tcpLayer.(*layers.TCP)
+    // gopacket keeps the layer even when the header failed to decode
+    if len(tcp.Contents) < 20 {
+        return nil
+    }
+    info := &models.TCPInfo{
+        Seq:         tcp.Seq,
+        Ack:         tcp.Ack,
+        SYN:         tcp.SYN,
+        ACK:         tcp.ACK,
+        FIN:         tcp.FIN,
+        RST:         tcp.RST,
+        PSH:         tcp.PSH,
+        Window:      tcp.Window,
+        WindowScale: -1,
+    }
+    for _, opt := range tcp.Options {
+        if opt.OptionType == layers.TCPOptionKindWindowScale && len(opt.OptionData) == 1 {
+            info.WindowScale = int(opt.OptionData[0])
+        }
+    }
+    return info
+}
+
+// extractDNSInfo decodes DNS carried over UDP. Messages over TCP carry a
+// length prefix and may span segments, so DNSAnalyzer decodes them from the
+// reassembled stream instead.
 func extractDNSInfo(packet gopacket.Packet) *models.DNSInfo {
     dnsLayer := packet.Layer(layers.LayerTypeDNS)
-    if dnsLayer == nil {
+    if dnsLayer == nil || packet.Layer(layers.LayerTypeUDP) == nil {
         return nil
     }
 
     dns, _ := dnsLayer.(*layers.DNS)
-    return &models.DNSInfo{
+    return dnsMessageInfo(dns, "UDP")
+}
+
+func dnsMessageInfo(dns *layers.DNS, transport string) *models.DNSInfo {
+    info := &models.DNSInfo{
+        ID:           dns.ID,
         QR:           dns.QR,
         OpCode:       dns.OpCode.String(),
+        Truncated:    dns.TC,
         Questions:    extractDNSQuestions(dns),
-        Answers:      extractDNSAnswers(dns),
-        ResponseCode: dns.ResponseCode.String(),
+        Answers:      extractDNSRecords(dns.Answers),
+        Authorities:  extractDNSRecords(dns.Authorities),
+        ResponseCode: dnsRCodeName(int(dns.ResponseCode)),
+        Transport:    transport,
     }
-}
-type DNSInfo struct {
-    QR           bool      
-    OpCode       string    
-    Questions    []string  
-    Answers      []string  
-    ResponseCode string    
+
+    for _, rr := range dns.Additionals {
+        if rr.Type == layers.DNSTypeOPT {
+            info.EDNS = extractEDNS(rr)
+            continue
+        }
+        info.Additionals = append(info.Additionals, extractDNSRecord(rr))
+    }
+    return info
 }
 
-func extractDNSQuestions(dns *layers.DNS) []string {
-    var questions []string
+func extractDNSQuestions(dns *layers.DNS) []models.DNSQuestion {
+    var questions []models.DNSQuestion
     for _, q := range dns.Questions {
-        questions = append(questions, string(q.Name))
+        questions = append(questions, models.DNSQuestion{
+            Name:  dnsName(q.Name),
+            Type:  dnsTypeName(q.Type),
+            Class: dnsClassName(q.Class),
+        })
     }
     return questions
 }
 
-func extractDNSAnswers(dns *layers.DNS) []string {
-    var answers []string
-    for _, a := range dns.Answers {
-        answers = append(answers, string(a.Name))
+func extractDNSRecords(records []layers.DNSResourceRecord) []models.DNSRecord {
+    var result []models.DNSRecord
+    for _, rr := range records {
+        result = append(result, extractDNSRecord(rr))
+    }
+    return result
+}
+
+func extractDNSRecord(rr layers.DNSResourceRecord) models.DNSRecord {
+    return models.DNSRecord{
+        Name:  dnsName(rr.Name),
+        Type:  dnsTypeName(rr.Type),
+        Class: dnsClassName(rr.Class),
+        TTL:   rr.TTL,
+        Data:  dnsRecordData(rr),
     }
-    return answers
 }
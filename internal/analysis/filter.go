@@ -0,0 +1,480 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/models"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DisplayFilter is a parsed display filter in the style of Wireshark's, e.g.
+//
+//	ip.addr == 10.0.0.0/8 and (tcp.port == 443 or dns.qry.name contains "example")
+//
+// Fields compare against each of their values, so ip.addr == x matches
+// either address and ip.addr != x matches packets where neither is x.
+// Strings compare without regard to case.
+type DisplayFilter struct {
+	expr filterNode
+}
+
+type filterNode interface {
+	match(p *models.Packet) bool
+}
+
+type filterField func(p *models.Packet) []string
+
+// filterFields lists the fields a display filter can test. Each returns the
+// field's values in a packet, or nil when the packet does not have it.
+var filterFields = map[string]filterField{
+	"frame.number":    func(p *models.Packet) []string { return []string{strconv.Itoa(p.Number)} },
+	"frame.len":       func(p *models.Packet) []string { return []string{strconv.Itoa(p.FrameLength)} },
+	"frame.protocols": func(p *models.Packet) []string { return []string{strings.ToLower(strings.Join(p.Layers, ":"))} },
+	"frame.info":      func(p *models.Packet) []string { return []string{p.Info} },
+	"eth.src":         func(p *models.Packet) []string { return nonEmpty(p.SourceMAC) },
+	"eth.dst":         func(p *models.Packet) []string { return nonEmpty(p.DestMAC) },
+	"eth.addr":        func(p *models.Packet) []string { return nonEmpty(p.SourceMAC, p.DestMAC) },
+	"ip.src":          func(p *models.Packet) []string { return nonEmpty(p.SourceIP) },
+	"ip.dst":          func(p *models.Packet) []string { return nonEmpty(p.DestIP) },
+	"ip.addr":         func(p *models.Packet) []string { return nonEmpty(p.SourceIP, p.DestIP) },
+	"ip.ttl":          func(p *models.Packet) []string { return ipOnly(p, strconv.Itoa(int(p.TTL))) },
+	"tcp.srcport":     func(p *models.Packet) []string { return portOf(p, "TCP", p.SourcePort) },
+	"tcp.dstport":     func(p *models.Packet) []string { return portOf(p, "TCP", p.DestPort) },
+	"tcp.port":        func(p *models.Packet) []string { return portOf(p, "TCP", p.SourcePort, p.DestPort) },
+	"udp.srcport":     func(p *models.Packet) []string { return portOf(p, "UDP", p.SourcePort) },
+	"udp.dstport":     func(p *models.Packet) []string { return portOf(p, "UDP", p.DestPort) },
+	"udp.port":        func(p *models.Packet) []string { return portOf(p, "UDP", p.SourcePort, p.DestPort) },
+	"tcp.seq":         tcpField(func(t *models.TCPInfo) uint64 { return uint64(t.Seq) }),
+	"tcp.ack":         tcpField(func(t *models.TCPInfo) uint64 { return uint64(t.Ack) }),
+	"tcp.window_size": tcpField(func(t *models.TCPInfo) uint64 { return uint64(t.Window) }),
+	"tcp.flags.syn":   tcpField(func(t *models.TCPInfo) uint64 { return boolValue(t.SYN) }),
+	"tcp.flags.ack":   tcpField(func(t *models.TCPInfo) uint64 { return boolValue(t.ACK) }),
+	"tcp.flags.fin":   tcpField(func(t *models.TCPInfo) uint64 { return boolValue(t.FIN) }),
+	"tcp.flags.reset": tcpField(func(t *models.TCPInfo) uint64 { return boolValue(t.RST) }),
+	"tcp.flags.push":  tcpField(func(t *models.TCPInfo) uint64 { return boolValue(t.PSH) }),
+	"tcp.len": func(p *models.Packet) []string {
+		if p.TCP == nil {
+			return nil
+		}
+		return []string{strconv.Itoa(len(p.Payload))}
+	},
+	"dns.id": dnsField(func(d *models.DNSInfo) []string { return []string{strconv.Itoa(int(d.ID))} }),
+	"dns.flags.response": dnsField(func(d *models.DNSInfo) []string {
+		return []string{strconv.FormatUint(boolValue(d.QR), 10)}
+	}),
+	"dns.flags.rcode": dnsField(func(d *models.DNSInfo) []string {
+		if !d.QR {
+			return nil
+		}
+		return []string{d.ResponseCode}
+	}),
+	"dns.qry.name": dnsField(func(d *models.DNSInfo) []string {
+		var names []string
+		for _, q := range d.Questions {
+			names = append(names, q.Name)
+		}
+		return names
+	}),
+	"dns.qry.type": dnsField(func(d *models.DNSInfo) []string {
+		var types []string
+		for _, q := range d.Questions {
+			types = append(types, q.Type)
+		}
+		return types
+	}),
+	"dns.resp.name": dnsField(func(d *models.DNSInfo) []string {
+		var names []string
+		for _, rr := range d.Answers {
+			names = append(names, rr.Name)
+		}
+		return names
+	}),
+	"dns.resp.data": dnsField(func(d *models.DNSInfo) []string {
+		var data []string
+		for _, rr := range d.Answers {
+			data = append(data, rr.Data)
+		}
+		return data
+	}),
+}
+
+// Protocol names that differ from the names in the protocol stack
+var filterProtocols = map[string]string{
+	"eth":           "ethernet",
+	"ip":            "ipv4",
+	"icmp":          "icmpv4",
+	"vlan":          "dot1q",
+	"_ws.malformed": "malformed",
+}
+
+// FilterFields returns the names of the fields display filters can test,
+// protocol names aside.
+func FilterFields() []string {
+	names := make([]string, 0, len(filterFields))
+	for name := range filterFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseDisplayFilter compiles a display filter. An empty filter matches
+// every packet.
+func ParseDisplayFilter(expr string) (*DisplayFilter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return &DisplayFilter{}, nil
+	}
+
+	parser := &filterParser{tokens: tokens}
+	node, err := parser.or()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(tokens) {
+		return nil, fmt.Errorf("unexpected %q", tokens[parser.pos].text)
+	}
+	return &DisplayFilter{expr: node}, nil
+}
+
+// Match reports whether a packet passes the filter
+func (f *DisplayFilter) Match(p models.Packet) bool {
+	if f == nil || f.expr == nil {
+		return true
+	}
+	return f.expr.match(&p)
+}
+
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, filterToken{text: string(r)})
+			i++
+		case r == '"':
+			var b strings.Builder
+			i++
+			for i < len(runes) && runes[i] != '"' {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+				i++
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, filterToken{text: b.String(), quoted: true})
+			i++
+		case strings.ContainsRune("=!<>&|~", r):
+			j := i + 1
+			for j < len(runes) && strings.ContainsRune("=&|", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, filterToken{text: string(runes[i:j])})
+			i = j
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune("()\"=!<>&|~", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, filterToken{text: string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted {
+		return strings.ToLower(p.tokens[p.pos].text)
+	}
+	return ""
+}
+
+func (p *filterParser) or() (filterNode, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" || p.peek() == "||" {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = filterOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (filterNode, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" || p.peek() == "&&" {
+		p.pos++
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = filterAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) not() (filterNode, error) {
+	if p.peek() == "not" || p.peek() == "!" {
+		p.pos++
+		node, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return filterNot{node}, nil
+	}
+	return p.primary()
+}
+
+var filterOperators = map[string]string{
+	"==": "==", "eq": "==", "!=": "!=", "ne": "!=",
+	">": ">", "gt": ">", "<": "<", "lt": "<",
+	">=": ">=", "ge": ">=", "<=": "<=", "le": "<=",
+	"contains": "contains", "matches": "matches", "~": "matches",
+}
+
+func (p *filterParser) primary() (filterNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of filter")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+
+	if !token.quoted && token.text == "(" {
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return node, nil
+	}
+	if token.quoted {
+		return nil, fmt.Errorf("expected a field, found %q", token.text)
+	}
+
+	name := strings.ToLower(token.text)
+	field, isField := filterFields[name]
+	if !isField {
+		protocol := name
+		if alias, exists := filterProtocols[name]; exists {
+			protocol = alias
+		}
+		if !validFilterProtocol(protocol) {
+			return nil, fmt.Errorf("unknown field %q", token.text)
+		}
+		return filterProtocol(protocol), nil
+	}
+
+	op, isOp := filterOperators[p.peek()]
+	if !isOp {
+		return filterPresent{field}, nil
+	}
+	p.pos++
+	if p.pos >= len(p.tokens) || (!p.tokens[p.pos].quoted && (p.tokens[p.pos].text == "(" || p.tokens[p.pos].text == ")")) {
+		return nil, fmt.Errorf("missing value after %s %s", token.text, op)
+	}
+	value := p.tokens[p.pos].text
+	p.pos++
+
+	cmp := &filterCompare{field: field, op: op, value: value}
+	if op == "matches" {
+		re, err := regexp.Compile("(?i)" + value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", value, err)
+		}
+		cmp.re = re
+	}
+	if _, network, err := net.ParseCIDR(value); err == nil {
+		cmp.network = network
+	}
+	return cmp, nil
+}
+
+// validFilterProtocol reports whether a bare word can name a protocol. Any
+// such word is accepted so protocols without fields still work, while
+// dotted names must be known fields.
+func validFilterProtocol(name string) bool {
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return name != "" && unicode.IsLetter([]rune(name)[0])
+}
+
+type filterOr [2]filterNode
+type filterAnd [2]filterNode
+type filterNot struct{ node filterNode }
+type filterPresent struct{ field filterField }
+type filterProtocol string
+
+func (n filterOr) match(p *models.Packet) bool  { return n[0].match(p) || n[1].match(p) }
+func (n filterAnd) match(p *models.Packet) bool { return n[0].match(p) && n[1].match(p) }
+func (n filterNot) match(p *models.Packet) bool { return !n.node.match(p) }
+func (n filterPresent) match(p *models.Packet) bool {
+	return len(n.field(p)) > 0
+}
+
+func (n filterProtocol) match(p *models.Packet) bool {
+	for _, layer := range p.Layers {
+		if strings.ToLower(layer) == string(n) {
+			return true
+		}
+	}
+	return false
+}
+
+type filterCompare struct {
+	field   filterField
+	op      string
+	value   string
+	re      *regexp.Regexp
+	network *net.IPNet
+}
+
+func (n *filterCompare) match(p *models.Packet) bool {
+	values := n.field(p)
+	if n.op == "!=" {
+		// Negates == so a packet with any matching value is excluded
+		return !(&filterCompare{field: n.field, op: "==", value: n.value, network: n.network}).match(p)
+	}
+	for _, v := range values {
+		if n.test(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *filterCompare) test(v string) bool {
+	switch n.op {
+	case "contains":
+		return strings.Contains(strings.ToLower(v), strings.ToLower(n.value))
+	case "matches":
+		return n.re.MatchString(v)
+	}
+
+	if n.network != nil && n.op == "==" {
+		ip := net.ParseIP(v)
+		return ip != nil && n.network.Contains(ip)
+	}
+	if a, b := net.ParseIP(v), net.ParseIP(n.value); a != nil && b != nil && n.op == "==" {
+		return a.Equal(b)
+	}
+
+	var c int
+	x, errX := strconv.ParseInt(v, 0, 64)
+	y, errY := strconv.ParseInt(n.value, 0, 64)
+	if errX == nil && errY == nil {
+		switch {
+		case x < y:
+			c = -1
+		case x > y:
+			c = 1
+		}
+	} else {
+		c = strings.Compare(strings.ToLower(v), strings.ToLower(n.value))
+	}
+
+	switch n.op {
+	case "==":
+		return c == 0
+	case ">":
+		return c > 0
+	case "<":
+		return c < 0
+	case ">=":
+		return c >= 0
+	case "<=":
+		return c <= 0
+	}
+	return false
+}
+
+func nonEmpty(values ...string) []string {
+	var result []string
+	for _, v := range values {
+		if v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func ipOnly(p *models.Packet, value string) []string {
+	if p.SourceIP == "" {
+		return nil
+	}
+	return []string{value}
+}
+
+func portOf(p *models.Packet, protocol string, ports ...uint16) []string {
+	if p.Protocol != protocol {
+		return nil
+	}
+	var values []string
+	for _, port := range ports {
+		values = append(values, strconv.Itoa(int(port)))
+	}
+	return values
+}
+
+func tcpField(value func(t *models.TCPInfo) uint64) filterField {
+	return func(p *models.Packet) []string {
+		if p.TCP == nil {
+			return nil
+		}
+		return []string{strconv.FormatUint(value(p.TCP), 10)}
+	}
+}
+
+func dnsField(values func(d *models.DNSInfo) []string) filterField {
+	return func(p *models.Packet) []string {
+		if p.DNS == nil {
+			return nil
+		}
+		return values(p.DNS)
+	}
+}
+
+func boolValue(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,167 @@
+package analysis
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Application protocols gopacket leaves as a raw payload or fails to decode,
+// such as DNS over TCP or TLS records split across segments, by well-known
+// port.
+var payloadProtocols = map[uint16]string{
+	21:   "FTP",
+	22:   "SSH",
+	23:   "Telnet",
+	25:   "SMTP",
+	53:   "DNS",
+	80:   "HTTP",
+	110:  "POP",
+	137:  "NBNS",
+	138:  "NetBIOS Datagram",
+	139:  "NetBIOS Session",
+	143:  "IMAP",
+	389:  "LDAP",
+	443:  "TLS",
+	445:  "SMB",
+	1900: "SSDP",
+	3389: "RDP",
+	5353: "mDNS",
+	5355: "LLMNR",
+	8080: "HTTP",
+}
+
+var httpPrefixes = [][]byte{
+	[]byte("GET "), []byte("POST "), []byte("PUT "), []byte("HEAD "), []byte("DELETE "),
+	[]byte("OPTIONS "), []byte("PATCH "), []byte("CONNECT "), []byte("TRACE "), []byte("HTTP/1."),
+}
+
+// ProtocolNode is one level of the protocol hierarchy. A packet is counted
+// at every protocol it contains, so children never exceed their parent.
+type ProtocolNode struct {
+	Name     string          `json:"name"`
+	Packets  int             `json:"packets"`
+	Bytes    int             `json:"bytes"`
+	Percent  float64         `json:"percent"` // Of all packets
+	Children []*ProtocolNode `json:"children,omitempty"`
+
+	children map[string]*ProtocolNode
+}
+
+func newProtocolNode(name string) *ProtocolNode {
+	return &ProtocolNode{Name: name, children: make(map[string]*ProtocolNode)}
+}
+
+func (n *ProtocolNode) add(stack []string, length int) {
+	n.Packets++
+	n.Bytes += length
+	if len(stack) == 0 {
+		return
+	}
+	child, exists := n.children[stack[0]]
+	if !exists {
+		child = newProtocolNode(stack[0])
+		n.children[stack[0]] = child
+	}
+	child.add(stack[1:], length)
+}
+
+// snapshot copies the tree with children ordered by packet count and the
+// percentages filled in.
+func (n *ProtocolNode) snapshot(total int) *ProtocolNode {
+	node := &ProtocolNode{Name: n.Name, Packets: n.Packets, Bytes: n.Bytes}
+	if total > 0 {
+		node.Percent = float64(n.Packets) / float64(total) * 100
+	}
+	for _, child := range n.children {
+		node.Children = append(node.Children, child.snapshot(total))
+	}
+	sort.Slice(node.Children, func(i, j int) bool {
+		if node.Children[i].Packets != node.Children[j].Packets {
+			return node.Children[i].Packets > node.Children[j].Packets
+		}
+		return node.Children[i].Name < node.Children[j].Name
+	})
+	return node
+}
+
+// protocolStack names the protocols of a packet from the outermost layer in.
+// Payloads gopacket does not decode are recognised by content for TLS and
+// HTTP and by port otherwise.
+func protocolStack(packet gopacket.Packet) []string {
+	var stack []string
+	var sport, dport uint16
+	for _, layer := range packet.Layers() {
+		switch l := layer.(type) {
+		case *layers.TCP:
+			sport, dport = uint16(l.SrcPort), uint16(l.DstPort)
+		case *layers.UDP:
+			sport, dport = uint16(l.SrcPort), uint16(l.DstPort)
+		case *layers.ARP:
+			// Whatever follows ARP is Ethernet padding
+			return append(stack, layer.LayerType().String())
+		case *gopacket.Payload:
+			if name := payloadProtocol(l.LayerContents(), sport, dport); name != "" {
+				stack = append(stack, name)
+			}
+			continue
+		case *gopacket.DecodeFailure:
+			if sport == 0 && dport == 0 {
+				stack = append(stack, "Malformed")
+			} else if name := payloadProtocol(l.LayerContents(), sport, dport); name != "" {
+				stack = append(stack, name)
+			}
+			continue
+		}
+		stack = append(stack, layer.LayerType().String())
+	}
+	return stack
+}
+
+func payloadProtocol(payload []byte, sport, dport uint16) string {
+	if len(payload) == 0 {
+		return ""
+	}
+	if len(payload) >= 3 && payload[0] >= 0x14 && payload[0] <= 0x17 && payload[1] == 0x03 {
+		return "TLS"
+	}
+	for _, prefix := range httpPrefixes {
+		if bytes.HasPrefix(payload, prefix) {
+			return "HTTP"
+		}
+	}
+	if name, ok := payloadProtocols[dport]; ok {
+		return name
+	}
+	if name, ok := payloadProtocols[sport]; ok {
+		return name
+	}
+	return "Data"
+}
+
+// packetProtocol is the transport protocol, or for packets without TCP or
+// UDP the protocol carried directly above IP or the link layer, such as
+// ICMP or ARP.
+func packetProtocol(transport string, stack []string) string {
+	if transport != "" {
+		return transport
+	}
+	for i, name := range stack {
+		if name == "IPv4" || name == "IPv6" {
+			if i+1 < len(stack) {
+				return stack[i+1]
+			}
+			return name
+		}
+	}
+	for _, name := range stack {
+		switch name {
+		case "Ethernet", "Dot1Q", "LinuxSLL", "Loopback", "RadioTap", "Dot11", "LLC", "SNAP":
+			continue
+		}
+		return name
+	}
+	return ""
+}
@@ -0,0 +1,372 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HostProfile gathers everything known about one IP address during a time
+// range.
+type HostProfile struct {
+	IP       string
+	Name     string
+	MAC      string
+	Vendor   string
+	OS       OSGuess
+	From     time.Time
+	To       time.Time
+	Endpoint *Endpoint
+
+	// Traffic within the range
+	PacketsSent     int
+	BytesSent       int
+	PacketsReceived int
+	BytesReceived   int
+	Traffic         []TrafficPoint
+
+	Conversations []*Conversation // TCP and UDP
+	Peers         []EndpointPeer
+	DNSQueries    []HostDNSQuery
+	SNIs          []HostCount
+	HTTPHosts     []HostCount
+	JA3           []HostCount
+	JA4           []HostCount
+	Services      []HostService
+	Findings      []*DNSThreat
+}
+
+type HostCount struct {
+	Name  string
+	Count int
+}
+
+// HostDNSQuery is a name the host looked up and how those lookups ended.
+type HostDNSQuery struct {
+	Name     string
+	Type     string
+	Count    int
+	Failures int // Unanswered or not NOERROR
+}
+
+// HostService is a port the host answered on.
+type HostService struct {
+	Protocol    string
+	Port        uint16
+	Service     string
+	Clients     int
+	Connections int
+	Bytes       int
+}
+
+// TrafficPoint is the host's traffic in the interval starting at Time.
+type TrafficPoint struct {
+	Time            time.Time
+	PacketsSent     int
+	BytesSent       int
+	PacketsReceived int
+	BytesReceived   int
+}
+
+// OSGuess is a passive guess at a host's operating system.
+type OSGuess struct {
+	Name     string
+	Evidence []string
+}
+
+const hostTrafficPoints = 120
+
+// HostProfile builds the profile of ip between from and to. Zero times
+// default to the first and last packet of the host. It returns nil if the
+// address is not in the capture.
+func (s *Session) HostProfile(ip string, from, to time.Time) *HostProfile {
+	endpoint := s.Endpoints().Get(ip)
+	if endpoint == nil {
+		return nil
+	}
+	if from.IsZero() {
+		from = endpoint.FirstSeen
+	}
+	if to.IsZero() {
+		to = endpoint.LastSeen
+	}
+
+	profile := &HostProfile{
+		IP:       ip,
+		Name:     endpoint.Name,
+		MAC:      endpoint.MAC,
+		Vendor:   MACVendor(endpoint.MAC),
+		From:     from,
+		To:       to,
+		Endpoint: endpoint,
+	}
+	inRange := func(t time.Time) bool {
+		return !t.Before(from) && !t.After(to)
+	}
+	overlaps := func(first, last time.Time) bool {
+		return !last.Before(from) && !first.After(to)
+	}
+
+	profile.addTraffic(endpoint)
+	profile.addConversations(s.Conversations(), s.NetworkMap().ServicePorts, overlaps)
+
+	queries := make(map[string]*HostDNSQuery)
+	for _, tx := range s.DNS().GetTransactions() {
+		if tx.ClientIP != ip || !inRange(tx.QueryTime) {
+			continue
+		}
+		key := tx.Name + "|" + tx.Type
+		query, exists := queries[key]
+		if !exists {
+			query = &HostDNSQuery{Name: tx.Name, Type: tx.Type}
+			queries[key] = query
+		}
+		query.Count++
+		if tx.Failed() {
+			query.Failures++
+		}
+	}
+	for _, query := range queries {
+		profile.DNSQueries = append(profile.DNSQueries, *query)
+	}
+	sort.Slice(profile.DNSQueries, func(i, j int) bool {
+		if profile.DNSQueries[i].Count != profile.DNSQueries[j].Count {
+			return profile.DNSQueries[i].Count > profile.DNSQueries[j].Count
+		}
+		return profile.DNSQueries[i].Name < profile.DNSQueries[j].Name
+	})
+
+	snis, ja3, ja4 := make(map[string]int), make(map[string]int), make(map[string]int)
+	for _, session := range s.TLS().GetSessions() {
+		stream := s.streams.Get(session.StreamIndex)
+		if session.ClientIP != ip || stream == nil || !inRange(stream.StartTime) {
+			continue
+		}
+		if session.SNI != "" {
+			snis[session.SNI]++
+		}
+		if session.JA3Hash != "" {
+			ja3[session.JA3Hash]++
+		}
+		if session.JA4 != "" {
+			ja4[session.JA4]++
+		}
+	}
+	profile.SNIs, profile.JA3, profile.JA4 = hostCounts(snis), hostCounts(ja3), hostCounts(ja4)
+
+	hosts := make(map[string]int)
+	var userAgents []string
+	for _, tx := range s.HTTP().GetTransactions() {
+		if tx.ClientIP != ip || !inRange(tx.RequestTime) {
+			continue
+		}
+		if tx.Host != "" {
+			hosts[tx.Host]++
+		}
+		if tx.UserAgent != "" {
+			userAgents = append(userAgents, tx.UserAgent)
+		}
+	}
+	profile.HTTPHosts = hostCounts(hosts)
+	profile.OS = guessOS(endpoint.TTL, endpoint.SYNWindow, userAgents)
+
+	for _, threat := range s.DNSThreats().Findings() {
+		if contains(threat.Evidence.Clients, ip) && overlaps(threat.Evidence.FirstSeen, threat.Evidence.LastSeen) {
+			profile.Findings = append(profile.Findings, threat)
+		}
+	}
+	return profile
+}
+
+// addTraffic sums the host's per-second traffic into at most
+// hostTrafficPoints intervals covering the range.
+func (p *HostProfile) addTraffic(endpoint *Endpoint) {
+	start, end := p.From.Unix(), p.To.Unix()
+	if end < start {
+		return
+	}
+	width := int64(math.Ceil(float64(end-start+1) / hostTrafficPoints))
+	if width < 1 {
+		width = 1
+	}
+
+	points := make([]TrafficPoint, (end-start)/width+1)
+	for i := range points {
+		points[i].Time = time.Unix(start+int64(i)*width, 0).In(p.From.Location())
+	}
+	for second, bucket := range endpoint.Traffic {
+		if second < start || second > end {
+			continue
+		}
+		point := &points[(second-start)/width]
+		point.PacketsSent += bucket.PacketsSent
+		point.BytesSent += bucket.BytesSent
+		point.PacketsReceived += bucket.PacketsReceived
+		point.BytesReceived += bucket.BytesReceived
+
+		p.PacketsSent += bucket.PacketsSent
+		p.BytesSent += bucket.BytesSent
+		p.PacketsReceived += bucket.PacketsReceived
+		p.BytesReceived += bucket.BytesReceived
+	}
+	p.Traffic = points
+}
+
+// addConversations collects the host's TCP and UDP conversations, its peers
+// from the IP-level conversations, and the services it answered on.
+func (p *HostProfile) addConversations(tracker *ConversationTracker, servicePorts map[uint16]string, overlaps func(first, last time.Time) bool) {
+	type serviceKey struct {
+		protocol string
+		port     uint16
+	}
+	services := make(map[serviceKey]*HostService)
+	clients := make(map[serviceKey]map[string]bool)
+	peers := make(map[string]int)
+
+	tracker.mu.Lock()
+	for _, conv := range tracker.Conversations {
+		if (conv.SourceIP != p.IP && conv.DestIP != p.IP) || !overlaps(conv.FirstSeen, conv.LastSeen) {
+			continue
+		}
+		switch conv.Type {
+		case ConversationIPv4, ConversationIPv6:
+			peer := conv.DestIP
+			if peer == p.IP {
+				peer = conv.SourceIP
+			}
+			peers[peer] += conv.PacketCount
+		case ConversationTCP, ConversationUDP:
+			p.Conversations = append(p.Conversations, conv)
+			// A reply from the host means it offers a service on that port
+			if conv.DestIP != p.IP || conv.PacketsBA == 0 {
+				continue
+			}
+			key := serviceKey{conv.Type, conv.DestPort}
+			service, exists := services[key]
+			if !exists {
+				service = &HostService{Protocol: conv.Type, Port: conv.DestPort, Service: servicePorts[conv.DestPort]}
+				services[key] = service
+				clients[key] = make(map[string]bool)
+			}
+			service.Connections++
+			service.Bytes += conv.TotalBytes
+			clients[key][conv.SourceIP] = true
+		}
+	}
+	tracker.mu.Unlock()
+
+	sort.Slice(p.Conversations, func(i, j int) bool {
+		return p.Conversations[i].FirstSeen.Before(p.Conversations[j].FirstSeen)
+	})
+	for address, packets := range peers {
+		p.Peers = append(p.Peers, EndpointPeer{Address: address, Packets: packets})
+	}
+	sort.Slice(p.Peers, func(i, j int) bool {
+		if p.Peers[i].Packets != p.Peers[j].Packets {
+			return p.Peers[i].Packets > p.Peers[j].Packets
+		}
+		return compareIPs(p.Peers[i].Address, p.Peers[j].Address) < 0
+	})
+	for key, service := range services {
+		service.Clients = len(clients[key])
+		p.Services = append(p.Services, *service)
+	}
+	sort.Slice(p.Services, func(i, j int) bool {
+		if p.Services[i].Port != p.Services[j].Port {
+			return p.Services[i].Port < p.Services[j].Port
+		}
+		return p.Services[i].Protocol < p.Services[j].Protocol
+	})
+}
+
+func hostCounts(counts map[string]int) []HostCount {
+	result := make([]HostCount, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, HostCount{Name: name, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// User-Agent tokens naming an operating system, most specific first
+var userAgentSystems = []struct {
+	token string
+	name  string
+}{
+	{"Windows NT", "Windows"},
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// guessOS combines the initial TTL and SYN window of the host with the
+// operating systems its browsers claim. The User-Agent is more specific when
+// present; TTL alone only tells the system families apart.
+func guessOS(ttl uint8, window uint16, userAgents []string) OSGuess {
+	var guess OSGuess
+
+	claimed := make(map[string]int)
+	for _, ua := range userAgents {
+		for _, system := range userAgentSystems {
+			if strings.Contains(ua, system.token) {
+				claimed[system.name]++
+				break
+			}
+		}
+	}
+	best := ""
+	for name, count := range claimed {
+		if best == "" || count > claimed[best] || (count == claimed[best] && name < best) {
+			best = name
+		}
+	}
+	if best != "" {
+		guess.Name = best
+		guess.Evidence = append(guess.Evidence, fmt.Sprintf("User-Agent claims %s in %d of %d requests", best, claimed[best], len(userAgents)))
+	}
+
+	if ttl == 0 {
+		return guess
+	}
+	var family string
+	switch initial := initialTTL(ttl); initial {
+	case 64:
+		family = "Linux/Unix"
+		if window == 65535 {
+			family = "macOS/iOS/BSD"
+		}
+	case 128:
+		family = "Windows"
+	case 255:
+		family = "Network device"
+	}
+	evidence := fmt.Sprintf("SYN TTL %d (initial %d), window %d", ttl, initialTTL(ttl), window)
+	if family != "" {
+		evidence += " suggests " + family
+	}
+	guess.Evidence = append(guess.Evidence, evidence)
+	if guess.Name == "" {
+		guess.Name = family
+	}
+	return guess
+}
+
+// initialTTL rounds an observed TTL up to the common starting value
+func initialTTL(ttl uint8) int {
+	for _, initial := range []int{32, 64, 128} {
+		if int(ttl) <= initial {
+			return initial
+		}
+	}
+	return 255
+}
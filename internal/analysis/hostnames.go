@@ -0,0 +1,176 @@
+package analysis
+
+import (
+	"encoding/binary"
+	"github.com/shreethaar/heroPacket/internal/models"
+	"net"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	mdnsPort = 5353
+	nbnsPort = 137
+
+	nbnsTypeNB   = 0x20
+	nbnsGroupBit = 0x8000
+)
+
+// extractHostNames collects the names hosts announce for themselves over
+// mDNS and NBNS, or send to the DHCP server.
+func extractHostNames(packet gopacket.Packet) []models.HostName {
+	udpLayer := packet.Layer(layers.LayerTypeUDP)
+	if udpLayer == nil {
+		return nil
+	}
+	udp, _ := udpLayer.(*layers.UDP)
+
+	if dhcpLayer := packet.Layer(layers.LayerTypeDHCPv4); dhcpLayer != nil {
+		dhcp, _ := dhcpLayer.(*layers.DHCPv4)
+		return dhcpHostNames(dhcp)
+	}
+	switch {
+	case udp.SrcPort == mdnsPort || udp.DstPort == mdnsPort:
+		return mdnsHostNames(udp.Payload)
+	case udp.SrcPort == nbnsPort || udp.DstPort == nbnsPort:
+		return nbnsHostNames(udp.Payload)
+	}
+	return nil
+}
+
+// dhcpHostNames binds the Host Name option to the address the client has,
+// asks for, or is offered.
+func dhcpHostNames(dhcp *layers.DHCPv4) []models.HostName {
+	var hostname string
+	ip := dhcp.ClientIP
+	for _, opt := range dhcp.Options {
+		switch opt.Type {
+		case layers.DHCPOptHostname:
+			hostname = strings.TrimRight(string(opt.Data), "\x00")
+		case layers.DHCPOptRequestIP:
+			if ip.IsUnspecified() && len(opt.Data) == net.IPv4len {
+				ip = net.IP(opt.Data)
+			}
+		}
+	}
+	if ip.IsUnspecified() {
+		ip = dhcp.YourClientIP
+	}
+	if hostname == "" || ip == nil || ip.IsUnspecified() {
+		return nil
+	}
+	return []models.HostName{{IP: ip.String(), Name: hostname, Source: "DHCP"}}
+}
+
+// mdnsHostNames returns the address records of an mDNS response.
+func mdnsHostNames(payload []byte) []models.HostName {
+	dns := &layers.DNS{}
+	if err := dns.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil || !dns.QR {
+		return nil
+	}
+
+	var names []models.HostName
+	records := append(append([]layers.DNSResourceRecord(nil), dns.Answers...), dns.Additionals...)
+	for _, rr := range records {
+		if rr.Type == layers.DNSTypeA || rr.Type == layers.DNSTypeAAAA {
+			names = append(names, models.HostName{IP: rr.IP.String(), Name: dnsName(rr.Name), Source: "mDNS"})
+		}
+	}
+	return names
+}
+
+// nbnsHostNames returns the unique NetBIOS names bound to addresses in
+// registrations and query responses. NBNS reuses the DNS message layout but
+// encodes names and address records its own way (RFC 1002).
+func nbnsHostNames(payload []byte) []models.HostName {
+	if len(payload) < 12 {
+		return nil
+	}
+	questions := int(binary.BigEndian.Uint16(payload[4:]))
+	records := int(binary.BigEndian.Uint16(payload[6:])) + int(binary.BigEndian.Uint16(payload[8:])) + int(binary.BigEndian.Uint16(payload[10:]))
+
+	offset := 12
+	var questionName string
+	for i := 0; i < questions; i++ {
+		name, next, ok := nbnsName(payload, offset)
+		if !ok || next+4 > len(payload) {
+			return nil
+		}
+		questionName = name
+		offset = next + 4
+	}
+
+	var names []models.HostName
+	for i := 0; i < records; i++ {
+		var name string
+		next := offset + 2
+		if offset < len(payload) && payload[offset]&0xc0 == 0xc0 {
+			name = questionName // Compression pointer back to the question
+		} else {
+			var ok bool
+			if name, next, ok = nbnsName(payload, offset); !ok {
+				break
+			}
+		}
+		if next+10 > len(payload) {
+			break
+		}
+		rrType := binary.BigEndian.Uint16(payload[next:])
+		length := int(binary.BigEndian.Uint16(payload[next+8:]))
+		rdata := payload[next+10:]
+		if length > len(rdata) {
+			break
+		}
+		rdata = rdata[:length]
+		offset = next + 10 + length
+
+		if rrType != nbnsTypeNB || name == "" {
+			continue
+		}
+		for j := 0; j+6 <= len(rdata); j += 6 {
+			if binary.BigEndian.Uint16(rdata[j:])&nbnsGroupBit != 0 {
+				continue // Workgroup and domain names are shared
+			}
+			ip := net.IP(rdata[j+2 : j+6])
+			if !ip.IsUnspecified() {
+				names = append(names, models.HostName{IP: ip.String(), Name: name, Source: "NBNS"})
+			}
+		}
+	}
+	return names
+}
+
+// nbnsName decodes a first-level encoded NetBIOS name. Only workstation and
+// server names are returned; other suffixes name services rather than hosts.
+func nbnsName(data []byte, offset int) (string, int, bool) {
+	if offset >= len(data) {
+		return "", 0, false
+	}
+	length := int(data[offset])
+	end := offset + 1 + length
+	if end >= len(data) {
+		return "", 0, false
+	}
+	encoded := data[offset+1 : end]
+
+	// Skip the scope ID labels that may follow
+	next := end
+	for next < len(data) && data[next] != 0 {
+		next += 1 + int(data[next])
+	}
+	next++
+	if next > len(data) || length != 32 {
+		return "", next, next <= len(data)
+	}
+
+	decoded := make([]byte, 16)
+	for i := range decoded {
+		decoded[i] = (encoded[2*i]-'A')<<4 | (encoded[2*i+1] - 'A')
+	}
+	if suffix := decoded[15]; suffix != 0x00 && suffix != 0x20 {
+		return "", next, true
+	}
+	return strings.TrimRight(string(decoded[:15]), " "), next, true
+}
@@ -1,16 +1,62 @@
 package analysis
 
 import (
-	"heroPacket/internal/models"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/models"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 type HTTPAnalyzer struct {
-	mu          sync.Mutex
-	Methods     map[string]int // HTTP method -> count
-	StatusCodes map[int]int    // Status code -> count
-	Hosts       map[string]int // Host -> count
-	UserAgents  map[string]int // User-Agent -> count
+	mu           sync.Mutex
+	Methods      map[string]int // HTTP method -> count
+	StatusCodes  map[int]int    // Status code -> count
+	Hosts        map[string]int // Host -> count
+	UserAgents   map[string]int // User-Agent -> count
+	URIs         map[string]int // Host + path -> count
+	Transactions []*HTTPTransaction
+}
+
+// HTTPTransaction pairs an HTTP/1.x request with the response it received.
+// Status is zero when the response is missing from the capture.
+type HTTPTransaction struct {
+	StreamIndex    int
+	ClientIP       string
+	ServerIP       string
+	ServerPort     uint16
+	Method         string
+	Host           string
+	URI            string
+	UserAgent      string
+	Status         int
+	ContentType    string
+	RequestSize    int // Request body bytes as sent
+	ResponseSize   int // Response body bytes after removing chunking
+	DecodedSize    int // Response body bytes after content decoding, up to MaxHTTPBody
+	RequestTime    time.Time
+	ResponseTime   time.Time
+	RequestPacket  int // Packet carrying the start of the request
+	ResponsePacket int // Packet carrying the start of the response, zero if none
+	Latency        time.Duration
+	BodyTruncated  bool // Decoding stopped at MaxHTTPBody bytes
+}
+
+// MaxHTTPBody caps the decoding of a response body, since a small
+// compressed body can expand to any size
+const MaxHTTPBody = 16 << 20
+
+type HTTPCount struct {
+	Name  string
+	Count int
 }
 
 func NewHTTPAnalyzer() *HTTPAnalyzer {
@@ -19,11 +65,309 @@ func NewHTTPAnalyzer() *HTTPAnalyzer {
 		StatusCodes: make(map[int]int),
 		Hosts:       make(map[string]int),
 		UserAgents:  make(map[string]int),
+		URIs:        make(map[string]int),
 	}
 }
 
+// Process is a no-op: HTTP messages span several segments, so they are
+// parsed from reassembled streams in ProcessStream instead.
 func (h *HTTPAnalyzer) Process(packet models.Packet) {
-	// Add HTTP packet processing logic
-	// This would require extending the models.Packet struct
-	// to include HTTP-specific fields
+}
+
+var httpMethods = []string{"GET ", "POST ", "PUT ", "DELETE ", "HEAD ", "OPTIONS ", "PATCH ", "CONNECT ", "TRACE "}
+
+// ProcessStream parses every request and response carried by a TCP stream
+// and pairs them in order, which also covers pipelined requests. Decrypted
+// TLS streams are parsed from their plaintext.
+func (h *HTTPAnalyzer) ProcessStream(stream *Stream) {
+	if stream.Protocol != "TCP" {
+		return
+	}
+	if stream.Decrypted != nil {
+		stream = stream.Decrypted
+	}
+	h.processPayload(stream, stream.Data(ClientToServer), stream.Data(ServerToClient))
+}
+
+func (h *HTTPAnalyzer) processPayload(stream *Stream, client, server []byte) {
+	if !looksLikeHTTPRequest(client) {
+		return
+	}
+
+	transactions := parseHTTPRequests(stream, client)
+	if len(transactions) == 0 {
+		return
+	}
+	parseHTTPResponses(stream, server, transactions)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, tx := range transactions {
+		h.Methods[tx.Method]++
+		if tx.Host != "" {
+			h.Hosts[tx.Host]++
+		}
+		if tx.UserAgent != "" {
+			h.UserAgents[tx.UserAgent]++
+		}
+		h.URIs[tx.Host+tx.URI]++
+		if tx.Status != 0 {
+			h.StatusCodes[tx.Status]++
+		}
+		h.Transactions = append(h.Transactions, tx)
+	}
+}
+
+func looksLikeHTTPRequest(data []byte) bool {
+	for _, method := range httpMethods {
+		if bytes.HasPrefix(data, []byte(method)) {
+			return true
+		}
+	}
+	return false
+}
+
+// countingReader tracks how many bytes have been consumed so message
+// boundaries can be mapped back to packet timestamps.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// countingWriter tracks how many bytes have been written through it
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+func parseHTTPRequests(stream *Stream, data []byte) []*HTTPTransaction {
+	counter := &countingReader{r: bytes.NewReader(data)}
+	reader := bufio.NewReader(counter)
+
+	var transactions []*HTTPTransaction
+	for {
+		start := counter.n - reader.Buffered()
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			break
+		}
+		size, _ := io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+		end := counter.n - reader.Buffered()
+
+		transactions = append(transactions, &HTTPTransaction{
+			StreamIndex:   stream.Index,
+			ClientIP:      stream.ClientIP,
+			ServerIP:      stream.ServerIP,
+			ServerPort:    stream.ServerPort,
+			Method:        req.Method,
+			Host:          req.Host,
+			URI:           req.RequestURI,
+			UserAgent:     req.UserAgent(),
+			RequestSize:   int(size),
+			RequestTime:   stream.TimeAt(ClientToServer, start),
+			RequestPacket: stream.PacketAt(ClientToServer, start),
+		})
+		// Latency is measured from the last byte of the request.
+		if end > start {
+			transactions[len(transactions)-1].RequestTime = stream.TimeAt(ClientToServer, end-1)
+		}
+	}
+	return transactions
+}
+
+func parseHTTPResponses(stream *Stream, data []byte, transactions []*HTTPTransaction) {
+	counter := &countingReader{r: bytes.NewReader(data)}
+	reader := bufio.NewReader(counter)
+
+	for _, tx := range transactions {
+		start := counter.n - reader.Buffered()
+		resp, err := http.ReadResponse(reader, &http.Request{Method: tx.Method})
+		if err != nil {
+			return
+		}
+		// Informational responses precede the real one.
+		for resp.StatusCode >= 100 && resp.StatusCode < 200 && resp.StatusCode != http.StatusSwitchingProtocols {
+			start = counter.n - reader.Buffered()
+			if resp, err = http.ReadResponse(reader, &http.Request{Method: tx.Method}); err != nil {
+				return
+			}
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		tx.Status = resp.StatusCode
+		tx.ContentType = resp.Header.Get("Content-Type")
+		tx.ResponseSize = len(body)
+		tx.DecodedSize, tx.BodyTruncated = decodedHTTPSize(body, resp.Header.Get("Content-Encoding"))
+		tx.ResponseTime = stream.TimeAt(ServerToClient, start)
+		tx.ResponsePacket = stream.PacketAt(ServerToClient, start)
+		tx.Latency = tx.ResponseTime.Sub(tx.RequestTime)
+
+		if resp.StatusCode == http.StatusSwitchingProtocols {
+			return
+		}
+	}
+}
+
+// decodedHTTPSize returns the size of a body once its gzip or deflate
+// content encoding is undone, or its own size when it cannot be decoded.
+// It reports whether decoding stopped at MaxHTTPBody bytes.
+func decodedHTTPSize(body []byte, encoding string) (int, bool) {
+	var r io.Reader
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return len(body), false
+		}
+		r = gz
+	case "deflate":
+		r = flate.NewReader(bytes.NewReader(body))
+	default:
+		return len(body), false
+	}
+
+	// Reading one byte past the cap tells a body of exactly MaxHTTPBody
+	// bytes from a longer one
+	counter := &countingWriter{w: io.Discard}
+	_, err := io.Copy(counter, io.LimitReader(r, MaxHTTPBody+1))
+	if err != nil && counter.n == 0 {
+		return len(body), false
+	}
+	if counter.n > MaxHTTPBody {
+		return MaxHTTPBody, true
+	}
+	return counter.n, false
+}
+
+// AddNames adds the servers the requests named by host name rather than
+// by address
+func (h *HTTPAnalyzer) AddNames(names *NameResolver) {
+	for _, tx := range h.GetTransactions() {
+		host := tx.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		if net.ParseIP(host) == nil {
+			names.Add(tx.ServerIP, host, "HTTP Host", tx.RequestTime)
+		}
+	}
+}
+
+func (h *HTTPAnalyzer) TopHosts(n int) []HTTPCount {
+	return h.top(h.Hosts, n)
+}
+
+func (h *HTTPAnalyzer) TopURIs(n int) []HTTPCount {
+	return h.top(h.URIs, n)
+}
+
+func (h *HTTPAnalyzer) TopUserAgents(n int) []HTTPCount {
+	return h.top(h.UserAgents, n)
+}
+
+func (h *HTTPAnalyzer) top(m map[string]int, n int) []HTTPCount {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var counts []HTTPCount
+	for name, count := range m {
+		counts = append(counts, HTTPCount{Name: name, Count: count})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Name < counts[j].Name
+	})
+
+	if len(counts) > n {
+		return counts[:n]
+	}
+	return counts
+}
+
+// ErrorRates returns the share of responses with 4xx and 5xx status codes.
+func (h *HTTPAnalyzer) ErrorRates() (client, server float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	total, clientErrors, serverErrors := 0, 0, 0
+	for code, count := range h.StatusCodes {
+		total += count
+		switch {
+		case code >= 500:
+			serverErrors += count
+		case code >= 400:
+			clientErrors += count
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	return float64(clientErrors) / float64(total), float64(serverErrors) / float64(total)
+}
+
+// GetTransactions returns every transaction in the order requests were sent.
+func (h *HTTPAnalyzer) GetTransactions() []*HTTPTransaction {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	transactions := make([]*HTTPTransaction, len(h.Transactions))
+	copy(transactions, h.Transactions)
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].RequestTime.Before(transactions[j].RequestTime)
+	})
+	return transactions
+}
+
+// ExpertItems reports every request, and responses with error status codes
+func (h *HTTPAnalyzer) ExpertItems() []ExpertItem {
+	var items []ExpertItem
+	for _, tx := range h.GetTransactions() {
+		request := tx.Method + " " + tx.Host + tx.URI
+		items = append(items, ExpertItem{
+			Severity: ExpertChat,
+			Group:    ExpertSequence,
+			Protocol: "HTTP",
+			Summary:  tx.Method + " request",
+			Detail:   request,
+			Packet:   tx.RequestPacket,
+			Time:     tx.RequestTime,
+		})
+
+		item := ExpertItem{
+			Group:    ExpertProtocol,
+			Protocol: "HTTP",
+			Detail:   fmt.Sprintf("%d %s", tx.Status, request),
+			Packet:   tx.ResponsePacket,
+			Time:     tx.ResponseTime,
+		}
+		switch {
+		case tx.Status >= 500:
+			item.Severity, item.Summary = ExpertWarn, "Server error response (5xx)"
+		case tx.Status >= 400:
+			item.Severity, item.Summary = ExpertNote, "Client error response (4xx)"
+		default:
+			continue
+		}
+		items = append(items, item)
+	}
+	return items
 }
@@ -0,0 +1,588 @@
+package analysis
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Capture file formats
+const (
+	FormatPcap   = "pcap"
+	FormatPcapNG = "pcapng"
+)
+
+const (
+	pcapMagicMicro = 0xa1b2c3d4
+	pcapMagicNano  = 0xa1b23c4d
+
+	pcapngInterface      = 0x00000001
+	pcapngPacket         = 0x00000002 // Obsolete, still written by old tools
+	pcapngSimplePacket   = 0x00000003
+	pcapngEnhancedPacket = 0x00000006
+
+	indexMagic   = "HPIX"
+	indexVersion = 1
+)
+
+// IndexEntry locates one packet record in a capture file.
+type IndexEntry struct {
+	Offset        int64 // Of the record or block
+	Timestamp     time.Time
+	Interface     int // Into PacketIndex.Interfaces
+	CaptureLength int
+	Length        int // On the wire
+	header        int // Bytes from Offset to the packet data
+}
+
+// IndexInterface is a capture interface, of which classic pcap files have one.
+type IndexInterface struct {
+	LinkType layers.LinkType
+	SnapLen  int
+}
+
+// PacketIndex maps packet numbers to their records in a capture so single
+// packets and ranges can be read without going through the whole file. It
+// is built on first analysis and kept next to the capture.
+type PacketIndex struct {
+	Format     string
+	Interfaces []IndexInterface
+	Entries    []IndexEntry // Packet number N is Entries[N-1]
+
+	path   string
+	size   int64
+	mtime  time.Time
+	sorted bool // Timestamps never go backwards
+	order  binary.ByteOrder
+}
+
+// On-disk layout of the index: a header, the interfaces' link types and
+// snap lengths, then one fixed-size record per packet, little endian.
+type indexHeader struct {
+	Magic      [4]byte
+	Version    uint32
+	Size       int64
+	ModTime    int64
+	Format     uint32 // 0 pcap, 1 pcapng
+	BigEndian  uint32 // Byte order of a pcap file
+	Interfaces uint32
+	Packets    uint32
+}
+
+type indexInterface struct {
+	LinkType uint32
+	SnapLen  uint32
+}
+
+type indexRecord struct {
+	Offset        int64
+	Timestamp     int64
+	Interface     uint32
+	CaptureLength uint32
+	Length        uint32
+	Header        uint32
+}
+
+// PacketIndexPath returns where the index of an uploaded capture is kept.
+func PacketIndexPath(capturePath string) string {
+	return capturePath + ".idx"
+}
+
+// LoadPacketIndex returns the index of a capture, reading it from indexPath
+// when it is up to date and building and saving it there otherwise. With no
+// indexPath it is only built. Failing to save it is logged, not returned.
+func LoadPacketIndex(capturePath, indexPath string) (*PacketIndex, error) {
+	if indexPath == "" {
+		return BuildPacketIndex(capturePath)
+	}
+	info, err := os.Stat(capturePath)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := readPacketIndex(capturePath, indexPath)
+	if err == nil && index.size == info.Size() && index.mtime.Equal(info.ModTime()) {
+		return index, nil
+	}
+
+	index, err = BuildPacketIndex(capturePath)
+	if err != nil {
+		return nil, err
+	}
+	// The index is only a cache, so one that cannot be written is rebuilt
+	// next time instead
+	if err := index.Save(indexPath); err != nil {
+		log.Printf("Error saving the packet index of %s: %v", capturePath, err)
+	}
+	return index, nil
+}
+
+// BuildPacketIndex reads the records of a pcap or pcapng file. A record cut
+// short at the end of the file is left out, as libpcap does.
+func BuildPacketIndex(capturePath string) (*PacketIndex, error) {
+	file, err := os.Open(capturePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	index := &PacketIndex{path: capturePath, size: info.Size(), mtime: info.ModTime(), sorted: true}
+
+	reader := bufio.NewReader(file)
+	magic, err := reader.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a capture file", capturePath)
+	}
+	switch {
+	case binary.LittleEndian.Uint32(magic) == pcapngSectionHeader:
+		index.Format = FormatPcapNG
+		err = index.scanPcapNG(reader)
+	case binary.LittleEndian.Uint32(magic) == pcapMagicMicro || binary.LittleEndian.Uint32(magic) == pcapMagicNano:
+		index.Format = FormatPcap
+		index.order = binary.LittleEndian
+		err = index.scanPcap(reader)
+	case binary.BigEndian.Uint32(magic) == pcapMagicMicro || binary.BigEndian.Uint32(magic) == pcapMagicNano:
+		index.Format = FormatPcap
+		index.order = binary.BigEndian
+		err = index.scanPcap(reader)
+	default:
+		return nil, fmt.Errorf("%s is not a pcap or pcapng file", capturePath)
+	}
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return index, nil
+}
+
+func (ix *PacketIndex) scanPcap(reader *bufio.Reader) error {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return err
+	}
+	nano := ix.order.Uint32(header[0:4]) == pcapMagicNano
+	ix.Interfaces = []IndexInterface{{
+		LinkType: layers.LinkType(ix.order.Uint32(header[20:24]) & 0xffff),
+		SnapLen:  int(ix.order.Uint32(header[16:20])),
+	}}
+
+	offset := int64(24)
+	record := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(reader, record); err != nil {
+			return err
+		}
+		sec, frac := int64(ix.order.Uint32(record[0:4])), int64(ix.order.Uint32(record[4:8]))
+		if !nano {
+			frac *= 1000
+		}
+		captured := int(ix.order.Uint32(record[8:12]))
+		if _, err := reader.Discard(captured); err != nil {
+			return err
+		}
+		ix.add(IndexEntry{
+			Offset:        offset,
+			Timestamp:     time.Unix(sec, frac),
+			CaptureLength: captured,
+			Length:        int(ix.order.Uint32(record[12:16])),
+			header:        16,
+		})
+		offset += 16 + int64(captured)
+	}
+}
+
+// pcapngIface is an interface of the current section, which numbers
+// its interfaces from zero
+type pcapngIface struct {
+	index      int     // Into PacketIndex.Interfaces
+	resolution float64 // Timestamp units per second
+	offset     int64   // Seconds added to timestamps
+}
+
+func (ix *PacketIndex) scanPcapNG(reader *bufio.Reader) error {
+	var order binary.ByteOrder = binary.LittleEndian
+	var section []pcapngIface
+	offset := int64(0)
+	header := make([]byte, 8)
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint32(header[0:4]) == pcapngSectionHeader {
+			magic, err := reader.Peek(4)
+			if err != nil {
+				return err
+			}
+			if binary.BigEndian.Uint32(magic) == pcapngByteOrderMagic {
+				order = binary.BigEndian
+			} else {
+				order = binary.LittleEndian
+			}
+			section = nil
+		}
+
+		blockType := order.Uint32(header[0:4])
+		length := int(order.Uint32(header[4:8]))
+		if length < 12 || length%4 != 0 {
+			return fmt.Errorf("invalid pcapng block length %d", length)
+		}
+		// The length comes from the file, so a block running past its end
+		// is cut short rather than allocated
+		if int64(length) > ix.size-offset {
+			return io.ErrUnexpectedEOF
+		}
+		body := make([]byte, length-8)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return err
+		}
+		body = body[:len(body)-4] // Trailing copy of the length
+
+		switch blockType {
+		case pcapngInterface:
+			if len(body) < 8 {
+				return errors.New("short pcapng interface block")
+			}
+			iface := pcapngIface{index: len(ix.Interfaces), resolution: 1e6}
+			for _, opt := range pcapngOptions(body[8:], order) {
+				switch {
+				case opt.code == 9 && len(opt.value) == 1: // if_tsresol
+					if opt.value[0]&0x80 != 0 {
+						iface.resolution = math.Pow(2, float64(opt.value[0]&0x7f))
+					} else {
+						iface.resolution = math.Pow(10, float64(opt.value[0]))
+					}
+				case opt.code == 14 && len(opt.value) == 8: // if_tsoffset
+					iface.offset = int64(order.Uint64(opt.value))
+				}
+			}
+			section = append(section, iface)
+			ix.Interfaces = append(ix.Interfaces, IndexInterface{
+				LinkType: layers.LinkType(order.Uint16(body[0:2])),
+				SnapLen:  int(order.Uint32(body[4:8])),
+			})
+
+		case pcapngEnhancedPacket, pcapngPacket:
+			if len(body) < 20 {
+				return errors.New("short pcapng packet block")
+			}
+			id := int(order.Uint32(body[0:4]))
+			if blockType == pcapngPacket {
+				id = int(order.Uint16(body[0:2]))
+			}
+			if id >= len(section) {
+				return fmt.Errorf("pcapng packet for undeclared interface %d", id)
+			}
+			iface := section[id]
+			ts := uint64(order.Uint32(body[4:8]))<<32 | uint64(order.Uint32(body[8:12]))
+			captured := int(order.Uint32(body[12:16]))
+			if 20+captured > len(body) {
+				return errors.New("pcapng packet longer than its block")
+			}
+			ix.add(IndexEntry{
+				Offset:        offset,
+				Timestamp:     iface.timestamp(ts),
+				Interface:     iface.index,
+				CaptureLength: captured,
+				Length:        int(order.Uint32(body[16:20])),
+				header:        28,
+			})
+
+		case pcapngSimplePacket:
+			if len(body) < 4 || len(section) == 0 {
+				return errors.New("invalid pcapng simple packet block")
+			}
+			// Simple packets belong to the first interface and carry no
+			// timestamp
+			wire := int(order.Uint32(body[0:4]))
+			captured := wire
+			if snap := ix.Interfaces[section[0].index].SnapLen; snap > 0 && captured > snap {
+				captured = snap
+			}
+			if 4+captured > len(body) {
+				captured = len(body) - 4
+			}
+			ix.add(IndexEntry{
+				Offset:        offset,
+				Interface:     section[0].index,
+				CaptureLength: captured,
+				Length:        wire,
+				header:        12,
+			})
+		}
+		offset += int64(length)
+	}
+}
+
+func (iface pcapngIface) timestamp(units uint64) time.Time {
+	sec := units / uint64(iface.resolution)
+	frac := float64(units%uint64(iface.resolution)) / iface.resolution
+	return time.Unix(int64(sec)+iface.offset, int64(frac*1e9))
+}
+
+type pcapngOption struct {
+	code  int
+	value []byte
+}
+
+func pcapngOptions(data []byte, order binary.ByteOrder) []pcapngOption {
+	var options []pcapngOption
+	for len(data) >= 4 {
+		code := int(order.Uint16(data[0:2]))
+		length := int(order.Uint16(data[2:4]))
+		if code == 0 || 4+length > len(data) {
+			break
+		}
+		options = append(options, pcapngOption{code: code, value: data[4 : 4+length]})
+		data = data[4+(length+3)/4*4:]
+	}
+	return options
+}
+
+func (ix *PacketIndex) add(entry IndexEntry) {
+	if n := len(ix.Entries); n > 0 && entry.Timestamp.Before(ix.Entries[n-1].Timestamp) {
+		ix.sorted = false
+	}
+	ix.Entries = append(ix.Entries, entry)
+}
+
+// Save writes the index to a file, such as PacketIndexPath of its capture.
+func (ix *PacketIndex) Save(indexPath string) error {
+	file, err := os.Create(indexPath)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+
+	header := indexHeader{
+		Version:    indexVersion,
+		Size:       ix.size,
+		ModTime:    ix.mtime.UnixNano(),
+		Interfaces: uint32(len(ix.Interfaces)),
+		Packets:    uint32(len(ix.Entries)),
+	}
+	copy(header.Magic[:], indexMagic)
+	if ix.Format == FormatPcapNG {
+		header.Format = 1
+	}
+	if ix.order == binary.BigEndian {
+		header.BigEndian = 1
+	}
+
+	interfaces := make([]indexInterface, len(ix.Interfaces))
+	for i, iface := range ix.Interfaces {
+		interfaces[i] = indexInterface{LinkType: uint32(iface.LinkType), SnapLen: uint32(iface.SnapLen)}
+	}
+	records := make([]indexRecord, len(ix.Entries))
+	for i, e := range ix.Entries {
+		records[i] = indexRecord{
+			Offset:        e.Offset,
+			Timestamp:     e.Timestamp.UnixNano(),
+			Interface:     uint32(e.Interface),
+			CaptureLength: uint32(e.CaptureLength),
+			Length:        uint32(e.Length),
+			Header:        uint32(e.header),
+		}
+	}
+
+	for _, data := range []interface{}{header, interfaces, records} {
+		if err := binary.Write(writer, binary.LittleEndian, data); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func readPacketIndex(capturePath, indexPath string) (*PacketIndex, error) {
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+
+	var header indexHeader
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+	if string(header.Magic[:]) != indexMagic || header.Version != indexVersion {
+		return nil, errors.New("unsupported packet index")
+	}
+
+	// The counts are checked against the file size before anything is
+	// allocated for them, so a damaged index is rebuilt rather than trusted
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	body := int64(header.Interfaces)*int64(binary.Size(indexInterface{})) + int64(header.Packets)*int64(binary.Size(indexRecord{}))
+	if body != info.Size()-int64(binary.Size(header)) {
+		return nil, errors.New("packet index does not match its size")
+	}
+
+	interfaces := make([]indexInterface, header.Interfaces)
+	records := make([]indexRecord, header.Packets)
+	if err := binary.Read(reader, binary.LittleEndian, interfaces); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.LittleEndian, records); err != nil {
+		return nil, err
+	}
+
+	index := &PacketIndex{
+		Format: FormatPcap,
+		path:   capturePath,
+		size:   header.Size,
+		mtime:  time.Unix(0, header.ModTime),
+		sorted: true,
+		order:  binary.LittleEndian,
+	}
+	if header.Format == 1 {
+		index.Format = FormatPcapNG
+	}
+	if header.BigEndian == 1 {
+		index.order = binary.BigEndian
+	}
+	for _, iface := range interfaces {
+		index.Interfaces = append(index.Interfaces, IndexInterface{LinkType: layers.LinkType(iface.LinkType), SnapLen: int(iface.SnapLen)})
+	}
+	for _, r := range records {
+		index.add(IndexEntry{
+			Offset:        r.Offset,
+			Timestamp:     time.Unix(0, r.Timestamp),
+			Interface:     int(r.Interface),
+			CaptureLength: int(r.CaptureLength),
+			Length:        int(r.Length),
+			header:        int(r.Header),
+		})
+	}
+	return index, nil
+}
+
+// Len returns the number of packets
+func (ix *PacketIndex) Len() int {
+	return len(ix.Entries)
+}
+
+// Entry returns the entry of a packet by number, or nil
+func (ix *PacketIndex) Entry(number int) *IndexEntry {
+	if number < 1 || number > len(ix.Entries) {
+		return nil
+	}
+	return &ix.Entries[number-1]
+}
+
+// SeekTime returns the number of the first packet at or after t, or Len()+1
+// when there is none.
+func (ix *PacketIndex) SeekTime(t time.Time) int {
+	if ix.sorted {
+		return sort.Search(len(ix.Entries), func(i int) bool { return !ix.Entries[i].Timestamp.Before(t) }) + 1
+	}
+	for i, e := range ix.Entries {
+		if !e.Timestamp.Before(t) {
+			return i + 1
+		}
+	}
+	return len(ix.Entries) + 1
+}
+
+// LinkType returns the link type of the interface a packet was captured on
+func (ix *PacketIndex) LinkType(number int) layers.LinkType {
+	if e := ix.Entry(number); e != nil && e.Interface < len(ix.Interfaces) {
+		return ix.Interfaces[e.Interface].LinkType
+	}
+	return layers.LinkTypeEthernet
+}
+
+// ReadPacket reads and decodes one packet by number
+func (ix *PacketIndex) ReadPacket(number int) (gopacket.Packet, error) {
+	var packet gopacket.Packet
+	err := ix.Packets([]int{number}, func(_ int, p gopacket.Packet) error {
+		packet = p
+		return nil
+	})
+	return packet, err
+}
+
+// Range calls fn for packets from to to, inclusive, in order. It stops at
+// the first error fn returns.
+func (ix *PacketIndex) Range(from, to int, fn func(number int, packet gopacket.Packet) error) error {
+	if from < 1 {
+		from = 1
+	}
+	if to > len(ix.Entries) {
+		to = len(ix.Entries)
+	}
+	numbers := make([]int, 0, to-from+1)
+	for n := from; n <= to; n++ {
+		numbers = append(numbers, n)
+	}
+	return ix.Packets(numbers, fn)
+}
+
+// Packets calls fn for each of the given packets, reading only their
+// records. It stops at the first error fn returns.
+func (ix *PacketIndex) Packets(numbers []int, fn func(number int, packet gopacket.Packet) error) error {
+	return ix.packetData(numbers, func(number int, data []byte, ci gopacket.CaptureInfo) error {
+		packet := gopacket.NewPacket(data, ix.LinkType(number), gopacket.Default)
+		packet.Metadata().CaptureInfo = ci
+		return fn(number, packet)
+	})
+}
+
+// packetData is Packets without decoding
+func (ix *PacketIndex) packetData(numbers []int, fn func(number int, data []byte, ci gopacket.CaptureInfo) error) error {
+	file, err := os.Open(ix.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for _, number := range numbers {
+		data, ci, err := ix.readData(file, number)
+		if err != nil {
+			return err
+		}
+		if err := fn(number, data, ci); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readData returns the captured bytes of a packet along with its capture
+// info, without decoding it
+func (ix *PacketIndex) readData(file io.ReaderAt, number int) ([]byte, gopacket.CaptureInfo, error) {
+	e := ix.Entry(number)
+	if e == nil {
+		return nil, gopacket.CaptureInfo{}, fmt.Errorf("packet %d not found in %s", number, ix.path)
+	}
+	data := make([]byte, e.CaptureLength)
+	if _, err := file.ReadAt(data, e.Offset+int64(e.header)); err != nil {
+		return nil, gopacket.CaptureInfo{}, err
+	}
+	return data, gopacket.CaptureInfo{
+		Timestamp:      e.Timestamp,
+		CaptureLength:  e.CaptureLength,
+		Length:         e.Length,
+		InterfaceIndex: e.Interface,
+	}, nil
+}
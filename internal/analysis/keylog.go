@@ -0,0 +1,233 @@
+package analysis
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// TLSSecrets holds the secrets logged for one TLS session, identified by
+// the ClientHello random.
+type TLSSecrets struct {
+	MasterSecret    []byte // TLS 1.2 and earlier
+	ClientHandshake []byte // TLS 1.3
+	ServerHandshake []byte
+	ClientTraffic   []byte
+	ServerTraffic   []byte
+}
+
+// KeyLog maps client randoms to session secrets, as written by clients
+// honouring SSLKEYLOGFILE.
+type KeyLog struct {
+	Secrets map[string]*TLSSecrets // Hex client random -> secrets
+}
+
+func NewKeyLog() *KeyLog {
+	return &KeyLog{
+		Secrets: make(map[string]*TLSSecrets),
+	}
+}
+
+// ParseKeyLog reads NSS key log lines. Unknown labels and comments are
+// skipped; malformed lines are an error.
+func ParseKeyLog(r io.Reader) (*KeyLog, error) {
+	keys := NewKeyLog()
+	if err := keys.Read(r); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Read adds the entries of an NSS key log to k.
+func (k *KeyLog) Read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return fmt.Errorf("key log line %d: expected 3 fields, got %d", line, len(fields))
+		}
+		random, err := hex.DecodeString(fields[1])
+		if err != nil || len(random) != 32 {
+			return fmt.Errorf("key log line %d: invalid client random", line)
+		}
+		secret, err := hex.DecodeString(fields[2])
+		if err != nil {
+			return fmt.Errorf("key log line %d: invalid secret", line)
+		}
+
+		entry := k.entry(random)
+		switch fields[0] {
+		case "CLIENT_RANDOM":
+			entry.MasterSecret = secret
+		case "CLIENT_HANDSHAKE_TRAFFIC_SECRET":
+			entry.ClientHandshake = secret
+		case "SERVER_HANDSHAKE_TRAFFIC_SECRET":
+			entry.ServerHandshake = secret
+		case "CLIENT_TRAFFIC_SECRET_0":
+			entry.ClientTraffic = secret
+		case "SERVER_TRAFFIC_SECRET_0":
+			entry.ServerTraffic = secret
+		}
+	}
+	return scanner.Err()
+}
+
+func (k *KeyLog) entry(random []byte) *TLSSecrets {
+	key := hex.EncodeToString(random)
+	entry, exists := k.Secrets[key]
+	if !exists {
+		entry = &TLSSecrets{}
+		k.Secrets[key] = entry
+	}
+	return entry
+}
+
+// Lookup returns the secrets logged for a client random, or nil.
+func (k *KeyLog) Lookup(clientRandom []byte) *TLSSecrets {
+	if k == nil {
+		return nil
+	}
+	return k.Secrets[hex.EncodeToString(clientRandom)]
+}
+
+// Len returns the number of sessions with logged secrets.
+func (k *KeyLog) Len() int {
+	if k == nil {
+		return 0
+	}
+	return len(k.Secrets)
+}
+
+// KeyLogPath returns where the key log uploaded alongside a capture is kept.
+func KeyLogPath(capturePath string) string {
+	return capturePath + ".keys"
+}
+
+// LoadKeyLog gathers the secrets available for a capture: those embedded in
+// its Decryption Secrets Blocks and, when keyLogPath names a file that
+// exists, those in that key log. It returns nil when there are none.
+func LoadKeyLog(capturePath, keyLogPath string) (*KeyLog, error) {
+	keys := NewKeyLog()
+
+	embedded, err := ReadDecryptionSecrets(capturePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := keys.Read(bytes.NewReader(embedded)); err != nil {
+		return nil, err
+	}
+
+	if keyLogPath != "" {
+		file, err := os.Open(keyLogPath)
+		if err == nil {
+			defer file.Close()
+			if err := keys.Read(file); err != nil {
+				return nil, err
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if keys.Len() == 0 {
+		return nil, nil
+	}
+	return keys, nil
+}
+
+const (
+	pcapngSectionHeader    = 0x0a0d0d0a
+	pcapngDecryptSecrets   = 0x0000000a
+	pcapngByteOrderMagic   = 0x1a2b3c4d
+	pcapngSecretsTLSKeyLog = 0x544c534b
+)
+
+// ReadDecryptionSecrets returns the TLS key log carried by Decryption
+// Secrets Blocks in a pcapng file. Classic pcap files have none.
+func ReadDecryptionSecrets(filePath string) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(file)
+	if magic, err := reader.Peek(4); err != nil || binary.LittleEndian.Uint32(magic) != pcapngSectionHeader {
+		return nil, nil
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	var secrets bytes.Buffer
+	header := make([]byte, 8)
+	offset := int64(0)
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return secrets.Bytes(), nil
+			}
+			return nil, err
+		}
+
+		// Every section header restates the byte order of its section.
+		if binary.LittleEndian.Uint32(header[0:4]) == pcapngSectionHeader {
+			magic, err := reader.Peek(4)
+			if err != nil {
+				return nil, err
+			}
+			if binary.BigEndian.Uint32(magic) == pcapngByteOrderMagic {
+				order = binary.BigEndian
+			} else {
+				order = binary.LittleEndian
+			}
+		}
+
+		blockType := order.Uint32(header[0:4])
+		length := int(order.Uint32(header[4:8]))
+		if length < 12 || length%4 != 0 {
+			return nil, fmt.Errorf("invalid pcapng block length %d", length)
+		}
+		// The length comes from the file, so it is checked before anything
+		// is allocated for it
+		if int64(length) > info.Size()-offset {
+			return nil, io.ErrUnexpectedEOF
+		}
+		offset += int64(length)
+		if blockType != pcapngDecryptSecrets {
+			if _, err := reader.Discard(length - 8); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		body := make([]byte, length-8)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return nil, err
+		}
+
+		if len(body) >= 12 {
+			secretsType := order.Uint32(body[0:4])
+			secretsLength := int(order.Uint32(body[4:8]))
+			if secretsType == pcapngSecretsTLSKeyLog && 8+secretsLength <= len(body)-4 {
+				secrets.Write(body[8 : 8+secretsLength])
+				secrets.WriteByte('\n')
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package analysis
+
+import (
+	"github.com/shreethaar/heroPacket/internal/models"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResolvedName binds a hostname to an address, as observed passively.
+type ResolvedName struct {
+	IP        string
+	Name      string
+	Sources   []string // e.g. "DNS", "DNS PTR", "TLS SNI", "HTTP Host", "DHCP"
+	Count     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// NameResolver builds a passive DNS map from the capture: DNS answers, TLS
+// server names, HTTP Host headers and the names hosts announce via DHCP,
+// NBNS and mDNS.
+type NameResolver struct {
+	mu    sync.Mutex
+	Names map[string]*ResolvedName // IP + "|" + name -> binding
+}
+
+func NewNameResolver() *NameResolver {
+	return &NameResolver{
+		Names: make(map[string]*ResolvedName),
+	}
+}
+
+func (r *NameResolver) Process(packet models.Packet) {
+	for _, host := range packet.HostNames {
+		r.Add(host.IP, host.Name, host.Source, packet.Timestamp)
+	}
+
+	msg := packet.DNS
+	if msg == nil || !msg.QR || msg.ResponseCode != "NOERROR" {
+		return
+	}
+
+	// Every alias in a CNAME chain resolves to the final addresses
+	aliases := make(map[string][]string) // Target -> names pointing at it
+	for _, a := range msg.Answers {
+		if a.Type == "CNAME" {
+			aliases[strings.ToLower(a.Data)] = append(aliases[strings.ToLower(a.Data)], a.Name)
+		}
+	}
+
+	for _, a := range msg.Answers {
+		switch a.Type {
+		case "A", "AAAA":
+			seen := make(map[string]bool)
+			pending := []string{a.Name}
+			for len(pending) > 0 {
+				name := pending[0]
+				pending = pending[1:]
+				if seen[strings.ToLower(name)] {
+					continue
+				}
+				seen[strings.ToLower(name)] = true
+				r.Add(a.Data, name, "DNS", packet.Timestamp)
+				pending = append(pending, aliases[strings.ToLower(name)]...)
+			}
+		case "PTR":
+			if ip := reverseLookupIP(a.Name); ip != "" {
+				r.Add(ip, a.Data, "DNS PTR", packet.Timestamp)
+			}
+		}
+	}
+}
+
+// ProcessStream picks up the answers of DNS over TCP.
+func (r *NameResolver) ProcessStream(stream *Stream) {
+	for _, packet := range dnsStreamMessages(stream) {
+		r.Process(packet)
+	}
+}
+
+// reverseLookupIP turns an in-addr.arpa or ip6.arpa name back into the
+// address it was queried for.
+func reverseLookupIP(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	switch {
+	case strings.HasSuffix(name, ".in-addr.arpa"):
+		labels := strings.Split(strings.TrimSuffix(name, ".in-addr.arpa"), ".")
+		if len(labels) != 4 {
+			return ""
+		}
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		if ip := net.ParseIP(strings.Join(labels, ".")); ip != nil {
+			return ip.String()
+		}
+	case strings.HasSuffix(name, ".ip6.arpa"):
+		nibbles := strings.Split(strings.TrimSuffix(name, ".ip6.arpa"), ".")
+		if len(nibbles) != 32 {
+			return ""
+		}
+		var b strings.Builder
+		for i := len(nibbles) - 1; i >= 0; i-- {
+			b.WriteString(nibbles[i])
+			if i%4 == 0 && i > 0 {
+				b.WriteByte(':')
+			}
+		}
+		if ip := net.ParseIP(b.String()); ip != nil {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// Add records that ip was known as name at the given time.
+func (r *NameResolver) Add(ip, name, source string, ts time.Time) {
+	name = strings.TrimSuffix(name, ".")
+	if ip == "" || name == "" {
+		return
+	}
+	key := ip + "|" + strings.ToLower(name)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.Names[key]
+	if !exists {
+		entry = &ResolvedName{IP: ip, Name: name, FirstSeen: ts, LastSeen: ts}
+		r.Names[key] = entry
+	}
+	entry.Count++
+	if ts.Before(entry.FirstSeen) {
+		entry.FirstSeen = ts
+	}
+	if ts.After(entry.LastSeen) {
+		entry.LastSeen = ts
+	}
+	for _, s := range entry.Sources {
+		if s == source {
+			return
+		}
+	}
+	entry.Sources = append(entry.Sources, source)
+}
+
+// Lookup returns the name an address was seen with most often, or an empty
+// string if it was never named.
+func (r *NameResolver) Lookup(ip string) string {
+	return r.Map()[ip]
+}
+
+// Map returns the preferred name of every named address.
+func (r *NameResolver) Map() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	best := make(map[string]*ResolvedName)
+	for _, entry := range r.Names {
+		current, exists := best[entry.IP]
+		if !exists || entry.Count > current.Count ||
+			(entry.Count == current.Count && entry.FirstSeen.Before(current.FirstSeen)) ||
+			(entry.Count == current.Count && entry.FirstSeen.Equal(current.FirstSeen) && entry.Name < current.Name) {
+			best[entry.IP] = entry
+		}
+	}
+
+	names := make(map[string]string, len(best))
+	for ip, entry := range best {
+		names[ip] = entry.Name
+	}
+	return names
+}
+
+// GetAll returns every binding ordered by address, then name.
+func (r *NameResolver) GetAll() []*ResolvedName {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := make([]*ResolvedName, 0, len(r.Names))
+	for _, entry := range r.Names {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IP != entries[j].IP {
+			return compareIPs(entries[i].IP, entries[j].IP) < 0
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
+
+// Search returns the bindings whose address, name or source contains query,
+// ignoring case.
+func (r *NameResolver) Search(query string) []*ResolvedName {
+	query = strings.ToLower(strings.TrimSpace(query))
+	entries := r.GetAll()
+	if query == "" {
+		return entries
+	}
+
+	var matches []*ResolvedName
+	for _, entry := range entries {
+		if strings.Contains(entry.IP, query) || strings.Contains(strings.ToLower(entry.Name), query) ||
+			strings.Contains(strings.ToLower(strings.Join(entry.Sources, " ")), query) {
+			matches = append(matches, entry)
+		}
+	}
+	return matches
+}
+
+// compareIPs orders addresses numerically, IPv4 before IPv6.
+func compareIPs(a, b string) int {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return strings.Compare(a, b)
+	}
+	if v4A, v4B := ipA.To4() != nil, ipB.To4() != nil; v4A != v4B {
+		if v4A {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(string(ipA.To16()), string(ipB.To16()))
+}
@@ -1,7 +1,7 @@
 package analysis
 
 import (
-	"heroPacket/internal/models"
+	"github.com/shreethaar/heroPacket/internal/models"
 	"sync"
 )
 
@@ -10,6 +10,7 @@ type NetworkNode struct {
 	Type     string // "client", "server", "router", etc.
 	Ports    map[uint16]bool
 	Services map[string]bool
+	Hostname string // Passively resolved name, if any
 }
 
 type NetworkConnection struct {
@@ -123,6 +124,16 @@ func (n *NetworkMapAnalyzer) GetActiveNodes() []*NetworkNode {
 	return nodes
 }
 
+// SetNames labels the nodes with the names their addresses resolved to
+func (n *NetworkMapAnalyzer) SetNames(names map[string]string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, node := range n.Nodes {
+		node.Hostname = names[node.IP]
+	}
+}
+
 // Get active connections (connections with recent activity)
 func (n *NetworkMapAnalyzer) GetActiveConnections() []*NetworkConnection {
 	n.mu.Lock()
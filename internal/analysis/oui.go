@@ -0,0 +1,71 @@
+package analysis
+
+import (
+	"net"
+	"strings"
+)
+
+// Organisationally unique identifiers of common hardware and hypervisor
+// vendors. This is not the full IEEE registry, only the prefixes most often
+// seen on office and lab networks.
+var ouiVendors = map[string]string{
+	"00:00:0c": "Cisco",
+	"00:03:93": "Apple",
+	"00:05:69": "VMware",
+	"00:05:85": "Juniper Networks",
+	"00:0c:29": "VMware",
+	"00:14:22": "Dell",
+	"00:14:6c": "Netgear",
+	"00:15:5d": "Microsoft Hyper-V",
+	"00:17:f2": "Apple",
+	"00:1b:21": "Intel",
+	"00:1c:42": "Parallels",
+	"00:1e:67": "Intel",
+	"00:25:90": "Super Micro",
+	"00:40:96": "Cisco",
+	"00:50:56": "VMware",
+	"00:e0:fc": "Huawei",
+	"04:18:d6": "Ubiquiti",
+	"08:00:27": "VirtualBox",
+	"24:a4:3c": "Ubiquiti",
+	"3c:22:fb": "Apple",
+	"3c:5a:b4": "Google",
+	"3c:d9:2b": "HP",
+	"50:c7:bf": "TP-Link",
+	"a0:36:9f": "Intel",
+	"a4:83:e7": "Apple",
+	"b8:27:eb": "Raspberry Pi",
+	"dc:a6:32": "Raspberry Pi",
+	"e4:5f:01": "Raspberry Pi",
+	"f0:18:98": "Apple",
+	"f4:f2:6d": "TP-Link",
+	"f8:b1:56": "Dell",
+}
+
+// Locally administered prefixes assigned by common hypervisors
+var localVendors = map[string]string{
+	"02:42": "Docker",
+	"52:54": "QEMU/KVM",
+}
+
+// MACVendor names the manufacturer of a MAC address from its OUI. Locally
+// administered addresses, which phones and laptops randomise for privacy,
+// have no manufacturer.
+func MACVendor(mac string) string {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) < 3 {
+		return ""
+	}
+	switch {
+	case hw.String() == "ff:ff:ff:ff:ff:ff":
+		return "Broadcast"
+	case hw[0]&0x01 != 0:
+		return "Multicast"
+	case hw[0]&0x02 != 0:
+		if vendor, ok := localVendors[strings.ToLower(hw[:2].String())]; ok {
+			return vendor
+		}
+		return "Locally administered"
+	}
+	return ouiVendors[strings.ToLower(hw[:3].String())]
+}
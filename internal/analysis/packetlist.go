@@ -0,0 +1,228 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/models"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// PacketSummary is one row of the packet list.
+type PacketSummary struct {
+	Number      int
+	Time        time.Time
+	Relative    time.Duration // Since the first packet
+	Source      string
+	Destination string
+	Protocol    string
+	Length      int
+	Info        string
+}
+
+// PacketList keeps a summary of every packet for the packet list. The
+// packets themselves are read back from the capture when opened.
+type PacketList struct {
+	mu      sync.Mutex
+	first   time.Time
+	Packets []PacketSummary
+}
+
+func NewPacketList() *PacketList {
+	return &PacketList{}
+}
+
+func (l *PacketList) Process(packet models.Packet) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.Packets) == 0 {
+		l.first = packet.Timestamp
+	}
+	source, destination := packet.SourceIP, packet.DestIP
+	if source == "" {
+		source, destination = packet.SourceMAC, packet.DestMAC
+	}
+	l.Packets = append(l.Packets, PacketSummary{
+		Number:      packet.Number,
+		Time:        packet.Timestamp,
+		Relative:    packet.Timestamp.Sub(l.first),
+		Source:      source,
+		Destination: destination,
+		Protocol:    topProtocol(packet.Layers, packet.Protocol),
+		Length:      packet.FrameLength,
+		Info:        packet.Info,
+	})
+}
+
+// Page returns the summaries of packets offset+1 to offset+limit along with
+// the number of packets.
+func (l *PacketList) Page(offset, limit int) ([]PacketSummary, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	total := len(l.Packets)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return l.Packets[offset:end], total
+}
+
+// Get returns the summary of a packet by number, or nil
+func (l *PacketList) Get(number int) *PacketSummary {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if number < 1 || number > len(l.Packets) {
+		return nil
+	}
+	return &l.Packets[number-1]
+}
+
+func (l *PacketList) Count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.Packets)
+}
+
+// topProtocol is the innermost protocol of a packet worth naming in the
+// list: raw data and decode failures are shown as the layer carrying them.
+func topProtocol(stack []string, fallback string) string {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch stack[i] {
+		case "Data", "Malformed", "Payload", "DecodeFailure":
+			continue
+		}
+		return stack[i]
+	}
+	return fallback
+}
+
+// packetInfo summarises a packet in one line, in the style of Wireshark's
+// Info column
+func packetInfo(packet gopacket.Packet) string {
+	// Layers that failed to decode are still added, half filled in
+	failure := packet.ErrorLayer()
+	if l := packet.Layer(layers.LayerTypeDNS); l != nil && failure == nil {
+		return dnsInfo(l.(*layers.DNS))
+	}
+	if l := packet.Layer(layers.LayerTypeARP); l != nil {
+		arp := l.(*layers.ARP)
+		if arp.Operation == layers.ARPRequest {
+			return fmt.Sprintf("Who has %s? Tell %s", ipString(arp.DstProtAddress), ipString(arp.SourceProtAddress))
+		}
+		return fmt.Sprintf("%s is at %s", ipString(arp.SourceProtAddress), macString(arp.SourceHwAddress))
+	}
+	if l := packet.Layer(layers.LayerTypeICMPv4); l != nil {
+		icmp := l.(*layers.ICMPv4)
+		return fmt.Sprintf("%s id=%d, seq=%d", icmp.TypeCode.String(), icmp.Id, icmp.Seq)
+	}
+	if l := packet.Layer(layers.LayerTypeICMPv6); l != nil {
+		return l.(*layers.ICMPv6).TypeCode.String()
+	}
+
+	var payload []byte
+	var ports string
+	var tcpInfo string
+	if l := packet.Layer(layers.LayerTypeTCP); l != nil && len(l.LayerContents()) >= 20 {
+		tcp := l.(*layers.TCP)
+		payload = tcp.Payload
+		ports = fmt.Sprintf("%d → %d", tcp.SrcPort, tcp.DstPort)
+		tcpInfo = fmt.Sprintf("%s [%s] Seq=%d Ack=%d Win=%d Len=%d", ports, tcpFlags(tcp), tcp.Seq, tcp.Ack, tcp.Window, len(tcp.Payload))
+	} else if l := packet.Layer(layers.LayerTypeUDP); l != nil && len(l.LayerContents()) == 8 {
+		udp := l.(*layers.UDP)
+		payload = udp.Payload
+		ports = fmt.Sprintf("%d → %d", udp.SrcPort, udp.DstPort)
+	}
+
+	for _, prefix := range httpPrefixes {
+		if bytes.HasPrefix(payload, prefix) {
+			line := payload
+			if i := bytes.Index(line, []byte("\r\n")); i >= 0 {
+				line = line[:i]
+			}
+			return string(line)
+		}
+	}
+	if len(payload) >= 3 && payload[0] >= 0x14 && payload[0] <= 0x17 && payload[1] == 0x03 {
+		return tlsRecordName(payload[0])
+	}
+	if tcpInfo != "" {
+		return tcpInfo
+	}
+	if ports != "" {
+		return fmt.Sprintf("%s Len=%d", ports, len(payload))
+	}
+	if failure != nil {
+		return "Malformed: " + failure.Error().Error()
+	}
+	return ""
+}
+
+func dnsInfo(dns *layers.DNS) string {
+	var b strings.Builder
+	b.WriteString("Standard query ")
+	if dns.QR {
+		b.WriteString("response ")
+	}
+	fmt.Fprintf(&b, "0x%04x", dns.ID)
+	if dns.QR && dns.ResponseCode != layers.DNSResponseCodeNoErr {
+		b.WriteString(" " + dnsRCodeName(int(dns.ResponseCode)))
+	}
+	for _, q := range dns.Questions {
+		fmt.Fprintf(&b, " %s %s", dnsTypeName(q.Type), q.Name)
+	}
+	for _, rr := range dns.Answers {
+		record := extractDNSRecord(rr)
+		fmt.Fprintf(&b, " %s %s", record.Type, record.Data)
+	}
+	return b.String()
+}
+
+func tcpFlags(tcp *layers.TCP) string {
+	var flags []string
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{tcp.FIN, "FIN"}, {tcp.SYN, "SYN"}, {tcp.RST, "RST"}, {tcp.PSH, "PSH"},
+		{tcp.ACK, "ACK"}, {tcp.URG, "URG"}, {tcp.ECE, "ECE"}, {tcp.CWR, "CWR"},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	return strings.Join(flags, ", ")
+}
+
+func tlsRecordName(contentType byte) string {
+	switch contentType {
+	case 0x14:
+		return "TLS Change Cipher Spec"
+	case 0x15:
+		return "TLS Alert"
+	case 0x16:
+		return "TLS Handshake"
+	}
+	return "TLS Application Data"
+}
+
+func ipString(b []byte) string {
+	return net.IP(b).String()
+}
+
+func macString(b []byte) string {
+	return net.HardwareAddr(b).String()
+}
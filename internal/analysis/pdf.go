@@ -0,0 +1,330 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// A4 in points
+const (
+	pdfWidth  = 595.0
+	pdfHeight = 842.0
+	pdfMargin = 40.0
+)
+
+// Fonts are the standard Type 1 fonts every PDF reader has, so nothing needs
+// embedding. Resource names are F1 to F4 in this order.
+var pdfFonts = []string{"Helvetica", "Helvetica-Bold", "Courier", "Courier-Bold"}
+
+const (
+	pdfRegular  = "F1"
+	pdfBold     = "F2"
+	pdfMono     = "F3"
+	pdfMonoBold = "F4"
+)
+
+// pdfDocument lays out lines of text, tables and bar charts top to bottom
+// on as many pages as they need.
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64 // Baseline of the last line on the current page
+}
+
+func (d *pdfDocument) newPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+	d.y = pdfHeight - pdfMargin
+}
+
+// space starts a new page unless height points are left on this one
+func (d *pdfDocument) space(height float64) {
+	if d.page == nil || d.y-height < pdfMargin {
+		d.newPage()
+	}
+}
+
+func (d *pdfDocument) gap(height float64) {
+	if d.page != nil && d.y-height >= pdfMargin {
+		d.y -= height
+	}
+}
+
+func (d *pdfDocument) line(font string, size, x float64, text string) {
+	d.space(size * 1.4)
+	d.y -= size * 1.4
+	fmt.Fprintf(d.page, "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, size, x, d.y, pdfString(text))
+}
+
+// text wraps paragraphs to the page width. Helvetica averages about half an
+// em per character, which is close enough for wrapping.
+func (d *pdfDocument) text(font string, size float64, text string) {
+	width := int((pdfWidth - 2*pdfMargin) / (size * 0.5))
+	for _, paragraph := range strings.Split(text, "\n") {
+		for _, line := range wrapText(strings.TrimRight(paragraph, "\r"), width) {
+			d.line(font, size, pdfMargin, line)
+		}
+	}
+}
+
+func (d *pdfDocument) heading(size float64, text string) {
+	// Keep a heading with at least a few lines of what follows
+	d.space(size*2 + 40)
+	d.gap(size * 0.6)
+	d.line(pdfBold, size, pdfMargin, text)
+}
+
+// table writes the rows in Courier, with each column as wide as its longest
+// cell and the widest columns truncated when the table would not fit
+func (d *pdfDocument) table(columns []string, rows [][]string) {
+	size := 7.0
+	maxChars := int((pdfWidth - 2*pdfMargin) / (size * 0.6))
+
+	widths := make([]int, len(columns))
+	for i, column := range columns {
+		widths[i] = utf8.RuneCountInString(column)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if i < len(widths) && utf8.RuneCountInString(cell) > widths[i] {
+				widths[i] = utf8.RuneCountInString(cell)
+			}
+		}
+	}
+	for {
+		total, widest := 0, 0
+		for i, width := range widths {
+			total += width + 2
+			if width > widths[widest] {
+				widest = i
+			}
+		}
+		if total <= maxChars || widths[widest] <= 8 {
+			break
+		}
+		widths[widest]--
+	}
+
+	format := func(cells []string) string {
+		var b strings.Builder
+		for i, width := range widths {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			if utf8.RuneCountInString(cell) > width {
+				cell = string([]rune(cell)[:width-1]) + "~"
+			}
+			b.WriteString(cell)
+			b.WriteString(strings.Repeat(" ", width-utf8.RuneCountInString(cell)+2))
+		}
+		return strings.TrimRight(b.String(), " ")
+	}
+
+	d.line(pdfMonoBold, size, pdfMargin, format(columns))
+	fmt.Fprintf(d.page, "0.5 w %.1f %.1f m %.1f %.1f l S\n", pdfMargin, d.y-2, pdfWidth-pdfMargin, d.y-2)
+	for _, row := range rows {
+		d.line(pdfMono, size, pdfMargin, format(row))
+	}
+}
+
+// bars draws one labelled horizontal bar per value
+func (d *pdfDocument) bars(values []ReportValue) {
+	const size, labelWidth, valueWidth = 7.0, 110.0, 60.0
+	max := 0.0
+	for _, value := range values {
+		if value.Value > max {
+			max = value.Value
+		}
+	}
+	barWidth := pdfWidth - 2*pdfMargin - labelWidth - valueWidth
+	for _, value := range values {
+		d.line(pdfRegular, size, pdfMargin, value.Label)
+		if max > 0 {
+			fmt.Fprintf(d.page, "0.18 0.6 0.58 rg %.1f %.1f %.1f %.1f re f 0 g\n", pdfMargin+labelWidth, d.y-1, barWidth*value.Value/max, size)
+		}
+		fmt.Fprintf(d.page, "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", pdfRegular, size, pdfWidth-pdfMargin-valueWidth+6, d.y, pdfString(fmt.Sprintf("%.0f", value.Value)))
+	}
+}
+
+// columns draws a timeline as vertical bars labelled with its first and
+// last intervals
+func (d *pdfDocument) columns(values []ReportValue) {
+	const height, size = 100.0, 7.0
+	if len(values) == 0 {
+		return
+	}
+	max := 0.0
+	for _, value := range values {
+		if value.Value > max {
+			max = value.Value
+		}
+	}
+	d.space(height + size*3)
+	bottom := d.y - height
+	width := (pdfWidth - 2*pdfMargin) / float64(len(values))
+	fmt.Fprintf(d.page, "0.5 w %.1f %.1f m %.1f %.1f l S\n", pdfMargin, bottom, pdfWidth-pdfMargin, bottom)
+	if max > 0 {
+		for i, value := range values {
+			fmt.Fprintf(d.page, "0.18 0.6 0.58 rg %.2f %.1f %.2f %.2f re f 0 g\n", pdfMargin+float64(i)*width, bottom, width*0.8, height*value.Value/max)
+		}
+	}
+	fmt.Fprintf(d.page, "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", pdfRegular, size, pdfMargin, d.y-size, pdfString(fmt.Sprintf("max %.0f", max)))
+	d.y = bottom
+	d.line(pdfRegular, size, pdfMargin, values[0].Label)
+	fmt.Fprintf(d.page, "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", pdfRegular, size, pdfWidth-pdfMargin-30, d.y, pdfString(values[len(values)-1].Label))
+}
+
+// write serializes the document: the catalog, the page tree, the fonts and
+// then each page followed by its content stream
+func (d *pdfDocument) write(w io.Writer) error {
+	if len(d.pages) == 0 {
+		d.newPage()
+	}
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	firstPage := 3 + len(pdfFonts)
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+
+	var resources strings.Builder
+	resources.WriteString("<< /Font <<")
+	for i, font := range pdfFonts {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", font))
+		fmt.Fprintf(&resources, " /F%d %d 0 R", i+1, 3+i)
+	}
+	resources.WriteString(" >> >>")
+
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources %s /Contents %d 0 R >>", pdfWidth, pdfHeight, resources.String(), firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", page.Len(), page.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// pdfString encodes text for a string literal in WinAnsiEncoding, which
+// matches Latin-1 from 0xA0 on. Characters it cannot show become '?'.
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		case r == '≤':
+			b.WriteString("<=")
+		case r == '≥':
+			b.WriteString(">=")
+		case r == '—':
+			b.WriteByte(0x97)
+		case r == '–':
+			b.WriteByte(0x96)
+		case r == '•':
+			b.WriteByte(0x95)
+		case r == '…':
+			b.WriteByte(0x85)
+		case r < 0x20:
+			b.WriteByte(' ')
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// wrapText breaks a paragraph into lines of at most width characters at
+// spaces, splitting words that are longer than a line
+func wrapText(text string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	var lines []string
+	var line []rune
+	for _, word := range strings.Fields(text) {
+		runes := []rune(word)
+		for len(runes) > width {
+			if len(line) > 0 {
+				lines = append(lines, string(line))
+				line = nil
+			}
+			lines = append(lines, string(runes[:width]))
+			runes = runes[width:]
+		}
+		if len(line) > 0 && len(line)+1+len(runes) > width {
+			lines = append(lines, string(line))
+			line = nil
+		}
+		if len(line) > 0 {
+			line = append(line, ' ')
+		}
+		line = append(line, runes...)
+	}
+	if len(line) > 0 || len(lines) == 0 {
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+func (r *Report) writePDF(w io.Writer) error {
+	var d pdfDocument
+	d.newPage()
+	d.line(pdfBold, 18, pdfMargin, "heroPacket Report: "+r.Filename)
+	d.line(pdfRegular, 9, pdfMargin, "Generated "+reportTime(r.Generated))
+
+	if r.Notes != "" {
+		d.heading(13, "Analyst Notes")
+		d.text(pdfRegular, 10, r.Notes)
+	}
+
+	for _, section := range r.Sections {
+		d.gap(8)
+		d.heading(14, section.Title)
+		for _, fact := range section.Facts {
+			d.text(pdfRegular, 9, fact.Label+": "+fact.Value)
+		}
+		for _, chart := range section.Charts {
+			d.heading(10, chart.Title)
+			if chart.Timeline {
+				d.columns(chart.Values)
+			} else {
+				d.bars(chart.Values)
+			}
+		}
+		for _, table := range section.Tables {
+			d.heading(10, table.Title)
+			if len(table.Rows) == 0 {
+				d.line(pdfRegular, 9, pdfMargin, "None.")
+				continue
+			}
+			d.table(table.Columns, table.Rows)
+		}
+	}
+	return d.write(w)
+}
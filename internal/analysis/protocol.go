@@ -1,18 +1,20 @@
 package analysis
 
 import (
-    "heroPacket/internal/models"
+    "github.com/shreethaar/heroPacket/internal/models"
     "sync"
 )
 
 type ProtocolAnalyzer struct {
     mu        sync.Mutex
     Protocols map[string]int
+    Hierarchy *ProtocolNode
 }
 
 func NewProtocolAnalyzer() *ProtocolAnalyzer {
     return &ProtocolAnalyzer{
         Protocols: make(map[string]int),
+        Hierarchy: newProtocolNode("Frame"),
     }
 }
 
@@ -23,4 +25,13 @@ func (p *ProtocolAnalyzer) Process(packet models.Packet) {
     if packet.Protocol != "" {
         p.Protocols[packet.Protocol]++
     }
+    p.Hierarchy.add(packet.Layers, packet.FrameLength)
+}
+
+// Tree returns a copy of the protocol hierarchy with percentages filled in
+func (p *ProtocolAnalyzer) Tree() *ProtocolNode {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    return p.Hierarchy.snapshot(p.Hierarchy.Packets)
 }
@@ -0,0 +1,354 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/models"
+	"strconv"
+)
+
+// Plugin describes an analyzer. Sessions run the enabled plugins on every
+// packet and stream in registration order and serve their tables, so an
+// analyzer added with Register needs no changes to Session or the pages.
+type Plugin struct {
+	Name        string
+	Title       string
+	Version     string
+	Description string
+	Requires    []string // Analyzers it reads from, disabled along with them
+	Config      []ConfigOption
+	Tables      []TableDefinition // Results, in the order they are shown
+
+	// New starts the analyzer for one session
+	New func(s *Session, config Config) Analyzer
+}
+
+// TableDefinition names a table of results and its columns
+type TableDefinition struct {
+	Name    string        `json:"name"`
+	Title   string        `json:"title"`
+	Columns []TableColumn `json:"columns"`
+}
+
+// ConfigOption is a setting of an analyzer. Type is one of the column types
+// other than time, and Default is written as a value would be given.
+type ConfigOption struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Default     string `json:"default"`
+	Description string `json:"description"`
+}
+
+// Analyzer is a plugin running in one session. It may also implement
+// StreamProcessor to see reassembled streams, and the interfaces below to
+// take part in finishing the session, which the session discovers by type
+// assertion. Once every stream has been seen, name sources add the names
+// they learnt, then each analyzer in turn is handed the resolved names and
+// the TLS handshakes if it uses them and is finished, and last expert
+// collectors gather the items of the expert sources.
+type Analyzer interface {
+	PacketProcessor
+	Table(name string) (*Table, error)
+}
+
+type Finisher interface {
+	Finish()
+}
+
+// NameSource is implemented by analyzers that learn the names of hosts,
+// such as from TLS server names
+type NameSource interface {
+	AddNames(names *NameResolver)
+}
+
+// NameUser is implemented by analyzers that label addresses with the names
+// they resolved to
+type NameUser interface {
+	SetNames(names map[string]string)
+}
+
+// TLSSource is implemented by analyzers that find TLS handshakes
+type TLSSource interface {
+	GetSessions() []*TLSSession
+}
+
+// TLSUser is implemented by analyzers that label their results with the
+// TLS handshakes of TLS sources
+type TLSUser interface {
+	AttachTLS(handshake *TLSSession)
+}
+
+// ExpertCollector is implemented by analyzers that gather the items of
+// expert sources
+type ExpertCollector interface {
+	Collect(sources ...ExpertSource)
+}
+
+// Config holds the settings of one analyzer run, parsed to the types of its
+// options
+type Config map[string]interface{}
+
+func (c Config) String(name string) string {
+	v, _ := c[name].(string)
+	return v
+}
+
+func (c Config) Int(name string) int {
+	v, _ := c[name].(int)
+	return v
+}
+
+func (c Config) Float(name string) float64 {
+	v, _ := c[name].(float64)
+	return v
+}
+
+func (c Config) Bool(name string) bool {
+	v, _ := c[name].(bool)
+	return v
+}
+
+// plugins holds the registered analyzers. The built-in ones come first, as
+// package variables are initialised before any init function registers more.
+var plugins = builtinPlugins()
+
+// Register adds an analyzer, normally from an init function. The analyzers
+// it requires must already be registered; within this package init
+// functions run in file name order. Register panics on an invalid plugin
+// since that is a programming error.
+func Register(p Plugin) {
+	if p.Name == "" || p.New == nil {
+		panic("analysis: plugin needs a name and New")
+	}
+	if _, exists := LookupPlugin(p.Name); exists {
+		panic(fmt.Sprintf("analysis: analyzer %q registered twice", p.Name))
+	}
+	for _, name := range p.Requires {
+		if _, exists := LookupPlugin(name); !exists {
+			panic(fmt.Sprintf("analysis: analyzer %q requires unregistered %q", p.Name, name))
+		}
+	}
+	if _, err := p.parseConfig(nil); err != nil {
+		panic(fmt.Sprintf("analysis: analyzer %q: %v", p.Name, err))
+	}
+	for _, table := range p.Tables {
+		if _, exists := TableColumns[table.Name]; exists {
+			panic(fmt.Sprintf("analysis: analyzer %q redefines table %q", p.Name, table.Name))
+		}
+	}
+	for _, table := range p.Tables {
+		TableNames = append(TableNames, table.Name)
+		TableTitles[table.Name] = table.Title
+		TableColumns[table.Name] = table.Columns
+	}
+	plugins = append(plugins, &p)
+}
+
+// Plugins returns every registered analyzer in the order they run
+func Plugins() []Plugin {
+	result := make([]Plugin, len(plugins))
+	for i, p := range plugins {
+		result[i] = *p
+	}
+	return result
+}
+
+// LookupPlugin finds a registered analyzer by name
+func LookupPlugin(name string) (Plugin, bool) {
+	for _, p := range plugins {
+		if p.Name == name {
+			return *p, true
+		}
+	}
+	return Plugin{}, false
+}
+
+// tableOwner finds the analyzer producing a table
+func tableOwner(name string) (*Plugin, bool) {
+	for _, p := range plugins {
+		for _, table := range p.Tables {
+			if table.Name == name {
+				return p, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// parseConfig checks settings against the options and fills in the
+// defaults of those left out
+func (p *Plugin) parseConfig(values map[string]string) (Config, error) {
+	config := make(Config)
+	for _, option := range p.Config {
+		value := option.Default
+		if v, given := values[option.Name]; given {
+			value = v
+		}
+		var parsed interface{}
+		var err error
+		switch option.Type {
+		case ColumnString:
+			parsed = value
+		case ColumnInteger:
+			parsed, err = strconv.Atoi(value)
+		case ColumnNumber:
+			parsed, err = strconv.ParseFloat(value, 64)
+		case ColumnBoolean:
+			parsed, err = strconv.ParseBool(value)
+		default:
+			return nil, fmt.Errorf("option %s has unsupported type %q", option.Name, option.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("option %s must be of type %s, not %q", option.Name, option.Type, value)
+		}
+		config[option.Name] = parsed
+	}
+	for name := range values {
+		if _, known := config[name]; !known {
+			return nil, fmt.Errorf("%s has no option %q", p.Name, name)
+		}
+	}
+	return config, nil
+}
+
+// builtinAnalyzer runs the parts of a built-in analyzer, each in every
+// stage it implements, and serves their tables
+type builtinAnalyzer struct {
+	session *Session
+	parts   []interface{}
+}
+
+func (b *builtinAnalyzer) Process(p models.Packet) {
+	for _, part := range b.parts {
+		if processor, ok := part.(PacketProcessor); ok {
+			processor.Process(p)
+		}
+	}
+}
+
+func (b *builtinAnalyzer) ProcessStream(stream *Stream) {
+	for _, part := range b.parts {
+		if processor, ok := part.(StreamProcessor); ok {
+			processor.ProcessStream(stream)
+		}
+	}
+}
+
+func (b *builtinAnalyzer) AddNames(names *NameResolver) {
+	for _, part := range b.parts {
+		if source, ok := part.(NameSource); ok {
+			source.AddNames(names)
+		}
+	}
+}
+
+func (b *builtinAnalyzer) SetNames(names map[string]string) {
+	for _, part := range b.parts {
+		if user, ok := part.(NameUser); ok {
+			user.SetNames(names)
+		}
+	}
+}
+
+func (b *builtinAnalyzer) GetSessions() []*TLSSession {
+	var handshakes []*TLSSession
+	for _, part := range b.parts {
+		if source, ok := part.(TLSSource); ok {
+			handshakes = append(handshakes, source.GetSessions()...)
+		}
+	}
+	return handshakes
+}
+
+func (b *builtinAnalyzer) AttachTLS(handshake *TLSSession) {
+	for _, part := range b.parts {
+		if user, ok := part.(TLSUser); ok {
+			user.AttachTLS(handshake)
+		}
+	}
+}
+
+func (b *builtinAnalyzer) ExpertItems() []ExpertItem {
+	var items []ExpertItem
+	for _, part := range b.parts {
+		if source, ok := part.(ExpertSource); ok {
+			items = append(items, source.ExpertItems()...)
+		}
+	}
+	return items
+}
+
+func (b *builtinAnalyzer) Collect(sources ...ExpertSource) {
+	for _, part := range b.parts {
+		if collector, ok := part.(ExpertCollector); ok {
+			collector.Collect(sources...)
+		}
+	}
+}
+
+func (b *builtinAnalyzer) Table(name string) (*Table, error) {
+	return b.session.builtinTable(name)
+}
+
+// builtinPart returns the part of type T of a running built-in analyzer,
+// or a new empty one when the analyzer is not enabled, so pages can show
+// its results either way
+func builtinPart[T any](s *Session, name string, empty func() T) T {
+	for _, run := range s.runs {
+		if b, ok := run.analyzer.(*builtinAnalyzer); ok && run.plugin.Name == name {
+			for _, part := range b.parts {
+				if p, ok := part.(T); ok {
+					return p
+				}
+			}
+		}
+	}
+	return empty()
+}
+
+// builtin defines a built-in analyzer whose tables are already in
+// TableColumns and which runs the parts parts returns. TLS registers before
+// HTTP so HTTP sees the plaintext of decrypted streams.
+func builtin(name, title, description string, tables []string, parts func(s *Session) []interface{}) *Plugin {
+	p := &Plugin{Name: name, Title: title, Version: "1.0.0", Description: description}
+	for _, table := range tables {
+		p.Tables = append(p.Tables, TableDefinition{Name: table, Title: TableTitles[table], Columns: TableColumns[table]})
+	}
+	p.New = func(s *Session, _ Config) Analyzer {
+		return &builtinAnalyzer{session: s, parts: parts(s)}
+	}
+	return p
+}
+
+func builtinPlugins() []*Plugin {
+	return []*Plugin{
+		builtin(AnalyzerProtocols, "Protocols", "Protocol hierarchy of the packets", []string{TableProtocols}, func(s *Session) []interface{} {
+			return []interface{}{NewProtocolAnalyzer()}
+		}),
+		builtin(AnalyzerTraffic, "Traffic", "Packet and byte totals and packet sizes", nil, func(s *Session) []interface{} {
+			return []interface{}{NewTrafficStats()}
+		}),
+		builtin(AnalyzerConversations, "Conversations", "Traffic between pairs of addresses at each layer", []string{TableConversations}, func(s *Session) []interface{} {
+			return []interface{}{NewConversationTracker()}
+		}),
+		builtin(AnalyzerEndpoints, "Endpoints", "Ethernet, IP, TCP and UDP endpoints", []string{TableEndpoints}, func(s *Session) []interface{} {
+			return []interface{}{NewEndpointAnalyzer()}
+		}),
+		builtin(AnalyzerDNS, "DNS", "DNS transactions, resolvers and threats such as tunnelling", []string{TableDNS}, func(s *Session) []interface{} {
+			return []interface{}{NewDNSAnalyzer(), NewDNSThreatAnalyzer()}
+		}),
+		builtin(AnalyzerTLS, "TLS", "TLS handshakes, fingerprints, certificates and decryption", []string{TableTLS}, func(s *Session) []interface{} {
+			tls := NewTLSAnalyzer()
+			tls.KeyLog = s.keyLog
+			return []interface{}{tls, NewCertificateAnalyzer()}
+		}),
+		builtin(AnalyzerHTTP, "HTTP", "HTTP/1.x requests and responses", []string{TableHTTP}, func(s *Session) []interface{} {
+			return []interface{}{NewHTTPAnalyzer()}
+		}),
+		builtin(AnalyzerNetworkMap, "Network Map", "Hosts, their roles and connections", []string{TableNodes, TableConnections}, func(s *Session) []interface{} {
+			return []interface{}{NewNetworkMapAnalyzer()}
+		}),
+		builtin(AnalyzerFindings, "Findings", "Expert findings: malformed packets, TCP health and security", []string{TableFindings}, func(s *Session) []interface{} {
+			return []interface{}{NewSecurityAnalyzer(), NewTCPHealthAnalyzer(), NewExpertInfo()}
+		}),
+	}
+}
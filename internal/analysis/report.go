@@ -0,0 +1,612 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wcharczuk/go-chart"
+)
+
+// Report formats
+const (
+	ReportHTML     = "html"
+	ReportMarkdown = "md"
+	ReportPDF      = "pdf"
+)
+
+// Report sections, in the order they appear
+const (
+	ReportProperties    = "properties"
+	ReportTraffic       = "traffic"
+	ReportProtocols     = "protocols"
+	ReportConversations = "conversations"
+	ReportEndpoints     = "endpoints"
+	ReportDNS           = "dns"
+	ReportHTTP          = "http"
+	ReportTLS           = "tls"
+	ReportSecurity      = "security"
+	ReportGeoIP         = "geoip"
+)
+
+var ReportSections = []string{
+	ReportProperties, ReportTraffic, ReportProtocols, ReportConversations, ReportEndpoints,
+	ReportDNS, ReportHTTP, ReportTLS, ReportSecurity, ReportGeoIP,
+}
+
+// ReportTitles names the sections
+var ReportTitles = map[string]string{
+	ReportProperties:    "Capture Properties",
+	ReportTraffic:       "Traffic Statistics",
+	ReportProtocols:     "Protocol Hierarchy",
+	ReportConversations: "Top Conversations",
+	ReportEndpoints:     "Endpoints",
+	ReportDNS:           "DNS",
+	ReportHTTP:          "HTTP",
+	ReportTLS:           "TLS",
+	ReportSecurity:      "Security Findings",
+	ReportGeoIP:         "GeoIP Summary",
+}
+
+// ReportLocation is the geolocation of a public address seen in the capture.
+// Lookups are the caller's business, so the analysis does not depend on a
+// geolocation service.
+type ReportLocation struct {
+	IP      string
+	Name    string
+	Country string
+	Region  string
+	City    string
+	Org     string
+	Packets int
+	Bytes   int
+}
+
+// ReportOptions chooses what goes into a report
+type ReportOptions struct {
+	Filename   string
+	Sections   []string // Empty for every section
+	Notes      string   // Analyst notes, shown first
+	Top        int      // Rows in each ranking, 10 when zero
+	Properties *CaptureProperties
+	Locations  []ReportLocation // Only used by the GeoIP section
+}
+
+// Report is the analysis of a capture laid out as sections of facts, charts
+// and tables, ready to be written in any of the report formats.
+type Report struct {
+	Filename  string
+	Generated time.Time
+	Notes     string
+	Sections  []*ReportSection
+}
+
+type ReportSection struct {
+	ID     string
+	Title  string
+	Facts  []ReportFact
+	Charts []ReportChart
+	Tables []ReportTable
+}
+
+type ReportFact struct {
+	Label string
+	Value string
+}
+
+// ReportChart is a chart rendered as SVG, with the values behind it for
+// formats that cannot embed SVG. Timelines have one value per interval.
+type ReportChart struct {
+	Title    string
+	SVG      string
+	Timeline bool
+	Values   []ReportValue
+}
+
+type ReportValue struct {
+	Label string
+	Value float64
+}
+
+type ReportTable struct {
+	Title   string
+	Columns []string
+	Rows    [][]string
+}
+
+func (s *ReportSection) fact(label, value string) {
+	s.Facts = append(s.Facts, ReportFact{Label: label, Value: value})
+}
+
+func (s *ReportSection) table(title string, columns ...string) *ReportTable {
+	s.Tables = append(s.Tables, ReportTable{Title: title, Columns: columns})
+	return &s.Tables[len(s.Tables)-1]
+}
+
+func (t *ReportTable) row(cells ...string) {
+	t.Rows = append(t.Rows, cells)
+}
+
+// BuildReport gathers the results of a finished session into a report
+func BuildReport(s *Session, opts ReportOptions) *Report {
+	if opts.Top <= 0 {
+		opts.Top = 10
+	}
+	chosen := make(map[string]bool)
+	for _, id := range opts.Sections {
+		chosen[id] = true
+	}
+
+	report := &Report{
+		Filename:  opts.Filename,
+		Generated: time.Now(),
+		Notes:     strings.TrimSpace(opts.Notes),
+	}
+	builders := map[string]func(*Session, ReportOptions, *ReportSection){
+		ReportProperties:    reportProperties,
+		ReportTraffic:       reportTraffic,
+		ReportProtocols:     reportProtocols,
+		ReportConversations: reportConversations,
+		ReportEndpoints:     reportEndpoints,
+		ReportDNS:           reportDNS,
+		ReportHTTP:          reportHTTP,
+		ReportTLS:           reportTLS,
+		ReportSecurity:      reportSecurity,
+		ReportGeoIP:         reportGeoIP,
+	}
+	for _, id := range ReportSections {
+		if len(chosen) > 0 && !chosen[id] {
+			continue
+		}
+		section := &ReportSection{ID: id, Title: ReportTitles[id]}
+		builders[id](s, opts, section)
+		report.Sections = append(report.Sections, section)
+	}
+	return report
+}
+
+func reportProperties(_ *Session, opts ReportOptions, section *ReportSection) {
+	p := opts.Properties
+	if p == nil {
+		section.fact("File", opts.Filename)
+		section.fact("Hashes", "unavailable")
+		return
+	}
+	section.fact("File", p.FileName)
+	section.fact("Size", fmt.Sprintf("%s (%d bytes)", reportBytes(int(p.FileSize)), p.FileSize))
+	section.fact("MD5", p.MD5Hash)
+	section.fact("SHA-256", p.SHA256Hash)
+	section.fact("First packet", reportTime(p.FirstPacket))
+	section.fact("Last packet", reportTime(p.LastPacket))
+	section.fact("Link types", strings.Join(p.Interfaces, ", "))
+}
+
+func reportTraffic(s *Session, _ ReportOptions, section *ReportSection) {
+	stats := s.TrafficStats()
+	stats.mu.Lock()
+	total, totalBytes := stats.TotalPackets, stats.TotalBytes
+	start, end := stats.StartTime, stats.EndTime
+	buckets := make(map[string]int, len(stats.SizeBuckets))
+	for bucket, count := range stats.SizeBuckets {
+		buckets[bucket] = count
+	}
+	stats.mu.Unlock()
+
+	duration := end.Sub(start)
+	section.fact("Packets", fmt.Sprintf("%d", total))
+	section.fact("Bytes", reportBytes(totalBytes))
+	section.fact("Start", reportTime(start))
+	section.fact("End", reportTime(end))
+	section.fact("Duration", duration.Round(time.Millisecond).String())
+	if total > 0 {
+		section.fact("Average packet size", fmt.Sprintf("%d bytes", totalBytes/total))
+	}
+	if duration > 0 {
+		section.fact("Average rate", fmt.Sprintf("%.1f packets/s, %s/s", float64(total)/duration.Seconds(), reportBytes(int(float64(totalBytes)/duration.Seconds()))))
+	}
+
+	if timeline := reportTimeline(s, start, end); len(timeline) > 0 {
+		section.Charts = append(section.Charts, ReportChart{
+			Title:    "Bytes over time",
+			SVG:      timelineSVG(timeline),
+			Timeline: true,
+			Values:   timeline,
+		})
+	}
+
+	var sizes []ReportValue
+	for _, bucket := range []string{"≤64", "65-128", "129-512", "513-1024", ">1024"} {
+		sizes = append(sizes, ReportValue{Label: bucket, Value: float64(buckets[bucket])})
+	}
+	if total > 0 {
+		section.Charts = append(section.Charts, ReportChart{Title: "Packet sizes", SVG: barSVG(sizes), Values: sizes})
+	}
+}
+
+// reportTimeline sums the bytes sent by every IP endpoint into at most
+// hostTrafficPoints intervals, as on the host page
+func reportTimeline(s *Session, from, to time.Time) []ReportValue {
+	start, end := from.Unix(), to.Unix()
+	if from.IsZero() || end < start {
+		return nil
+	}
+	width := int64(math.Ceil(float64(end-start+1) / hostTrafficPoints))
+	if width < 1 {
+		width = 1
+	}
+
+	values := make([]ReportValue, (end-start)/width+1)
+	for i := range values {
+		values[i].Label = time.Unix(start+int64(i)*width, 0).In(from.Location()).Format("15:04:05")
+	}
+	for _, kind := range []string{EndpointIPv4, EndpointIPv6} {
+		endpoints, _ := s.Endpoints().List(kind, "", false, 0, 0)
+		for _, endpoint := range endpoints {
+			for second, bucket := range endpoint.Traffic {
+				if second >= start && second <= end {
+					values[(second-start)/width].Value += float64(bucket.BytesSent)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func reportProtocols(s *Session, _ ReportOptions, section *ReportSection) {
+	var top []ReportValue
+	for _, count := range s.Protocols().Top(8) {
+		top = append(top, ReportValue{Label: count.Name, Value: float64(count.Count)})
+	}
+	if len(top) > 0 {
+		section.Charts = append(section.Charts, ReportChart{Title: "Top protocols", SVG: pieSVG(top), Values: top})
+	}
+
+	table := section.table("Hierarchy", "Protocol", "Packets", "% Packets", "Bytes")
+	var walk func(node *ProtocolNode, depth int)
+	walk = func(node *ProtocolNode, depth int) {
+		// No-break spaces survive HTML, Markdown tables and PDF alike
+		table.row(strings.Repeat("\u00a0\u00a0\u00a0", depth)+node.Name, fmt.Sprintf("%d", node.Packets), fmt.Sprintf("%.1f%%", node.Percent), reportBytes(node.Bytes))
+		for _, child := range node.Children {
+			walk(child, depth+1)
+		}
+	}
+	walk(s.Protocols().Tree(), 0)
+}
+
+func reportConversations(s *Session, opts ReportOptions, section *ReportSection) {
+	counts := s.Conversations().Count()
+	for _, kind := range ConversationTypes {
+		section.fact(kind+" conversations", fmt.Sprintf("%d", counts[kind]))
+	}
+
+	table := section.table("By packets", "Protocol", "Address A", "Address B", "Packets", "Bytes", "Duration", "State")
+	for _, conv := range s.Conversations().Top(opts.Top) {
+		table.row(conv.Type, conv.AddressA(), conv.AddressB(), fmt.Sprintf("%d", conv.PacketCount), reportBytes(conv.TotalBytes), conv.Duration().Round(time.Millisecond).String(), conv.State)
+	}
+}
+
+func reportEndpoints(s *Session, opts ReportOptions, section *ReportSection) {
+	counts := s.Endpoints().Count()
+	for _, kind := range EndpointTypes {
+		section.fact(kind+" endpoints", fmt.Sprintf("%d", counts[kind]))
+	}
+
+	for _, kind := range []string{EndpointIPv4, EndpointIPv6} {
+		endpoints, _ := s.Endpoints().List(kind, "bytes", true, 0, opts.Top)
+		if len(endpoints) == 0 {
+			continue
+		}
+		table := section.table(kind+" by bytes", "Address", "Name", "Packets", "Bytes", "Protocols")
+		for _, endpoint := range endpoints {
+			table.row(endpoint.Address, endpoint.Name, fmt.Sprintf("%d", endpoint.Packets()), reportBytes(endpoint.Bytes()), strings.Join(endpoint.ProtocolList(), ", "))
+		}
+	}
+}
+
+func reportDNS(s *Session, opts ReportOptions, section *ReportSection) {
+	stats := s.DNS().GetStats()
+	section.fact("Messages", fmt.Sprintf("%d", stats.Messages))
+	section.fact("Queries", fmt.Sprintf("%d", stats.Queries))
+	section.fact("Responses", fmt.Sprintf("%d", stats.Responses))
+	section.fact("Unanswered", fmt.Sprintf("%d", stats.Unanswered))
+	section.fact("Errors", fmt.Sprintf("%d", stats.Errors))
+	section.fact("Over TCP", fmt.Sprintf("%d", stats.TCP))
+
+	queries := section.table("Top queries", "Domain", "Queries")
+	for _, q := range s.DNS().TopQueries(opts.Top) {
+		queries.row(q.Domain, fmt.Sprintf("%d", q.Count))
+	}
+	types := section.table("Record types", "Type", "Queries")
+	for _, count := range s.DNS().TypeDistribution() {
+		types.row(count.Name, fmt.Sprintf("%d", count.Count))
+	}
+	codes := section.table("Response codes", "Code", "Responses")
+	for _, count := range s.DNS().ResponseCodeDistribution() {
+		codes.row(count.Name, fmt.Sprintf("%d", count.Count))
+	}
+	resolvers := section.table("Resolvers", "Resolver", "Queries", "Failure rate", "p50", "p95")
+	for _, r := range s.DNS().ResolverStats() {
+		resolvers.row(r.IP, fmt.Sprintf("%d", r.Queries), fmt.Sprintf("%.1f%%", r.FailureRate*100), r.P50.String(), r.P95.String())
+	}
+}
+
+func reportHTTP(s *Session, opts ReportOptions, section *ReportSection) {
+	clientErrors, serverErrors := s.HTTP().ErrorRates()
+	section.fact("Requests", fmt.Sprintf("%d", len(s.HTTP().GetTransactions())))
+	section.fact("Client error rate", fmt.Sprintf("%.1f%%", clientErrors*100))
+	section.fact("Server error rate", fmt.Sprintf("%.1f%%", serverErrors*100))
+
+	for _, ranking := range []struct {
+		title, column string
+		counts        []HTTPCount
+	}{
+		{"Top hosts", "Host", s.HTTP().TopHosts(opts.Top)},
+		{"Top URIs", "URI", s.HTTP().TopURIs(opts.Top)},
+		{"Top user agents", "User agent", s.HTTP().TopUserAgents(opts.Top)},
+	} {
+		table := section.table(ranking.title, ranking.column, "Requests")
+		for _, count := range ranking.counts {
+			table.row(count.Name, fmt.Sprintf("%d", count.Count))
+		}
+	}
+}
+
+func reportTLS(s *Session, opts ReportOptions, section *ReportSection) {
+	handshakes := s.TLS().GetSessions()
+	decrypted := 0
+	for _, hs := range handshakes {
+		if hs.Decrypted {
+			decrypted++
+		}
+	}
+	section.fact("Handshakes", fmt.Sprintf("%d", len(handshakes)))
+	section.fact("Decrypted", fmt.Sprintf("%d", decrypted))
+
+	for _, ranking := range []struct {
+		title, column string
+		counts        []TLSCount
+	}{
+		{"Versions", "Version", s.TLS().VersionDistribution()},
+		{"Top server names", "SNI", s.TLS().TopSNIs(opts.Top)},
+		{"Top JA3 fingerprints", "JA3", s.TLS().TopJA3(opts.Top)},
+		{"Top JA4 fingerprints", "JA4", s.TLS().TopJA4(opts.Top)},
+	} {
+		table := section.table(ranking.title, ranking.column, "Handshakes")
+		for _, count := range ranking.counts {
+			table.row(count.Name, fmt.Sprintf("%d", count.Count))
+		}
+	}
+}
+
+// reportSecurity lists the expert info worth a warning or in the security
+// group, the DNS threat findings and traffic on commonly attacked ports
+func reportSecurity(s *Session, _ ReportOptions, section *ReportSection) {
+	counts := s.Expert().SeverityCounts()
+	for _, severity := range ExpertSeverities {
+		section.fact("Expert "+severity, fmt.Sprintf("%d", counts[severity]))
+	}
+
+	expert := section.table("Expert info", "Severity", "Group", "Protocol", "Summary", "Count")
+	for _, t := range s.Expert().Types("", "") {
+		if ExpertSeverityRank(t.Severity) <= ExpertSeverityRank(ExpertWarn) || t.Group == ExpertSecurity {
+			expert.row(t.Severity, t.Group, t.Protocol, t.Summary, fmt.Sprintf("%d", t.Count))
+		}
+	}
+
+	threats := section.table("DNS threats", "Kind", "Severity", "Domain", "Score", "Indicators")
+	for _, threat := range s.DNSThreats().Findings() {
+		threats.row(threat.Kind, threat.Severity, threat.Domain, fmt.Sprintf("%.2f", threat.Score), strings.Join(threat.Indicators, "; "))
+	}
+
+	ports := section.table("Sensitive ports", "Port", "Service", "Packets")
+	for _, count := range s.Security().PortCounts() {
+		ports.row(fmt.Sprintf("%d", count.Port), count.Service, fmt.Sprintf("%d", count.Count))
+	}
+}
+
+func reportGeoIP(_ *Session, opts ReportOptions, section *ReportSection) {
+	type country struct {
+		name      string
+		addresses int
+		bytes     int
+	}
+	countries := make(map[string]*country)
+	for _, location := range opts.Locations {
+		name := location.Country
+		if name == "" {
+			name = "Unknown"
+		}
+		summary, exists := countries[name]
+		if !exists {
+			summary = &country{name: name}
+			countries[name] = summary
+		}
+		summary.addresses++
+		summary.bytes += location.Bytes
+	}
+	section.fact("Public addresses located", fmt.Sprintf("%d", len(opts.Locations)))
+	section.fact("Countries", fmt.Sprintf("%d", len(countries)))
+
+	summaries := make([]*country, 0, len(countries))
+	for _, summary := range countries {
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].bytes != summaries[j].bytes {
+			return summaries[i].bytes > summaries[j].bytes
+		}
+		return summaries[i].name < summaries[j].name
+	})
+	byCountry := section.table("By country", "Country", "Addresses", "Bytes")
+	for _, summary := range summaries {
+		byCountry.row(summary.name, fmt.Sprintf("%d", summary.addresses), reportBytes(summary.bytes))
+	}
+
+	addresses := section.table("Addresses", "Address", "Name", "Location", "Organization", "Bytes")
+	for _, location := range opts.Locations {
+		var place []string
+		for _, part := range []string{location.City, location.Region, location.Country} {
+			if part != "" {
+				place = append(place, part)
+			}
+		}
+		addresses.row(location.IP, location.Name, strings.Join(place, ", "), location.Org, reportBytes(location.Bytes))
+	}
+}
+
+// Write writes the report in one of the report formats. HTML reports are
+// rendered by the view, so only Markdown and PDF are written here.
+func (r *Report) Write(format string, w io.Writer) error {
+	switch format {
+	case ReportMarkdown:
+		return r.writeMarkdown(w)
+	case ReportPDF:
+		return r.writePDF(w)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+func (r *Report) writeMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# heroPacket Report: %s\n\nGenerated %s\n", markdownText(r.Filename), reportTime(r.Generated))
+	if r.Notes != "" {
+		b.WriteString("\n## Analyst Notes\n\n")
+		for _, line := range strings.Split(r.Notes, "\n") {
+			fmt.Fprintf(&b, "> %s\n", strings.TrimRight(line, "\r"))
+		}
+	}
+
+	for _, section := range r.Sections {
+		fmt.Fprintf(&b, "\n## %s\n", section.Title)
+		if len(section.Facts) > 0 {
+			b.WriteString("\n")
+		}
+		for _, fact := range section.Facts {
+			fmt.Fprintf(&b, "- **%s:** %s\n", fact.Label, markdownText(fact.Value))
+		}
+		for _, table := range section.Tables {
+			fmt.Fprintf(&b, "\n### %s\n\n", table.Title)
+			if len(table.Rows) == 0 {
+				b.WriteString("None.\n")
+				continue
+			}
+			b.WriteString("|")
+			for _, column := range table.Columns {
+				fmt.Fprintf(&b, " %s |", column)
+			}
+			b.WriteString("\n|")
+			for range table.Columns {
+				b.WriteString(" --- |")
+			}
+			b.WriteString("\n")
+			for _, row := range table.Rows {
+				b.WriteString("|")
+				for _, cell := range row {
+					fmt.Fprintf(&b, " %s |", markdownText(cell))
+				}
+				b.WriteString("\n")
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownText keeps a value on one line and out of the table syntax
+func markdownText(value string) string {
+	value = strings.NewReplacer("\r", "", "\n", " ", "|", "\\|").Replace(value)
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func reportTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05.000 MST")
+}
+
+func reportBytes(bytes int) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := int64(bytes) / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// The charts are rendered to strings for embedding. A chart that fails to
+// render, usually for lack of data, is left out.
+
+func pieSVG(values []ReportValue) string {
+	pie := chart.PieChart{Width: 420, Height: 420}
+	for _, value := range values {
+		pie.Values = append(pie.Values, chart.Value{Label: value.Label, Value: value.Value})
+	}
+	return renderSVG(pie.Render)
+}
+
+func barSVG(values []ReportValue) string {
+	bars := chart.BarChart{
+		Width:    640,
+		Height:   320,
+		BarWidth: 60,
+		XAxis:    chart.StyleShow(),
+		YAxis:    chart.YAxis{Style: chart.StyleShow()},
+	}
+	for _, value := range values {
+		bars.Bars = append(bars.Bars, chart.Value{Label: value.Label, Value: value.Value})
+	}
+	return renderSVG(bars.Render)
+}
+
+func timelineSVG(values []ReportValue) string {
+	var x, y []float64
+	for i, value := range values {
+		x = append(x, float64(i))
+		y = append(y, value.Value)
+	}
+	// A line needs two points
+	if len(x) == 1 {
+		x, y = append(x, 1), append(y, y[0])
+	}
+
+	graph := chart.Chart{
+		Width:  900,
+		Height: 300,
+		XAxis: chart.XAxis{
+			Style: chart.StyleShow(),
+			ValueFormatter: func(v interface{}) string {
+				if i, ok := v.(float64); ok && int(i) >= 0 && int(i) < len(values) {
+					return values[int(i)].Label
+				}
+				return ""
+			},
+		},
+		YAxis: chart.YAxis{
+			Name:      "Bytes",
+			NameStyle: chart.StyleShow(),
+			Style:     chart.StyleShow(),
+		},
+		Series: []chart.Series{chart.ContinuousSeries{Name: "Bytes", XValues: x, YValues: y}},
+	}
+	return renderSVG(graph.Render)
+}
+
+func renderSVG(render func(chart.RendererProvider, io.Writer) error) string {
+	var buf bytes.Buffer
+	if err := render(chart.SVG, &buf); err != nil {
+		return ""
+	}
+	return buf.String()
+}
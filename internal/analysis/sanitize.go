@@ -0,0 +1,637 @@
+package analysis
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// What a sanitized capture keeps of packet payloads
+const (
+	PayloadKeep     = "keep"
+	PayloadZero     = "zero"     // Same length, all zeros
+	PayloadTruncate = "truncate" // Cut to SanitizeOptions.Truncate bytes
+)
+
+// SanitizeKeyPath is where the key is kept when none is configured
+const SanitizeKeyPath = "sanitize.key"
+
+// SanitizeOptions configures a Sanitizer
+type SanitizeOptions struct {
+	Key       []byte            // 32 bytes: the AES key, then the Crypto-PAn pad
+	KeepOUI   bool              // Leave the vendor half of MAC addresses
+	HashNames bool              // Hash DNS names label by label
+	Payload   string            // One of the Payload actions
+	Protocols map[string]string // Payload action by protocol, e.g. "dns", over Payload
+	Truncate  int               // Payload bytes PayloadTruncate keeps
+}
+
+// SanitizeMapping is an original value and what a Sanitizer replaced it with
+type SanitizeMapping struct {
+	Kind       string // "ip", "mac" or "dns"
+	Original   string
+	Anonymized string
+}
+
+// Sanitizer rewrites packets for sharing. IPv4 and IPv6 addresses are
+// anonymized with Crypto-PAn, which preserves shared prefixes, MAC
+// addresses and DNS names are replaced by keyed hashes, payloads are kept,
+// zeroed or cut by protocol, and checksums are recomputed. The same key
+// gives the same replacements in every capture.
+//
+// Addresses inside payloads are rewritten too: DNS and DHCP messages are
+// rewritten field by field, and the datagram an ICMP error quotes has its
+// header rewritten and the rest zeroed. Bytes it cannot parse before the
+// transport layer, such as the link layer of unsupported link types or IP
+// fragments, and payloads of protocols that carry addresses it cannot
+// rewrite, are zeroed whatever the payload action.
+type Sanitizer struct {
+	opts SanitizeOptions
+	pan  *cryptoPAn
+
+	mu       sync.Mutex
+	ips      map[string]net.IP
+	mappings map[SanitizeMapping]bool
+}
+
+func NewSanitizer(opts SanitizeOptions) (*Sanitizer, error) {
+	pan, err := newCryptoPAn(opts.Key)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Payload == "" {
+		opts.Payload = PayloadKeep
+	}
+	for _, action := range append([]string{opts.Payload}, mapValues(opts.Protocols)...) {
+		if action != PayloadKeep && action != PayloadZero && action != PayloadTruncate {
+			return nil, fmt.Errorf("unknown payload action %q", action)
+		}
+	}
+	return &Sanitizer{
+		opts:     opts,
+		pan:      pan,
+		ips:      make(map[string]net.IP),
+		mappings: make(map[SanitizeMapping]bool),
+	}, nil
+}
+
+func mapValues(m map[string]string) []string {
+	var values []string
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
+
+// ParseSanitizeKey decodes a key of 64 hex digits
+func ParseSanitizeKey(value string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("sanitize key must be 64 hex digits")
+	}
+	return key, nil
+}
+
+// LoadSanitizeKey reads the key kept at path, creating the file with a
+// random key when there is none so later captures map the same way.
+func LoadSanitizeKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return ParseSanitizeKey(string(data))
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// cryptoPAn maps addresses so that two sharing an n-bit prefix still share
+// one afterwards (Xu et al., "Prefix-Preserving IP Address Anonymization").
+// Bit i of an address is flipped by the first bit of the AES encryption of
+// the bits before it padded with the pad.
+type cryptoPAn struct {
+	block cipher.Block
+	pad   [16]byte
+}
+
+func newCryptoPAn(key []byte) (*cryptoPAn, error) {
+	if len(key) != 32 {
+		return nil, errors.New("sanitize key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key[:16])
+	if err != nil {
+		return nil, err
+	}
+	c := &cryptoPAn{block: block}
+	block.Encrypt(c.pad[:], key[16:])
+	return c, nil
+}
+
+func (c *cryptoPAn) anonymize(addr []byte) []byte {
+	result := make([]byte, len(addr))
+	var input, output [16]byte
+	for i := 0; i < len(addr)*8; i++ {
+		input = c.pad
+		copy(input[:i/8], addr[:i/8])
+		if r := i % 8; r > 0 {
+			mask := byte(0xff << (8 - r))
+			input[i/8] = addr[i/8]&mask | c.pad[i/8]&^mask
+		}
+		c.block.Encrypt(output[:], input[:])
+		result[i/8] |= output[0] >> 7 << (7 - i%8)
+	}
+	for i := range result {
+		result[i] ^= addr[i]
+	}
+	return result
+}
+
+func (s *Sanitizer) record(kind, original, anonymized string) {
+	s.mu.Lock()
+	s.mappings[SanitizeMapping{Kind: kind, Original: original, Anonymized: anonymized}] = true
+	s.mu.Unlock()
+}
+
+// Mappings returns the replacements made so far, sorted by kind and
+// original value
+func (s *Sanitizer) Mappings() []SanitizeMapping {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mappings := make([]SanitizeMapping, 0, len(s.mappings))
+	for m := range s.mappings {
+		mappings = append(mappings, m)
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		if mappings[i].Kind != mappings[j].Kind {
+			return mappings[i].Kind < mappings[j].Kind
+		}
+		return mappings[i].Original < mappings[j].Original
+	})
+	return mappings
+}
+
+// IP anonymizes an address. Unspecified, loopback, multicast and broadcast
+// addresses identify no host and are left alone. IPv4-mapped IPv6
+// addresses map as their IPv4 address does.
+func (s *Sanitizer) IP(ip net.IP) net.IP {
+	if ip == nil || ip.IsUnspecified() || ip.IsLoopback() || ip.IsMulticast() || ip.Equal(net.IPv4bcast) {
+		return ip
+	}
+
+	s.mu.Lock()
+	anon, exists := s.ips[string(ip)]
+	s.mu.Unlock()
+	if exists {
+		return anon
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		anon = net.IP(s.pan.anonymize(v4))
+		if len(ip) == net.IPv6len {
+			anon = anon.To16()
+		}
+	} else {
+		anon = net.IP(s.pan.anonymize(ip.To16()))
+	}
+
+	s.mu.Lock()
+	s.ips[string(ip)] = anon
+	s.mu.Unlock()
+	s.record("ip", ip.String(), anon.String())
+	return anon
+}
+
+func (s *Sanitizer) hash(kind string, value []byte) []byte {
+	mac := hmac.New(sha256.New, s.opts.Key)
+	mac.Write([]byte(kind))
+	mac.Write(value)
+	return mac.Sum(nil)
+}
+
+// MAC scrambles a unicast MAC address, keeping its OUI if configured.
+// Scrambled addresses without the OUI are marked locally administered.
+// Broadcast and multicast addresses are left alone.
+func (s *Sanitizer) MAC(mac net.HardwareAddr) net.HardwareAddr {
+	if len(mac) != 6 || mac[0]&1 != 0 {
+		return mac
+	}
+	anon := net.HardwareAddr(s.hash("mac", mac)[:6])
+	if s.opts.KeepOUI {
+		copy(anon[:3], mac[:3])
+	} else {
+		anon[0] = anon[0]&^1 | 2
+	}
+	s.record("mac", mac.String(), anon.String())
+	return anon
+}
+
+// Name hashes each label of a DNS name but the top-level domain, so names
+// in the same domain still share a suffix
+func (s *Sanitizer) Name(name string) string {
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	if len(labels) < 2 {
+		return name
+	}
+	for i := range labels[:len(labels)-1] {
+		labels[i] = hex.EncodeToString(s.hash("dns", []byte(strings.ToLower(labels[i])))[:6])
+	}
+	anon := strings.Join(labels, ".")
+	if strings.HasSuffix(name, ".") {
+		anon += "."
+	}
+	s.record("dns", name, anon)
+	return anon
+}
+
+func (s *Sanitizer) nameBytes(name []byte) []byte {
+	if !s.opts.HashNames || len(name) == 0 {
+		return name
+	}
+	return []byte(s.Name(string(name)))
+}
+
+// action returns the payload action for a protocol stack, taken from the
+// innermost protocol with one configured
+func (s *Sanitizer) action(stack []string) string {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if action, exists := s.opts.Protocols[strings.ToLower(stack[i])]; exists {
+			return action
+		}
+	}
+	return s.opts.Payload
+}
+
+// rawLayer writes out the bytes of a header gopacket cannot serialize
+type rawLayer struct {
+	layerType gopacket.LayerType
+	contents  []byte
+}
+
+func (l rawLayer) LayerType() gopacket.LayerType { return l.layerType }
+
+func (l rawLayer) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	bytes, err := b.PrependBytes(len(l.contents))
+	if err != nil {
+		return err
+	}
+	copy(bytes, l.contents)
+	return nil
+}
+
+// Packet sanitizes one packet, returning its new bytes and capture info
+func (s *Sanitizer) Packet(data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) ([]byte, gopacket.CaptureInfo) {
+	packet := gopacket.NewPacket(data, linkType, gopacket.Default)
+	action := s.action(protocolStack(packet))
+
+	var headers []gopacket.SerializableLayer
+	var network gopacket.NetworkLayer
+	var rest []byte    // Bytes after the last header
+	transport := false // Whether rest is a TCP or UDP payload
+	udp := false
+	var srcPort, dstPort int
+	rewritten := false // Whether rest has already been sanitized
+	quoted := false    // Whether rest is a sanitized ICMP error quote
+	done := false
+
+	packetLayers := packet.Layers()
+	for i, layer := range packetLayers {
+		switch l := layer.(type) {
+		case *layers.Ethernet:
+			l.SrcMAC, l.DstMAC = s.MAC(l.SrcMAC), s.MAC(l.DstMAC)
+			headers = append(headers, l)
+		case *layers.LinuxSLL:
+			contents := append([]byte(nil), l.Contents...)
+			if len(l.Addr) == 6 {
+				copy(contents[6:12], s.MAC(l.Addr))
+			}
+			headers = append(headers, rawLayer{l.LayerType(), contents})
+		case *layers.Dot1Q, *layers.Loopback, *layers.GRE, *layers.IPv6HopByHop, *layers.IPv6Destination:
+			headers = append(headers, layer.(gopacket.SerializableLayer))
+		case *layers.IPv6Fragment, *layers.IPv6Routing:
+			headers = append(headers, rawLayer{layer.LayerType(), layer.LayerContents()})
+		case *layers.ARP:
+			if len(l.SourceHwAddress) == 6 {
+				l.SourceHwAddress = s.MAC(l.SourceHwAddress)
+				l.DstHwAddress = s.MAC(l.DstHwAddress)
+			}
+			if len(l.SourceProtAddress) == 4 {
+				l.SourceProtAddress = s.IP(net.IP(l.SourceProtAddress)).To4()
+				l.DstProtAddress = s.IP(net.IP(l.DstProtAddress)).To4()
+			}
+			headers = append(headers, l)
+			done = true // What follows is padding
+		case *layers.IPv4:
+			l.SrcIP, l.DstIP = s.IP(l.SrcIP), s.IP(l.DstIP)
+			network = l
+			headers = append(headers, l)
+		case *layers.IPv6:
+			l.SrcIP, l.DstIP = s.IP(l.SrcIP), s.IP(l.DstIP)
+			network = l
+			headers = append(headers, l)
+		case *layers.TCP:
+			l.SetNetworkLayerForChecksum(network)
+			headers = append(headers, l)
+			transport = true
+			srcPort, dstPort = int(l.SrcPort), int(l.DstPort)
+		case *layers.UDP:
+			l.SetNetworkLayerForChecksum(network)
+			headers = append(headers, l)
+			transport, udp = true, true
+			srcPort, dstPort = int(l.SrcPort), int(l.DstPort)
+		case *layers.ICMPv4:
+			if l.TypeCode.Type() == layers.ICMPv4TypeRedirect {
+				// The gateway address sits where echoes keep Id and Seq
+				gateway := make(net.IP, 4)
+				binary.BigEndian.PutUint16(gateway[:2], l.Id)
+				binary.BigEndian.PutUint16(gateway[2:], l.Seq)
+				gateway = s.IP(gateway).To4()
+				l.Id, l.Seq = binary.BigEndian.Uint16(gateway[:2]), binary.BigEndian.Uint16(gateway[2:])
+			}
+			headers = append(headers, l)
+			switch l.TypeCode.Type() {
+			case layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4TypeSourceQuench, layers.ICMPv4TypeRedirect,
+				layers.ICMPv4TypeTimeExceeded, layers.ICMPv4TypeParameterProblem:
+				rest, quoted, done = s.quotedIPv4(l.Payload), true, true
+			}
+		case *layers.ICMPv6:
+			l.SetNetworkLayerForChecksum(network)
+			headers = append(headers, l)
+			switch l.TypeCode.Type() {
+			case layers.ICMPv6TypeDestinationUnreachable, layers.ICMPv6TypePacketTooBig,
+				layers.ICMPv6TypeTimeExceeded, layers.ICMPv6TypeParameterProblem:
+				// Four bytes of MTU or pointer come before the quote
+				rest = make([]byte, len(l.Payload))
+				if len(l.Payload) >= 4 {
+					copy(rest, l.Payload[:4])
+					copy(rest[4:], s.quotedIPv6(l.Payload[4:]))
+				}
+				quoted, done = true, true
+			}
+		case *layers.ICMPv6Echo:
+			headers = append(headers, l)
+		case *layers.ICMPv6RouterSolicitation:
+			s.icmpv6Options(l.Options)
+			headers = append(headers, l)
+		case *layers.ICMPv6RouterAdvertisement:
+			s.icmpv6Options(l.Options)
+			headers = append(headers, l)
+		case *layers.ICMPv6NeighborSolicitation:
+			l.TargetAddress = s.IP(l.TargetAddress)
+			s.icmpv6Options(l.Options)
+			headers = append(headers, l)
+		case *layers.ICMPv6NeighborAdvertisement:
+			l.TargetAddress = s.IP(l.TargetAddress)
+			s.icmpv6Options(l.Options)
+			headers = append(headers, l)
+		case *layers.ICMPv6Redirect:
+			l.TargetAddress, l.DestinationAddress = s.IP(l.TargetAddress), s.IP(l.DestinationAddress)
+			s.icmpv6Options(l.Options)
+			headers = append(headers, l)
+		case *layers.DNS:
+			// gopacket reads DNS over TCP without its length prefix and
+			// cannot write every record type, so such messages are zeroed
+			rest = make([]byte, len(l.LayerContents())+len(l.LayerPayload()))
+			if udp && dnsSerializable(l) {
+				s.dns(l)
+				if data, err := serializeLayer(l); err == nil {
+					rest, rewritten = data, true
+				}
+			}
+			done = true
+		case *layers.DHCPv4:
+			rest = make([]byte, len(l.LayerContents())+len(l.LayerPayload()))
+			s.dhcp(l)
+			if data, err := serializeLayer(l); err == nil {
+				rest, rewritten = data, true
+			}
+			done = true
+		default:
+			rest = append(append([]byte(nil), layer.LayerContents()...), layer.LayerPayload()...)
+			done = true
+		}
+		if done {
+			break
+		}
+		if i == len(packetLayers)-1 {
+			rest = layer.LayerPayload()
+		}
+	}
+
+	switch {
+	case quoted:
+	case !transport:
+		rest = make([]byte, len(rest))
+	case !rewritten && (addressPorts[srcPort] || addressPorts[dstPort]):
+		rest = make([]byte, len(rest))
+	case action == PayloadZero:
+		rest = make([]byte, len(rest))
+	case action == PayloadTruncate && len(rest) > s.opts.Truncate:
+		rest = rest[:s.opts.Truncate]
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, append(headers, gopacket.Payload(rest))...); err != nil {
+		// Nothing of a packet that cannot be rewritten is kept
+		return make([]byte, len(data)), ci
+	}
+	out := append([]byte(nil), buf.Bytes()...)
+	ci.CaptureLength, ci.Length = len(out), len(out)
+	return out, ci
+}
+
+// addressPorts are the ports of protocols whose payloads carry addresses
+// or host names that are not rewritten: NetBIOS name and datagram
+// services, DHCPv6, mDNS and LLMNR, and DNS or DHCP gopacket failed to
+// decode. Their payloads are zeroed.
+var addressPorts = map[int]bool{53: true, 67: true, 68: true, 137: true, 138: true, 546: true, 547: true, 5353: true, 5355: true}
+
+// serializeLayer writes one layer on its own
+func serializeLayer(layer gopacket.SerializableLayer) ([]byte, error) {
+	buf := gopacket.NewSerializeBuffer()
+	if err := layer.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+// quotedIPv4 rewrites the datagram an ICMPv4 error quotes. Its addresses
+// are anonymized as the packet's own are, and its ports are kept, but IP
+// options and anything past the eight bytes after the header are zeroed.
+func (s *Sanitizer) quotedIPv4(data []byte) []byte {
+	out := make([]byte, len(data))
+	if len(data) < 20 || data[0]>>4 != 4 {
+		return out
+	}
+	headerLen := int(data[0]&0x0f) * 4
+	if headerLen < 20 || headerLen > len(data) {
+		return out
+	}
+	copy(out[:20], data[:20])
+	copy(out[12:16], s.IP(net.IP(data[12:16])).To4())
+	copy(out[16:20], s.IP(net.IP(data[16:20])).To4())
+	copy(out[headerLen:], data[headerLen:min(headerLen+8, len(data))])
+
+	out[10], out[11] = 0, 0
+	var sum uint32
+	for i := 0; i < headerLen; i += 2 {
+		sum += uint32(out[i])<<8 | uint32(out[i+1])
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	binary.BigEndian.PutUint16(out[10:12], ^uint16(sum))
+	return out
+}
+
+// quotedIPv6 rewrites the datagram an ICMPv6 error quotes as quotedIPv4
+// does, keeping eight bytes after the fixed header
+func (s *Sanitizer) quotedIPv6(data []byte) []byte {
+	out := make([]byte, len(data))
+	if len(data) < 40 || data[0]>>4 != 6 {
+		return out
+	}
+	copy(out, data[:min(48, len(data))])
+	copy(out[8:24], s.IP(net.IP(data[8:24])).To16())
+	copy(out[24:40], s.IP(net.IP(data[24:40])).To16())
+	return out
+}
+
+// DHCP options holding IPv4 addresses, and options holding neither
+// addresses nor names. The data of any other option is zeroed.
+var (
+	dhcpAddressOptions = map[layers.DHCPOpt]bool{
+		layers.DHCPOptRouter: true, layers.DHCPOptTimeServer: true, layers.DHCPOptNameServer: true,
+		layers.DHCPOptDNS: true, layers.DHCPOptLogServer: true, layers.DHCPOptBroadcastAddr: true,
+		layers.DHCPOptNTPServers: true, layers.DHCPOptNetBIOSTCPNS: true, layers.DHCPOptNetBIOSTCPDDS: true,
+		layers.DHCPOptRequestIP: true, layers.DHCPOptServerID: true,
+	}
+	dhcpPlainOptions = map[layers.DHCPOpt]bool{
+		layers.DHCPOptPad: true, layers.DHCPOptEnd: true, layers.DHCPOptSubnetMask: true,
+		layers.DHCPOptInterfaceMTU: true, layers.DHCPOptLeaseTime: true, layers.DHCPOptMessageType: true,
+		layers.DHCPOptParamsRequest: true, layers.DHCPOptMaxMessageSize: true, layers.DHCPOptT1: true,
+		layers.DHCPOptT2: true, layers.DHCPOptClassID: true,
+	}
+)
+
+// dhcp anonymizes the addresses in a DHCP message. Server and file names,
+// and options that may name the client, are zeroed.
+func (s *Sanitizer) dhcp(dhcp *layers.DHCPv4) {
+	dhcp.ClientIP, dhcp.YourClientIP = s.IP(dhcp.ClientIP), s.IP(dhcp.YourClientIP)
+	dhcp.NextServerIP, dhcp.RelayAgentIP = s.IP(dhcp.NextServerIP), s.IP(dhcp.RelayAgentIP)
+	if len(dhcp.ClientHWAddr) == 6 {
+		dhcp.ClientHWAddr = s.MAC(dhcp.ClientHWAddr)
+	} else {
+		dhcp.ClientHWAddr = make(net.HardwareAddr, len(dhcp.ClientHWAddr))
+	}
+	dhcp.ServerName, dhcp.File = nil, nil
+	for i := range dhcp.Options {
+		opt := &dhcp.Options[i]
+		data := make([]byte, len(opt.Data))
+		switch {
+		case dhcpPlainOptions[opt.Type]:
+			copy(data, opt.Data)
+		case dhcpAddressOptions[opt.Type]:
+			for j := 0; j+4 <= len(opt.Data); j += 4 {
+				copy(data[j:j+4], s.IP(net.IP(opt.Data[j:j+4])).To4())
+			}
+		case opt.Type == layers.DHCPOptClientID && len(opt.Data) == 7 && opt.Data[0] == 1:
+			// Hardware type 1 and an Ethernet address
+			data[0] = 1
+			copy(data[1:], s.MAC(net.HardwareAddr(opt.Data[1:])))
+		}
+		opt.Data = data
+	}
+}
+
+func (s *Sanitizer) icmpv6Options(options layers.ICMPv6Options) {
+	for _, opt := range options {
+		if (opt.Type == layers.ICMPv6OptSourceAddress || opt.Type == layers.ICMPv6OptTargetAddress) && len(opt.Data) >= 6 {
+			copy(opt.Data[:6], s.MAC(net.HardwareAddr(opt.Data[:6])))
+		}
+	}
+}
+
+// dnsSerializable reports whether gopacket can write all records of a
+// DNS message
+func dnsSerializable(dns *layers.DNS) bool {
+	for _, records := range [][]layers.DNSResourceRecord{dns.Answers, dns.Authorities, dns.Additionals} {
+		for _, rr := range records {
+			switch rr.Type {
+			case layers.DNSTypeA, layers.DNSTypeAAAA, layers.DNSTypeNS, layers.DNSTypeCNAME, layers.DNSTypePTR,
+				layers.DNSTypeSOA, layers.DNSTypeMX, layers.DNSTypeTXT, layers.DNSTypeSRV, layers.DNSTypeOPT:
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// dns anonymizes the addresses in a DNS message and, if configured, hashes
+// its names. TXT records are hashed along with names.
+func (s *Sanitizer) dns(dns *layers.DNS) {
+	for i := range dns.Questions {
+		dns.Questions[i].Name = s.nameBytes(dns.Questions[i].Name)
+	}
+	for _, records := range [][]layers.DNSResourceRecord{dns.Answers, dns.Authorities, dns.Additionals} {
+		for i := range records {
+			rr := &records[i]
+			rr.Name = s.nameBytes(rr.Name)
+			switch rr.Type {
+			case layers.DNSTypeA:
+				rr.IP = s.IP(rr.IP).To4()
+			case layers.DNSTypeAAAA:
+				rr.IP = s.IP(rr.IP).To16()
+			case layers.DNSTypeNS:
+				rr.NS = s.nameBytes(rr.NS)
+			case layers.DNSTypeCNAME:
+				rr.CNAME = s.nameBytes(rr.CNAME)
+			case layers.DNSTypePTR:
+				rr.PTR = s.nameBytes(rr.PTR)
+			case layers.DNSTypeSOA:
+				rr.SOA.MName, rr.SOA.RName = s.nameBytes(rr.SOA.MName), s.nameBytes(rr.SOA.RName)
+			case layers.DNSTypeMX:
+				rr.MX.Name = s.nameBytes(rr.MX.Name)
+			case layers.DNSTypeSRV:
+				rr.SRV.Name = s.nameBytes(rr.SRV.Name)
+			case layers.DNSTypeOPT:
+				for j := range rr.OPT {
+					// Family, source and scope prefix lengths, then the client subnet
+					if rr.OPT[j].Code == layers.DNSOptionCodeEDNSClientSubnet && len(rr.OPT[j].Data) > 4 {
+						rr.OPT[j].Data = append(rr.OPT[j].Data[:4:4], make([]byte, len(rr.OPT[j].Data)-4)...)
+					}
+				}
+			case layers.DNSTypeTXT:
+				if s.opts.HashNames {
+					for j, txt := range rr.TXTs {
+						rr.TXTs[j] = []byte(hex.EncodeToString(s.hash("txt", txt)[:8]))
+					}
+				}
+			}
+		}
+	}
+}
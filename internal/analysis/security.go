@@ -1,7 +1,8 @@
 package analysis
 
 import (
-	"heroPacket/internal/models"
+	"github.com/shreethaar/heroPacket/internal/models"
+	"sort"
 	"sync"
 )
 
@@ -43,3 +44,28 @@ func (s *SecurityAnalyzer) Process(packet models.Packet) {
 	// Implementation would track rapid connection attempts
 	// to multiple ports from the same IP
 }
+
+// PortCount is how many packets used a sensitive port
+type PortCount struct {
+	Port    uint16
+	Service string
+	Count   int
+}
+
+// PortCounts returns the sensitive ports seen, busiest first
+func (s *SecurityAnalyzer) PortCounts() []PortCount {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make([]PortCount, 0, len(s.SuspiciousPorts))
+	for port, count := range s.SuspiciousPorts {
+		counts = append(counts, PortCount{Port: port, Service: payloadProtocols[port], Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Port < counts[j].Port
+	})
+	return counts
+}
@@ -1,53 +1,282 @@
 package analysis
 
 import (
-	"heroPacket/internal/models"
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/models"
 	"io"
 	"sort"
 )
 
+// Session runs the enabled analyzers over a capture, along with stream
+// reassembly, name resolution and the packet list that they build on
 type Session struct {
-	protocols     *ProtocolAnalyzer
-	stats         *TrafficStats
-	conversations *ConversationTracker
-	dns           *DNSAnalyzer
-	http          *HTTPAnalyzer
-	security      *SecurityAnalyzer
-	networkMap    *NetworkMapAnalyzer
+	streams  *StreamTracker
+	names    *NameResolver
+	packets  *PacketList
+	index    *PacketIndex
+	keyLog   *KeyLog
+	disabled map[string]bool
+	config   map[string]map[string]string
+	runs     []analyzerRun
+	started  bool
+}
+
+// SessionRef holds the session behind an analysis of the capture package.
+// capture.Analysis embeds it under an unexported name, so heroPacket's
+// pages and commands can reach results that package does not export
+// through SessionOf, while code outside the module cannot.
+type SessionRef struct {
+	session *Session
+}
+
+func NewSessionRef(session *Session) SessionRef {
+	return SessionRef{session: session}
+}
+
+func (r SessionRef) heldSession() *Session {
+	return r.session
+}
+
+// SessionHolder is implemented only by types embedding a SessionRef
+type SessionHolder interface {
+	heldSession() *Session
+}
+
+// SessionOf returns the session behind an analysis of the capture package
+func SessionOf(holder SessionHolder) *Session {
+	return holder.heldSession()
 }
 
 func NewSession() *Session {
 	return &Session{
-		protocols:     NewProtocolAnalyzer(),
-		stats:         NewTrafficStats(),
-		conversations: NewConversationTracker(),
-		dns:           NewDNSAnalyzer(),
-		http:          NewHTTPAnalyzer(),
-		security:      NewSecurityAnalyzer(),
-		networkMap:    NewNetworkMapAnalyzer(),
+		streams: NewStreamTracker(),
+		names:   NewNameResolver(),
+		packets: NewPacketList(),
+	}
+}
+
+// Built-in analyzers. Stream reassembly, name resolution and the packet
+// list always run since the others build on them.
+const (
+	AnalyzerProtocols     = "protocols"
+	AnalyzerTraffic       = "traffic"
+	AnalyzerConversations = "conversations"
+	AnalyzerEndpoints     = "endpoints"
+	AnalyzerDNS           = "dns"
+	AnalyzerHTTP          = "http"
+	AnalyzerTLS           = "tls"
+	AnalyzerNetworkMap    = "network_map"
+	AnalyzerFindings      = "findings"
+)
+
+// analyzerRun is a registered analyzer started for the session
+type analyzerRun struct {
+	plugin   *Plugin
+	analyzer Analyzer
+}
+
+// Disable leaves analyzers out of the session, together with those that
+// require them. Their results stay empty. It must be called before the
+// first packet is processed.
+func (s *Session) Disable(names ...string) error {
+	if s.started {
+		return fmt.Errorf("analyzers must be chosen before the first packet")
+	}
+	for _, name := range names {
+		if _, known := LookupPlugin(name); !known {
+			return fmt.Errorf("unknown analyzer %q", name)
+		}
+		if s.disabled == nil {
+			s.disabled = make(map[string]bool)
+		}
+		s.disabled[name] = true
+	}
+	return nil
+}
+
+// Configure sets options of an analyzer, given as text and checked against
+// its config schema. Options left out keep their defaults. It must be
+// called before the first packet is processed.
+func (s *Session) Configure(name string, values map[string]string) error {
+	if s.started {
+		return fmt.Errorf("analyzers must be configured before the first packet")
+	}
+	plugin, known := LookupPlugin(name)
+	if !known {
+		return fmt.Errorf("unknown analyzer %q", name)
+	}
+	if _, err := plugin.parseConfig(values); err != nil {
+		return err
+	}
+	if s.config == nil {
+		s.config = make(map[string]map[string]string)
+	}
+	s.config[name] = values
+	return nil
+}
+
+// Config returns the settings an analyzer runs with
+func (s *Session) Config(name string) Config {
+	plugin, known := LookupPlugin(name)
+	if !known {
+		return nil
+	}
+	config, _ := plugin.parseConfig(s.config[name])
+	return config
+}
+
+// Enabled reports whether an analyzer runs in the session: it is
+// registered, was not disabled and neither were the analyzers it requires
+func (s *Session) Enabled(name string) bool {
+	plugin, known := LookupPlugin(name)
+	if !known || s.disabled[name] {
+		return false
+	}
+	for _, required := range plugin.Requires {
+		if !s.Enabled(required) {
+			return false
+		}
+	}
+	return true
+}
+
+// start starts the enabled analyzers, which then can no longer be chosen
+func (s *Session) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	for _, plugin := range plugins {
+		if s.Enabled(plugin.Name) {
+			s.runs = append(s.runs, analyzerRun{plugin, plugin.New(s, s.Config(plugin.Name))})
+		}
 	}
 }
 
 func (s *Session) Process(p models.Packet) {
-	s.protocols.Process(p)
-	s.stats.Process(p)
-	s.conversations.Process(p)
-	s.dns.Process(p)
-	s.http.Process(p)
-	s.security.Process(p)
-	s.networkMap.Process(p)
+	s.start()
+	s.streams.Process(p)
+	s.names.Process(p)
+	for _, run := range s.runs {
+		run.analyzer.Process(p)
+	}
+	s.packets.Process(p)
+}
+
+// Finish must be called once every packet has been processed. It hands the
+// reassembled streams to the analyzers that parse application protocols,
+// then finishes the analyzers as Analyzer describes.
+func (s *Session) Finish() {
+	s.start()
+	s.streams.Finish()
+
+	for _, stream := range s.streams.Streams {
+		s.names.ProcessStream(stream)
+		for _, run := range s.runs {
+			if processor, ok := run.analyzer.(StreamProcessor); ok {
+				processor.ProcessStream(stream)
+			}
+		}
+	}
+
+	var handshakes []*TLSSession
+	for _, run := range s.runs {
+		if source, ok := run.analyzer.(NameSource); ok {
+			source.AddNames(s.names)
+		}
+		if source, ok := run.analyzer.(TLSSource); ok {
+			handshakes = append(handshakes, source.GetSessions()...)
+		}
+	}
+	names := s.names.Map()
+
+	var sources []ExpertSource
+	for _, run := range s.runs {
+		if user, ok := run.analyzer.(NameUser); ok {
+			user.SetNames(names)
+		}
+		if user, ok := run.analyzer.(TLSUser); ok {
+			for _, handshake := range handshakes {
+				user.AttachTLS(handshake)
+			}
+		}
+		if finisher, ok := run.analyzer.(Finisher); ok {
+			finisher.Finish()
+		}
+		if source, ok := run.analyzer.(ExpertSource); ok {
+			sources = append(sources, source)
+		}
+	}
+	for _, run := range s.runs {
+		if collector, ok := run.analyzer.(ExpertCollector); ok {
+			collector.Collect(sources...)
+		}
+	}
+}
+
+// Analyzer returns the running analyzer of a plugin, or nil when it is not
+// enabled
+func (s *Session) Analyzer(name string) Analyzer {
+	s.start()
+	for _, run := range s.runs {
+		if run.plugin.Name == name {
+			return run.analyzer
+		}
+	}
+	return nil
+}
+
+// SetKeyLog supplies TLS secrets for decryption. It must be called before
+// Finish.
+func (s *Session) SetKeyLog(keys *KeyLog) {
+	s.keyLog = keys
+	if s.started {
+		s.TLS().KeyLog = keys
+	}
+}
+
+// SetIndex supplies the packet index of the capture, used to read packets
+// back from the file.
+func (s *Session) SetIndex(index *PacketIndex) {
+	s.index = index
+}
+
+// Index returns the packet index, or nil when the capture could not be
+// indexed.
+func (s *Session) Index() *PacketIndex {
+	return s.index
+}
+
+func (s *Session) Endpoints() *EndpointAnalyzer {
+	return builtinPart(s, AnalyzerEndpoints, NewEndpointAnalyzer)
+}
+
+func (s *Session) Packets() *PacketList {
+	return s.packets
+}
+
+func (s *Session) Expert() *ExpertInfo {
+	return builtinPart(s, AnalyzerFindings, NewExpertInfo)
+}
+
+func (s *Session) TCPHealth() *TCPHealthAnalyzer {
+	return builtinPart(s, AnalyzerFindings, NewTCPHealthAnalyzer)
+}
+
+func (s *Session) Names() *NameResolver {
+	return s.names
 }
 
 func (s *Session) Protocols() *ProtocolAnalyzer {
-	return s.protocols
+	return builtinPart(s, AnalyzerProtocols, NewProtocolAnalyzer)
 }
 
 func (s *Session) TrafficStats() *TrafficStats {
-	return s.stats
+	return builtinPart(s, AnalyzerTraffic, NewTrafficStats)
 }
 
 func (s *Session) Conversations() *ConversationTracker {
-	return s.conversations
+	return builtinPart(s, AnalyzerConversations, NewConversationTracker)
 }
 
 // Add these to existing analyzer structs if missing
@@ -75,13 +304,16 @@ func (p *ProtocolAnalyzer) Top(n int) []ProtocolCount {
 	return counts
 }
 
+// Top returns the TCP and UDP conversations with the most packets
 func (c *ConversationTracker) Top(n int) []*Conversation {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	conversations := make([]*Conversation, 0, len(c.Conversations))
 	for _, conv := range c.Conversations {
-		conversations = append(conversations, conv)
+		if conv.Type == ConversationTCP || conv.Type == ConversationUDP {
+			conversations = append(conversations, conv)
+		}
 	}
 
 	sort.Slice(conversations, func(i, j int) bool {
@@ -126,9 +358,33 @@ func (c *Chart) Render(w io.Writer) error {
 
 // Add getter for network map
 func (s *Session) NetworkMap() *NetworkMapAnalyzer {
-	return s.networkMap
+	return builtinPart(s, AnalyzerNetworkMap, NewNetworkMapAnalyzer)
 }
 
 func (s *Session) DNS() *DNSAnalyzer {
-	return s.dns
+	return builtinPart(s, AnalyzerDNS, NewDNSAnalyzer)
+}
+
+func (s *Session) DNSThreats() *DNSThreatAnalyzer {
+	return builtinPart(s, AnalyzerDNS, NewDNSThreatAnalyzer)
+}
+
+func (s *Session) HTTP() *HTTPAnalyzer {
+	return builtinPart(s, AnalyzerHTTP, NewHTTPAnalyzer)
+}
+
+func (s *Session) TLS() *TLSAnalyzer {
+	return builtinPart(s, AnalyzerTLS, NewTLSAnalyzer)
+}
+
+func (s *Session) Security() *SecurityAnalyzer {
+	return builtinPart(s, AnalyzerFindings, NewSecurityAnalyzer)
+}
+
+func (s *Session) Certificates() *CertificateAnalyzer {
+	return builtinPart(s, AnalyzerTLS, NewCertificateAnalyzer)
+}
+
+func (s *Session) Streams() *StreamTracker {
+	return s.streams
 }
@@ -1,7 +1,7 @@
 package analysis
 
 import (
-    "heroPacket/internal/models"
+    "github.com/shreethaar/heroPacket/internal/models"
     "sync"
     "time"
 )
@@ -0,0 +1,345 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// StreamDirection tells which side of a stream sent a chunk of payload.
+type StreamDirection int
+
+const (
+	ClientToServer StreamDirection = iota
+	ServerToClient
+)
+
+func (d StreamDirection) String() string {
+	if d == ServerToClient {
+		return "server"
+	}
+	return "client"
+}
+
+// StreamChunk is a run of consecutive payload bytes sent in one direction.
+type StreamChunk struct {
+	Direction StreamDirection
+	Timestamp time.Time
+	Packet    int // Number of the first packet contributing to the chunk
+	Data      []byte
+}
+
+// Stream is a reassembled TCP connection or UDP flow between two endpoints.
+type Stream struct {
+	Index      int
+	Protocol   string
+	ClientIP   string
+	ClientPort uint16
+	ServerIP   string
+	ServerPort uint16
+	Packets    int
+	Numbers    []int // Of the packets in the stream, in capture order
+	StartTime  time.Time
+	EndTime    time.Time
+	Chunks     []*StreamChunk
+	Decrypted  *Stream // Plaintext of a TLS stream, when its keys are known
+
+	tcp   [2]tcpReassembly
+	marks [2][]streamMark
+	sent  [2]int
+}
+
+// streamMark records when the byte at a given offset of one direction
+// arrived, so positions in the reassembled data can be mapped back to time.
+type streamMark struct {
+	offset    int
+	timestamp time.Time
+	packet    int
+}
+
+type tcpReassembly struct {
+	started bool
+	next    uint32
+	pending []pendingSegment
+}
+
+type pendingSegment struct {
+	seq       uint32
+	timestamp time.Time
+	packet    int
+	data      []byte
+}
+
+// StreamProcessor is implemented by analyzers that work on reassembled
+// streams rather than on individual packets.
+type StreamProcessor interface {
+	ProcessStream(*Stream)
+}
+
+// StreamTracker reassembles TCP and UDP payloads into numbered streams, in
+// the order the streams first appear in the capture.
+type StreamTracker struct {
+	mu      sync.Mutex
+	Streams []*Stream
+	index   map[string]*Stream
+}
+
+func NewStreamTracker() *StreamTracker {
+	return &StreamTracker{
+		index: make(map[string]*Stream),
+	}
+}
+
+func (t *StreamTracker) Process(packet models.Packet) {
+	if packet.Protocol != "TCP" && packet.Protocol != "UDP" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := streamKey(packet)
+	stream, exists := t.index[key]
+	if !exists {
+		stream = &Stream{
+			Index:      len(t.Streams),
+			Protocol:   packet.Protocol,
+			ClientIP:   packet.SourceIP,
+			ClientPort: packet.SourcePort,
+			ServerIP:   packet.DestIP,
+			ServerPort: packet.DestPort,
+			StartTime:  packet.Timestamp,
+		}
+		// A SYN/ACK seen before the SYN means we joined mid-handshake and
+		// the sender is the server.
+		if packet.TCP != nil && packet.TCP.SYN && packet.TCP.ACK {
+			stream.ClientIP, stream.ServerIP = stream.ServerIP, stream.ClientIP
+			stream.ClientPort, stream.ServerPort = stream.ServerPort, stream.ClientPort
+		}
+		t.Streams = append(t.Streams, stream)
+		t.index[key] = stream
+	}
+
+	stream.Packets++
+	stream.Numbers = append(stream.Numbers, packet.Number)
+	stream.EndTime = packet.Timestamp
+
+	dir := ClientToServer
+	if packet.SourceIP == stream.ServerIP && packet.SourcePort == stream.ServerPort {
+		dir = ServerToClient
+	}
+
+	if packet.TCP == nil {
+		if len(packet.Payload) > 0 {
+			stream.appendData(dir, packet.Timestamp, packet.Number, packet.Payload, false)
+		}
+		return
+	}
+	stream.processTCP(dir, packet)
+}
+
+// Finish flushes segments still waiting for missing data, so that the
+// payload after a gap in the capture is not lost.
+func (t *StreamTracker) Finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, stream := range t.Streams {
+		for dir := range stream.tcp {
+			r := &stream.tcp[dir]
+			sort.Slice(r.pending, func(i, j int) bool {
+				return int32(r.pending[i].seq-r.pending[j].seq) < 0
+			})
+			for _, seg := range r.pending {
+				if int32(seg.seq-r.next) > 0 {
+					r.next = seg.seq
+				}
+				stream.acceptSegment(StreamDirection(dir), seg)
+			}
+			r.pending = nil
+		}
+	}
+}
+
+// Get returns the stream with the given index, or nil if there is none.
+func (t *StreamTracker) Get(index int) *Stream {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if index < 0 || index >= len(t.Streams) {
+		return nil
+	}
+	return t.Streams[index]
+}
+
+// Count returns the number of streams in the capture.
+func (t *StreamTracker) Count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.Streams)
+}
+
+// FirstIndex returns the index of the first stream between two endpoints
+// over the given protocol, in either direction, or -1 if there is none.
+func (t *StreamTracker) FirstIndex(a string, aPort uint16, b string, bPort uint16, protocol string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, stream := range t.Streams {
+		if stream.Protocol != protocol {
+			continue
+		}
+		if (stream.ClientIP == a && stream.ClientPort == aPort && stream.ServerIP == b && stream.ServerPort == bPort) ||
+			(stream.ClientIP == b && stream.ClientPort == bPort && stream.ServerIP == a && stream.ServerPort == aPort) {
+			return stream.Index
+		}
+	}
+	return -1
+}
+
+// Data returns every payload byte sent in one direction, in stream order.
+func (s *Stream) Data(dir StreamDirection) []byte {
+	var data []byte
+	for _, chunk := range s.Chunks {
+		if chunk.Direction == dir {
+			data = append(data, chunk.Data...)
+		}
+	}
+	return data
+}
+
+// Bytes returns the number of payload bytes sent in one direction.
+func (s *Stream) Bytes(dir StreamDirection) int {
+	return s.sent[dir]
+}
+
+// TimeAt returns when the byte at offset of one direction's data was seen.
+func (s *Stream) TimeAt(dir StreamDirection, offset int) time.Time {
+	marks := s.marks[dir]
+	i := sort.Search(len(marks), func(i int) bool { return marks[i].offset > offset })
+	if i == 0 {
+		return s.StartTime
+	}
+	return marks[i-1].timestamp
+}
+
+// PacketAt returns the number of the packet that carried the byte at offset
+// of one direction's data, or zero if that direction sent nothing.
+func (s *Stream) PacketAt(dir StreamDirection, offset int) int {
+	marks := s.marks[dir]
+	i := sort.Search(len(marks), func(i int) bool { return marks[i].offset > offset })
+	if i == 0 {
+		return 0
+	}
+	return marks[i-1].packet
+}
+
+// chunkIndex returns the index of the chunk holding the byte at offset of
+// one direction's data.
+func (s *Stream) chunkIndex(dir StreamDirection, offset int) int {
+	seen := 0
+	last := 0
+	for i, chunk := range s.Chunks {
+		if chunk.Direction != dir {
+			continue
+		}
+		last = i
+		seen += len(chunk.Data)
+		if offset < seen {
+			return i
+		}
+	}
+	return last
+}
+
+func (s *Stream) String() string {
+	return fmt.Sprintf("%s %s:%d -> %s:%d", s.Protocol, s.ClientIP, s.ClientPort, s.ServerIP, s.ServerPort)
+}
+
+func (s *Stream) processTCP(dir StreamDirection, packet models.Packet) {
+	r := &s.tcp[dir]
+	if packet.TCP.SYN {
+		r.started = true
+		r.next = packet.TCP.Seq + 1
+		return
+	}
+	if len(packet.Payload) == 0 {
+		return
+	}
+	if !r.started {
+		r.started = true
+		r.next = packet.TCP.Seq
+	}
+
+	seg := pendingSegment{
+		seq:       packet.TCP.Seq,
+		timestamp: packet.Timestamp,
+		packet:    packet.Number,
+		data:      packet.Payload,
+	}
+	if int32(seg.seq-r.next) > 0 {
+		// Out of order: hold it until the gap before it is filled.
+		r.pending = append(r.pending, seg)
+		return
+	}
+	s.acceptSegment(dir, seg)
+
+	for progress := true; progress && len(r.pending) > 0; {
+		progress = false
+		for i := 0; i < len(r.pending); i++ {
+			if int32(r.pending[i].seq-r.next) <= 0 {
+				seg := r.pending[i]
+				r.pending = append(r.pending[:i], r.pending[i+1:]...)
+				s.acceptSegment(dir, seg)
+				progress = true
+				break
+			}
+		}
+	}
+}
+
+// acceptSegment appends the part of a segment not already delivered,
+// dropping retransmitted bytes.
+func (s *Stream) acceptSegment(dir StreamDirection, seg pendingSegment) {
+	r := &s.tcp[dir]
+	overlap := int(int32(r.next - seg.seq))
+	if overlap >= len(seg.data) {
+		return
+	}
+	data := seg.data
+	if overlap > 0 {
+		data = data[overlap:]
+	}
+	r.next += uint32(len(data))
+	s.appendData(dir, seg.timestamp, seg.packet, data, true)
+}
+
+func (s *Stream) appendData(dir StreamDirection, ts time.Time, packet int, data []byte, merge bool) {
+	s.marks[dir] = append(s.marks[dir], streamMark{offset: s.sent[dir], timestamp: ts, packet: packet})
+	s.sent[dir] += len(data)
+
+	if merge && len(s.Chunks) > 0 {
+		if last := s.Chunks[len(s.Chunks)-1]; last.Direction == dir {
+			last.Data = append(last.Data, data...)
+			return
+		}
+	}
+	s.Chunks = append(s.Chunks, &StreamChunk{
+		Direction: dir,
+		Timestamp: ts,
+		Packet:    packet,
+		Data:      append([]byte(nil), data...),
+	})
+}
+
+func streamKey(packet models.Packet) string {
+	a := fmt.Sprintf("%s:%d", packet.SourceIP, packet.SourcePort)
+	b := fmt.Sprintf("%s:%d", packet.DestIP, packet.DestPort)
+	if a > b {
+		a, b = b, a
+	}
+	return packet.Protocol + "|" + a + "|" + b
+}
@@ -0,0 +1,472 @@
+package analysis
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Table formats
+const (
+	TableCSV    = "csv"
+	TableJSON   = "json"
+	TableNDJSON = "ndjson"
+	TableText   = "txt"
+)
+
+// Tables of analysis results
+const (
+	TableProtocols     = "protocols"
+	TableConversations = "conversations"
+	TableEndpoints     = "endpoints"
+	TableDNS           = "dns_queries"
+	TableHTTP          = "http_transactions"
+	TableTLS           = "tls_handshakes"
+	TableNodes         = "network_nodes"
+	TableConnections   = "connections"
+	TableFindings      = "findings"
+	TableGeoIP         = "geoip"
+)
+
+var TableNames = []string{
+	TableProtocols, TableConversations, TableEndpoints, TableDNS,
+	TableHTTP, TableTLS, TableNodes, TableConnections, TableFindings, TableGeoIP,
+}
+
+// TableTitles names the tables for people
+var TableTitles = map[string]string{
+	TableProtocols:     "Protocol Hierarchy",
+	TableConversations: "Conversations",
+	TableEndpoints:     "Endpoints",
+	TableDNS:           "DNS Queries",
+	TableHTTP:          "HTTP Transactions",
+	TableTLS:           "TLS Handshakes",
+	TableNodes:         "Network Nodes",
+	TableConnections:   "Network Connections",
+	TableFindings:      "Findings",
+	TableGeoIP:         "GeoIP",
+}
+
+// Column types. Times are RFC 3339 in UTC and durations are milliseconds.
+const (
+	ColumnString  = "string"
+	ColumnInteger = "integer"
+	ColumnNumber  = "number"
+	ColumnTime    = "time"
+	ColumnBoolean = "boolean"
+)
+
+type TableColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// TableColumns defines the columns of each table. Scripts depend on them, so
+// columns may be added at the end but never renamed, retyped or removed.
+var TableColumns = map[string][]TableColumn{
+	TableProtocols: {
+		{"path", ColumnString}, {"protocol", ColumnString}, {"depth", ColumnInteger},
+		{"packets", ColumnInteger}, {"bytes", ColumnInteger}, {"percent", ColumnNumber},
+	},
+	TableConversations: {
+		{"type", ColumnString}, {"address_a", ColumnString}, {"address_b", ColumnString},
+		{"mac_a", ColumnString}, {"mac_b", ColumnString}, {"ip_a", ColumnString}, {"ip_b", ColumnString},
+		{"port_a", ColumnInteger}, {"port_b", ColumnInteger}, {"protocol", ColumnString},
+		{"packets", ColumnInteger}, {"bytes", ColumnInteger},
+		{"packets_a_to_b", ColumnInteger}, {"bytes_a_to_b", ColumnInteger},
+		{"packets_b_to_a", ColumnInteger}, {"bytes_b_to_a", ColumnInteger},
+		{"first_seen", ColumnTime}, {"last_seen", ColumnTime}, {"duration_ms", ColumnNumber},
+		{"state", ColumnString}, {"tls_sni", ColumnString},
+	},
+	TableEndpoints: {
+		{"type", ColumnString}, {"address", ColumnString}, {"mac", ColumnString}, {"name", ColumnString},
+		{"packets_sent", ColumnInteger}, {"bytes_sent", ColumnInteger},
+		{"packets_received", ColumnInteger}, {"bytes_received", ColumnInteger},
+		{"first_seen", ColumnTime}, {"last_seen", ColumnTime},
+		{"protocols", ColumnString}, {"listening_ports", ColumnString},
+		{"ttl", ColumnInteger}, {"syn_window", ColumnInteger},
+	},
+	TableDNS: {
+		{"id", ColumnInteger}, {"client_ip", ColumnString}, {"client_port", ColumnInteger},
+		{"resolver_ip", ColumnString}, {"resolver_port", ColumnInteger}, {"transport", ColumnString},
+		{"name", ColumnString}, {"type", ColumnString},
+		{"query_packet", ColumnInteger}, {"query_time", ColumnTime},
+		{"response_packet", ColumnInteger}, {"response_time", ColumnTime}, {"latency_ms", ColumnNumber},
+		{"response_code", ColumnString}, {"answers", ColumnString}, {"retransmissions", ColumnInteger},
+	},
+	TableHTTP: {
+		{"stream", ColumnInteger}, {"client_ip", ColumnString}, {"server_ip", ColumnString}, {"server_port", ColumnInteger},
+		{"method", ColumnString}, {"host", ColumnString}, {"uri", ColumnString}, {"user_agent", ColumnString},
+		{"status", ColumnInteger}, {"content_type", ColumnString},
+		{"request_size", ColumnInteger}, {"response_size", ColumnInteger}, {"decoded_size", ColumnInteger},
+		{"request_time", ColumnTime}, {"response_time", ColumnTime}, {"latency_ms", ColumnNumber},
+		{"request_packet", ColumnInteger}, {"response_packet", ColumnInteger},
+	},
+	TableTLS: {
+		{"stream", ColumnInteger}, {"client_ip", ColumnString}, {"client_port", ColumnInteger},
+		{"server_ip", ColumnString}, {"server_port", ColumnInteger}, {"sni", ColumnString},
+		{"version", ColumnString}, {"cipher_suite", ColumnString}, {"alpn", ColumnString},
+		{"ja3", ColumnString}, {"ja3s", ColumnString}, {"ja4", ColumnString}, {"decrypted", ColumnBoolean},
+	},
+	TableNodes: {
+		{"ip", ColumnString}, {"type", ColumnString}, {"hostname", ColumnString},
+		{"ports", ColumnString}, {"services", ColumnString},
+	},
+	TableConnections: {
+		{"source", ColumnString}, {"destination", ColumnString}, {"protocol", ColumnString},
+		{"packets", ColumnInteger}, {"last_seen", ColumnTime},
+	},
+	TableFindings: {
+		{"severity", ColumnString}, {"group", ColumnString}, {"protocol", ColumnString},
+		{"summary", ColumnString}, {"detail", ColumnString}, {"packet", ColumnInteger}, {"time", ColumnTime},
+	},
+	TableGeoIP: {
+		{"ip", ColumnString}, {"hostname", ColumnString}, {"city", ColumnString}, {"region", ColumnString},
+		{"country", ColumnString}, {"loc", ColumnString}, {"org", ColumnString},
+	},
+}
+
+// Table is one complete analysis result, with a value per column in each
+// row. Values are strings, ints, float64s, bools or time.Times.
+type Table struct {
+	Name    string
+	Columns []TableColumn
+	Rows    [][]interface{}
+}
+
+// NewTable starts an empty table with the columns defined for its name
+func NewTable(name string) *Table {
+	return &Table{Name: name, Columns: TableColumns[name]}
+}
+
+// Add appends a row. Unsigned integers are stored as ints.
+func (t *Table) Add(values ...interface{}) {
+	for i, value := range values {
+		switch v := value.(type) {
+		case uint8:
+			values[i] = int(v)
+		case uint16:
+			values[i] = int(v)
+		case uint32:
+			values[i] = int(v)
+		}
+	}
+	t.Rows = append(t.Rows, values)
+}
+
+// Table builds one of the tables from the analyzer producing it, empty when
+// that analyzer is not enabled. The GeoIP table needs lookups the session
+// cannot make, so callers build it themselves.
+func (s *Session) Table(name string) (*Table, error) {
+	plugin, owned := tableOwner(name)
+	if !owned {
+		return s.builtinTable(name)
+	}
+	if analyzer := s.Analyzer(plugin.Name); analyzer != nil {
+		return analyzer.Table(name)
+	}
+	return NewTable(name), nil
+}
+
+// builtinTable builds a table of the built-in analyzers
+func (s *Session) builtinTable(name string) (*Table, error) {
+	t := NewTable(name)
+	switch name {
+	case TableProtocols:
+		var walk func(node *ProtocolNode, path string, depth int)
+		walk = func(node *ProtocolNode, path string, depth int) {
+			t.Add(path, node.Name, depth, node.Packets, node.Bytes, node.Percent)
+			for _, child := range node.Children {
+				walk(child, path+"/"+child.Name, depth+1)
+			}
+		}
+		root := s.Protocols().Tree()
+		walk(root, root.Name, 0)
+
+	case TableConversations:
+		for _, kind := range ConversationTypes {
+			conversations, _ := s.Conversations().List(kind, "a", false, 0, 0)
+			for _, conv := range conversations {
+				sni := ""
+				if conv.TLS != nil {
+					sni = conv.TLS.SNI
+				}
+				t.Add(conv.Type, conv.AddressA(), conv.AddressB(), conv.SourceMAC, conv.DestMAC, conv.SourceIP, conv.DestIP,
+					conv.SourcePort, conv.DestPort, conv.Protocol, conv.PacketCount, conv.TotalBytes,
+					conv.PacketsAB, conv.BytesAB, conv.PacketsBA, conv.BytesBA,
+					conv.FirstSeen, conv.LastSeen, milliseconds(conv.Duration()), conv.State, sni)
+			}
+		}
+
+	case TableEndpoints:
+		for _, kind := range EndpointTypes {
+			endpoints, _ := s.Endpoints().List(kind, "address", false, 0, 0)
+			for _, ep := range endpoints {
+				var ports []string
+				for _, port := range ep.PortList() {
+					ports = append(ports, strconv.Itoa(int(port)))
+				}
+				t.Add(ep.Type, ep.Address, ep.MAC, ep.Name, ep.PacketsSent, ep.BytesSent, ep.PacketsReceived, ep.BytesReceived,
+					ep.FirstSeen, ep.LastSeen, strings.Join(ep.ProtocolList(), ";"), strings.Join(ports, ";"), ep.TTL, ep.SYNWindow)
+			}
+		}
+
+	case TableDNS:
+		for _, tx := range s.DNS().GetTransactions() {
+			var answers []string
+			for _, answer := range tx.Answers {
+				answers = append(answers, answer.Type+" "+answer.Data)
+			}
+			t.Add(tx.ID, tx.ClientIP, tx.ClientPort, tx.ResolverIP, tx.ResolverPort, tx.Transport, tx.Name, tx.Type,
+				tx.QueryPacket, tx.QueryTime, tx.ResponsePacket, tx.ResponseTime, milliseconds(tx.Latency),
+				tx.ResponseCode, strings.Join(answers, ";"), tx.Retransmissions)
+		}
+
+	case TableHTTP:
+		for _, tx := range s.HTTP().GetTransactions() {
+			t.Add(tx.StreamIndex, tx.ClientIP, tx.ServerIP, tx.ServerPort, tx.Method, tx.Host, tx.URI, tx.UserAgent,
+				tx.Status, tx.ContentType, tx.RequestSize, tx.ResponseSize, tx.DecodedSize,
+				tx.RequestTime, tx.ResponseTime, milliseconds(tx.Latency), tx.RequestPacket, tx.ResponsePacket)
+		}
+
+	case TableTLS:
+		for _, hs := range s.TLS().GetSessions() {
+			t.Add(hs.StreamIndex, hs.ClientIP, hs.ClientPort, hs.ServerIP, hs.ServerPort, hs.SNI,
+				TLSVersionName(hs.NegotiatedVersion), CipherSuiteName(hs.CipherSuite), hs.NegotiatedALPN,
+				hs.JA3Hash, hs.JA3SHash, hs.JA4, hs.Decrypted)
+		}
+
+	case TableNodes:
+		nodes := s.NetworkMap().GetActiveNodes()
+		sort.Slice(nodes, func(i, j int) bool { return compareIPs(nodes[i].IP, nodes[j].IP) < 0 })
+		for _, node := range nodes {
+			var ports, services []string
+			for _, port := range sortedPorts(node.Ports) {
+				ports = append(ports, strconv.Itoa(int(port)))
+			}
+			for service := range node.Services {
+				services = append(services, service)
+			}
+			sort.Strings(services)
+			t.Add(node.IP, node.Type, node.Hostname, strings.Join(ports, ";"), strings.Join(services, ";"))
+		}
+
+	case TableConnections:
+		connections := s.NetworkMap().GetActiveConnections()
+		sort.Slice(connections, func(i, j int) bool {
+			a, b := connections[i], connections[j]
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return a.Source+a.Destination+a.Protocol < b.Source+b.Destination+b.Protocol
+		})
+		for _, conn := range connections {
+			t.Add(conn.Source, conn.Destination, conn.Protocol, conn.Count, time.Unix(conn.LastSeen, 0))
+		}
+
+	case TableFindings:
+		for _, item := range s.Expert().Findings() {
+			t.Add(item.Severity, item.Group, item.Protocol, item.Summary, item.Detail, item.Packet, item.Time)
+		}
+
+	case TableGeoIP:
+		return nil, fmt.Errorf("the %s table needs geolocation lookups", name)
+
+	default:
+		return nil, fmt.Errorf("unknown table %q", name)
+	}
+	return t, nil
+}
+
+func sortedPorts(set map[uint16]bool) []uint16 {
+	ports := make([]uint16, 0, len(set))
+	for port := range set {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+	return ports
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Filter keeps the rows whose value in a column, formatted as in CSV,
+// equals value
+func (t *Table) Filter(column, value string) error {
+	index := -1
+	for i, c := range t.Columns {
+		if c.Name == column {
+			index = i
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("the %s table has no column %q", t.Name, column)
+	}
+
+	rows := t.Rows[:0]
+	for _, row := range t.Rows {
+		if csvValue(row[index]) == value {
+			rows = append(rows, row)
+		}
+	}
+	t.Rows = rows
+	return nil
+}
+
+// Page keeps at most limit rows starting at offset and returns the number
+// of rows there were. A limit of zero keeps every row from offset on.
+func (t *Table) Page(offset, limit int) int {
+	total := len(t.Rows)
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	t.Rows = t.Rows[offset:end]
+	return total
+}
+
+// Text formats one value as in CSV
+func (t *Table) Text(row, column int) string {
+	return csvValue(t.Rows[row][column])
+}
+
+// Write writes every row of the table as CSV with a header line, as a JSON
+// array of objects, as one JSON object per line, or as aligned text columns
+// for terminals. Objects keep the column order and zero times are empty in
+// CSV and text and null in JSON. Text that a spreadsheet would take for a
+// formula gets a leading ' in CSV.
+func (t *Table) Write(format string, w io.Writer) error {
+	switch format {
+	case TableText:
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for i, column := range t.Columns {
+			if i > 0 {
+				io.WriteString(writer, "\t")
+			}
+			io.WriteString(writer, strings.ToUpper(column.Name))
+		}
+		io.WriteString(writer, "\n")
+		for _, row := range t.Rows {
+			for i, value := range row {
+				if i > 0 {
+					io.WriteString(writer, "\t")
+				}
+				// Tabs and newlines would break the alignment
+				io.WriteString(writer, strings.Join(strings.Fields(csvValue(value)), " "))
+			}
+			io.WriteString(writer, "\n")
+		}
+		return writer.Flush()
+
+	case TableCSV:
+		writer := csv.NewWriter(w)
+		header := make([]string, len(t.Columns))
+		for i, column := range t.Columns {
+			header[i] = column.Name
+		}
+		writer.Write(header)
+		record := make([]string, len(t.Columns))
+		for _, row := range t.Rows {
+			for i, value := range row {
+				record[i] = csvValue(value)
+				if text, ok := value.(string); ok {
+					record[i] = csvCell(text)
+				}
+			}
+			writer.Write(record)
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case TableJSON, TableNDJSON:
+		if format == TableJSON {
+			if _, err := io.WriteString(w, "["); err != nil {
+				return err
+			}
+		}
+		for n, row := range t.Rows {
+			var b strings.Builder
+			if format == TableJSON {
+				if n > 0 {
+					b.WriteString(",")
+				}
+				b.WriteString("\n")
+			}
+			b.WriteString("{")
+			for i, value := range row {
+				if i > 0 {
+					b.WriteString(",")
+				}
+				name, _ := json.Marshal(t.Columns[i].Name)
+				b.Write(name)
+				b.WriteString(":")
+				data, err := json.Marshal(jsonValue(value))
+				if err != nil {
+					return err
+				}
+				b.Write(data)
+			}
+			b.WriteString("}")
+			if format == TableNDJSON {
+				b.WriteString("\n")
+			}
+			if _, err := io.WriteString(w, b.String()); err != nil {
+				return err
+			}
+		}
+		if format == TableJSON {
+			_, err := io.WriteString(w, "\n]\n")
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown table format %q", format)
+}
+
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// csvCell keeps spreadsheets from running text taken from the capture, such
+// as a DNS name or URI starting with "=", as a formula
+func csvCell(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+func jsonValue(value interface{}) interface{} {
+	if v, ok := value.(time.Time); ok {
+		if v.IsZero() {
+			return nil
+		}
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+	return value
+}
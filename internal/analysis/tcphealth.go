@@ -0,0 +1,517 @@
+package analysis
+
+import (
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/models"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TCP analysis events, named after the tcp.analysis flags in Wireshark
+const (
+	TCPRetransmission     = "Retransmission"
+	TCPFastRetransmission = "Fast Retransmission"
+	TCPOutOfOrder         = "Out-Of-Order"
+	TCPLostSegment        = "Previous Segment Not Captured"
+	TCPDuplicateACK       = "Duplicate ACK"
+	TCPZeroWindow         = "Zero Window"
+	TCPWindowFull         = "Window Full"
+	TCPReset              = "Reset"
+)
+
+var TCPEventKinds = []string{
+	TCPRetransmission, TCPFastRetransmission, TCPOutOfOrder, TCPLostSegment,
+	TCPDuplicateACK, TCPZeroWindow, TCPWindowFull, TCPReset,
+}
+
+const (
+	// Segments arriving this soon after the sequence advanced are taken as
+	// reordered rather than retransmitted, unless the handshake RTT is known
+	defaultOutOfOrderThreshold = 3 * time.Millisecond
+	// Unacknowledged segments kept per direction for RTT estimates
+	maxUnackedSegments = 256
+)
+
+// TCPEvent is a packet flagged by the TCP analysis.
+type TCPEvent struct {
+	Kind       string
+	Packet     int
+	Time       time.Time
+	SourceIP   string
+	SourcePort uint16
+	DestIP     string
+	DestPort   uint16
+	Detail     string
+}
+
+// TCPTiming summarises a series of durations.
+type TCPTiming struct {
+	Samples int
+	Min     time.Duration
+	Max     time.Duration
+	Total   time.Duration
+}
+
+func (t *TCPTiming) add(d time.Duration) {
+	if t.Samples == 0 || d < t.Min {
+		t.Min = d
+	}
+	if d > t.Max {
+		t.Max = d
+	}
+	t.Samples++
+	t.Total += d
+}
+
+func (t *TCPTiming) merge(other TCPTiming) {
+	if other.Samples == 0 {
+		return
+	}
+	if t.Samples == 0 || other.Min < t.Min {
+		t.Min = other.Min
+	}
+	if other.Max > t.Max {
+		t.Max = other.Max
+	}
+	t.Samples += other.Samples
+	t.Total += other.Total
+}
+
+// Avg returns the mean duration, or zero without samples
+func (t TCPTiming) Avg() time.Duration {
+	if t.Samples == 0 {
+		return 0
+	}
+	return t.Total / time.Duration(t.Samples)
+}
+
+// TCPFlowHealth is the TCP analysis of one connection. The client is the
+// side that sent the SYN, or the first packet when the handshake was not
+// captured.
+type TCPFlowHealth struct {
+	ClientIP     string
+	ClientPort   uint16
+	ServerIP     string
+	ServerPort   uint16
+	Packets      int
+	FirstSeen    time.Time
+	LastSeen     time.Time
+	Events       map[string]int // Kind -> packets flagged
+	HandshakeRTT time.Duration  // SYN to the ACK completing the handshake, zero if not captured
+	RTT          TCPTiming      // Data segment to the ACK covering it
+	ResponseTime TCPTiming      // Last client data before a response to the server's first data
+
+	dir         [2]tcpDirection // Indexed by StreamDirection
+	synTime     time.Time
+	synAckSeen  bool
+	awaiting    bool // Client data not yet answered by the server
+	requestTime time.Time
+}
+
+// tcpDirection is the sequence state of the segments one side sends, and
+// the acknowledgements it sends for the other side.
+type tcpDirection struct {
+	started    bool
+	nextSeq    uint32 // Sequence number after the highest byte sent
+	advanced   time.Time
+	synSeen    bool
+	scale      int // Window scale shift from the SYN, -1 without one
+	ackSeen    bool
+	lastAck    uint32
+	lastWindow uint16
+	window     int // Last advertised window, scaled
+	dupAcks    int
+	unacked    []tcpSegment
+}
+
+type tcpSegment struct {
+	end           uint32
+	sent          time.Time
+	retransmitted bool
+}
+
+// Issues is the number of packets flagged in the connection
+func (f *TCPFlowHealth) Issues() int {
+	total := 0
+	for _, count := range f.Events {
+		total += count
+	}
+	return total
+}
+
+// windowShift is the scale applied to the windows one side advertises
+// outside the handshake, and whether it is known. Scaling is only in effect
+// when both SYNs carried the option.
+func (f *TCPFlowHealth) windowShift(d StreamDirection) (int, bool) {
+	client, server := f.dir[ClientToServer], f.dir[ServerToClient]
+	if !client.synSeen || !server.synSeen {
+		return 0, false
+	}
+	if client.scale < 0 || server.scale < 0 {
+		return 0, true
+	}
+	return f.dir[d].scale, true
+}
+
+func (f *TCPFlowHealth) outOfOrderThreshold() time.Duration {
+	if f.HandshakeRTT > 0 {
+		return f.HandshakeRTT
+	}
+	return defaultOutOfOrderThreshold
+}
+
+// TCPServerHealth sums the TCP analysis of every connection to one service.
+type TCPServerHealth struct {
+	ServerIP     string
+	ServerPort   uint16
+	Flows        int
+	Packets      int
+	Events       map[string]int
+	HandshakeRTT TCPTiming
+	RTT          TCPTiming
+	ResponseTime TCPTiming
+}
+
+func (s *TCPServerHealth) Issues() int {
+	total := 0
+	for _, count := range s.Events {
+		total += count
+	}
+	return total
+}
+
+// TCPHealthAnalyzer follows the sequence numbers, acknowledgements and
+// windows of every TCP connection to flag the packets Wireshark's expert
+// analysis would, and estimates round-trip and server response times.
+type TCPHealthAnalyzer struct {
+	mu     sync.Mutex
+	flows  map[string]*TCPFlowHealth
+	order  []*TCPFlowHealth
+	events []TCPEvent
+}
+
+func NewTCPHealthAnalyzer() *TCPHealthAnalyzer {
+	return &TCPHealthAnalyzer{
+		flows: make(map[string]*TCPFlowHealth),
+	}
+}
+
+func (t *TCPHealthAnalyzer) Process(packet models.Packet) {
+	tcp := packet.TCP
+	if tcp == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := streamKey(packet)
+	flow, exists := t.flows[key]
+	if !exists {
+		flow = &TCPFlowHealth{
+			ClientIP:   packet.SourceIP,
+			ClientPort: packet.SourcePort,
+			ServerIP:   packet.DestIP,
+			ServerPort: packet.DestPort,
+			FirstSeen:  packet.Timestamp,
+			Events:     make(map[string]int),
+		}
+		// A SYN/ACK seen before the SYN means the sender is the server
+		if tcp.SYN && tcp.ACK {
+			flow.ClientIP, flow.ServerIP = flow.ServerIP, flow.ClientIP
+			flow.ClientPort, flow.ServerPort = flow.ServerPort, flow.ClientPort
+		}
+		flow.dir[ClientToServer].scale = -1
+		flow.dir[ServerToClient].scale = -1
+		t.flows[key] = flow
+		t.order = append(t.order, flow)
+	}
+	flow.Packets++
+	flow.LastSeen = packet.Timestamp
+
+	d := ClientToServer
+	if packet.SourceIP == flow.ServerIP && packet.SourcePort == flow.ServerPort {
+		d = ServerToClient
+	}
+	sender, receiver := &flow.dir[d], &flow.dir[1-d]
+	ts := packet.Timestamp
+	payload := uint32(len(packet.Payload))
+
+	flag := func(kind, detail string) {
+		flow.Events[kind]++
+		t.events = append(t.events, TCPEvent{
+			Kind:       kind,
+			Packet:     packet.Number,
+			Time:       ts,
+			SourceIP:   packet.SourceIP,
+			SourcePort: packet.SourcePort,
+			DestIP:     packet.DestIP,
+			DestPort:   packet.DestPort,
+			Detail:     detail,
+		})
+	}
+
+	// Handshake
+	if tcp.SYN {
+		sender.synSeen = true
+		sender.scale = tcp.WindowScale
+		if !tcp.ACK && flow.synTime.IsZero() {
+			flow.synTime = ts
+		}
+		if tcp.ACK {
+			flow.synAckSeen = true
+		}
+	} else if tcp.ACK && d == ClientToServer && flow.synAckSeen && flow.HandshakeRTT == 0 && !flow.synTime.IsZero() {
+		flow.HandshakeRTT = ts.Sub(flow.synTime)
+	}
+
+	if tcp.RST {
+		flag(TCPReset, "")
+	}
+	if tcp.Window == 0 && !tcp.SYN && !tcp.FIN && !tcp.RST {
+		flag(TCPZeroWindow, "")
+	}
+
+	// Sequence analysis. SYN and FIN each take up one sequence number.
+	segLen := payload
+	if tcp.SYN || tcp.FIN {
+		segLen++
+	}
+	retransmitted := false
+	if segLen > 0 {
+		seq, end := tcp.Seq, tcp.Seq+segLen
+		keepAlive := payload == 1 && !tcp.SYN && !tcp.FIN && sender.started && seq == sender.nextSeq-1
+		switch {
+		case !sender.started || keepAlive:
+			if !sender.started {
+				sender.started = true
+				sender.nextSeq = end
+				sender.advanced = ts
+			}
+		case seqBefore(seq, sender.nextSeq):
+			retransmitted = true
+			switch {
+			case receiver.dupAcks >= 2 && seq == receiver.lastAck:
+				flag(TCPFastRetransmission, fmt.Sprintf("after %d duplicate ACKs", receiver.dupAcks))
+			case ts.Sub(sender.advanced) < flow.outOfOrderThreshold():
+				flag(TCPOutOfOrder, "")
+			default:
+				flag(TCPRetransmission, "")
+			}
+			// Karn's algorithm: ACKs of retransmitted data give no RTT
+			for i := range sender.unacked {
+				if seqBefore(seq, sender.unacked[i].end) {
+					sender.unacked[i].retransmitted = true
+				}
+			}
+			if seqBefore(sender.nextSeq, end) {
+				sender.nextSeq = end
+				sender.advanced = ts
+			}
+		case seqBefore(sender.nextSeq, seq):
+			flag(TCPLostSegment, fmt.Sprintf("%d bytes missing", seq-sender.nextSeq))
+			sender.nextSeq = end
+			sender.advanced = ts
+		default:
+			sender.nextSeq = end
+			sender.advanced = ts
+		}
+		if !retransmitted && !keepAlive {
+			sender.unacked = append(sender.unacked, tcpSegment{end: end, sent: ts})
+			if len(sender.unacked) > maxUnackedSegments {
+				sender.unacked = sender.unacked[1:]
+			}
+		}
+
+		// Window full: the segment fills the window the receiver last
+		// advertised
+		if _, known := flow.windowShift(1 - d); known && payload > 0 && receiver.ackSeen && receiver.window > 0 && !tcp.SYN {
+			if inFlight := int32(end - receiver.lastAck); inFlight > 0 && int(inFlight) >= receiver.window {
+				flag(TCPWindowFull, fmt.Sprintf("%d bytes in flight, window %d", inFlight, receiver.window))
+			}
+		}
+	}
+
+	// Server response time, from the client's last data segment to the
+	// server's first one
+	if payload > 0 && !retransmitted {
+		if d == ClientToServer {
+			flow.awaiting = true
+			flow.requestTime = ts
+		} else if flow.awaiting {
+			flow.awaiting = false
+			flow.ResponseTime.add(ts.Sub(flow.requestTime))
+		}
+	}
+
+	// Acknowledgement analysis
+	if !tcp.ACK {
+		return
+	}
+	window := int(tcp.Window)
+	if shift, _ := flow.windowShift(d); !tcp.SYN {
+		window <<= shift
+	}
+	switch {
+	case !sender.ackSeen || seqBefore(sender.lastAck, tcp.Ack):
+		// New data acknowledged; the segment it completes gives an RTT
+		for len(receiver.unacked) > 0 && !seqBefore(tcp.Ack, receiver.unacked[0].end) {
+			segment := receiver.unacked[0]
+			receiver.unacked = receiver.unacked[1:]
+			if segment.end == tcp.Ack && !segment.retransmitted {
+				flow.RTT.add(ts.Sub(segment.sent))
+			}
+		}
+		sender.dupAcks = 0
+	case tcp.Ack == sender.lastAck && payload == 0 && !tcp.SYN && !tcp.FIN && !tcp.RST &&
+		tcp.Window == sender.lastWindow && receiver.started && seqBefore(tcp.Ack, receiver.nextSeq):
+		sender.dupAcks++
+		flag(TCPDuplicateACK, fmt.Sprintf("#%d", sender.dupAcks))
+	}
+	sender.ackSeen = true
+	sender.lastAck = tcp.Ack
+	sender.lastWindow = tcp.Window
+	sender.window = window
+}
+
+// seqBefore compares sequence numbers allowing for wrap-around
+func seqBefore(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// Flows returns every TCP connection, those with the most flagged packets
+// first
+func (t *TCPHealthAnalyzer) Flows() []*TCPFlowHealth {
+	t.mu.Lock()
+	flows := make([]*TCPFlowHealth, len(t.order))
+	copy(flows, t.order)
+	t.mu.Unlock()
+
+	sort.SliceStable(flows, func(i, j int) bool {
+		return flows[i].Issues() > flows[j].Issues()
+	})
+	return flows
+}
+
+// Servers sums the connections per server address and port, those with the
+// most flagged packets first
+func (t *TCPHealthAnalyzer) Servers() []*TCPServerHealth {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	servers := make(map[string]*TCPServerHealth)
+	for _, flow := range t.order {
+		key := fmt.Sprintf("%s|%d", flow.ServerIP, flow.ServerPort)
+		server, exists := servers[key]
+		if !exists {
+			server = &TCPServerHealth{
+				ServerIP:   flow.ServerIP,
+				ServerPort: flow.ServerPort,
+				Events:     make(map[string]int),
+			}
+			servers[key] = server
+		}
+		server.Flows++
+		server.Packets += flow.Packets
+		for kind, count := range flow.Events {
+			server.Events[kind] += count
+		}
+		if flow.HandshakeRTT > 0 {
+			server.HandshakeRTT.add(flow.HandshakeRTT)
+		}
+		server.RTT.merge(flow.RTT)
+		server.ResponseTime.merge(flow.ResponseTime)
+	}
+
+	result := make([]*TCPServerHealth, 0, len(servers))
+	for _, server := range servers {
+		result = append(result, server)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Issues() != result[j].Issues() {
+			return result[i].Issues() > result[j].Issues()
+		}
+		if result[i].ServerIP != result[j].ServerIP {
+			return compareIPs(result[i].ServerIP, result[j].ServerIP) < 0
+		}
+		return result[i].ServerPort < result[j].ServerPort
+	})
+	return result
+}
+
+// Events returns one page of the flagged packets of a kind, or of every
+// kind when kind is empty, in capture order, along with the number of
+// matching events.
+func (t *TCPHealthAnalyzer) Events(kind string, offset, limit int) ([]TCPEvent, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var events []TCPEvent
+	for _, event := range t.events {
+		if kind == "" || event.Kind == kind {
+			events = append(events, event)
+		}
+	}
+
+	total := len(events)
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	return events[offset:end], total
+}
+
+// Counts returns the number of flagged packets of each kind
+func (t *TCPHealthAnalyzer) Counts() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, event := range t.events {
+		counts[event.Kind]++
+	}
+	return counts
+}
+
+// Expert info severity of each TCP event, following Wireshark
+var tcpEventSeverity = map[string]string{
+	TCPRetransmission:     ExpertNote,
+	TCPFastRetransmission: ExpertNote,
+	TCPOutOfOrder:         ExpertWarn,
+	TCPLostSegment:        ExpertWarn,
+	TCPDuplicateACK:       ExpertNote,
+	TCPZeroWindow:         ExpertWarn,
+	TCPWindowFull:         ExpertWarn,
+	TCPReset:              ExpertWarn,
+}
+
+// ExpertItems reports every flagged packet in the sequence group
+func (t *TCPHealthAnalyzer) ExpertItems() []ExpertItem {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	items := make([]ExpertItem, 0, len(t.events))
+	for _, event := range t.events {
+		detail := net.JoinHostPort(event.SourceIP, strconv.Itoa(int(event.SourcePort))) + " → " +
+			net.JoinHostPort(event.DestIP, strconv.Itoa(int(event.DestPort)))
+		if event.Detail != "" {
+			detail += ", " + event.Detail
+		}
+		items = append(items, ExpertItem{
+			Severity: tcpEventSeverity[event.Kind],
+			Group:    ExpertSequence,
+			Protocol: "TCP",
+			Summary:  event.Kind,
+			Detail:   detail,
+			Packet:   event.Packet,
+			Time:     event.Time,
+		})
+	}
+	return items
+}
@@ -0,0 +1,279 @@
+// Command sanitizecheck writes a capture of packets that carry addresses in
+// their payloads, sanitizes it with every payload action and fails if any
+// original address, MAC address or host name is left in the output.
+//
+//	go run ./internal/analysis/testdata/sanitizecheck
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/analysis"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+var (
+	clientMAC = net.HardwareAddr{0x00, 0x1b, 0x21, 0x3a, 0x4b, 0x5c}
+	serverMAC = net.HardwareAddr{0x00, 0x25, 0x90, 0x6d, 0x7e, 0x8f}
+
+	client   = net.IP{10, 1, 2, 3}
+	server   = net.IP{198, 51, 100, 9}
+	resolver = net.IP{203, 0, 113, 53}
+	router   = net.IP{10, 1, 2, 1}
+	gateway  = net.IP{10, 1, 2, 254}
+	leased   = net.IP{10, 1, 2, 50}
+	hint     = net.IP{192, 0, 2, 77}
+	netbios  = net.IP{10, 1, 2, 60}
+	mdns     = net.IP{10, 1, 2, 70}
+	client6  = net.ParseIP("2001:db8:1::3")
+	server6  = net.ParseIP("2001:db8:2::9")
+
+	hostName = "secret-laptop"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "sanitizecheck:", err)
+		os.Exit(1)
+	}
+	fmt.Println("sanitizecheck: no original addresses left")
+}
+
+func run() error {
+	dir, err := os.MkdirTemp("", "sanitizecheck")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "fixture.pcap")
+	if err := writeFixture(path); err != nil {
+		return err
+	}
+	index, err := analysis.LoadPacketIndex(path, "")
+	if err != nil {
+		return err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	leaks := 0
+	for _, action := range []string{analysis.PayloadKeep, analysis.PayloadZero, analysis.PayloadTruncate} {
+		sanitizer, err := analysis.NewSanitizer(analysis.SanitizeOptions{Key: key, HashNames: true, Payload: action, Truncate: 64})
+		if err != nil {
+			return err
+		}
+		var out bytes.Buffer
+		if _, err := analysis.SanitizePackets(index, analysis.PacketSelection{}, sanitizer, analysis.FormatPcap, &out); err != nil {
+			return err
+		}
+		for name, original := range originals() {
+			if bytes.Contains(out.Bytes(), original) {
+				fmt.Fprintf(os.Stderr, "payload %s: %s left in the output\n", action, name)
+				leaks++
+			}
+		}
+	}
+	if leaks > 0 {
+		return fmt.Errorf("%d leaks", leaks)
+	}
+	return nil
+}
+
+// originals are the byte patterns that must not survive sanitizing
+func originals() map[string][]byte {
+	return map[string][]byte{
+		"client MAC":        clientMAC,
+		"server MAC":        serverMAC,
+		"client address":    client,
+		"server address":    server,
+		"resolver address":  resolver,
+		"router address":    router,
+		"redirect gateway":  gateway,
+		"leased address":    leased,
+		"HTTPS record hint": hint,
+		"NetBIOS address":   netbios,
+		"mDNS address":      mdns,
+		"client IPv6":       client6,
+		"server IPv6":       server6,
+		"host name":         []byte(hostName),
+	}
+}
+
+func writeFixture(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := pcapgo.NewWriter(file)
+	if err := writer.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+		return err
+	}
+
+	packets := [][]gopacket.SerializableLayer{
+		udp(client, resolver, 40000, 53, gopacket.Payload(httpsResponse())),
+		tcp(client, resolver, 40001, 53, gopacket.Payload(append([]byte{0, byte(len(httpsResponse()))}, httpsResponse()...))),
+		icmpError(server, client, quotedUDP(client, server)),
+		icmpRedirect(router, client, quotedUDP(client, server)),
+		icmpv6Error(server6, client6),
+		udp(router, leased, 67, 68, dhcpAck()),
+		udp(netbios, client, 137, 137, gopacket.Payload(nbnsResponse())),
+		udp(mdns, net.IP{224, 0, 0, 251}, 5353, 5353, gopacket.Payload(mdnsResponse())),
+	}
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, packet := range packets {
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+		if err := gopacket.SerializeLayers(buf, opts, packet...); err != nil {
+			return fmt.Errorf("packet %d: %v", i+1, err)
+		}
+		ci := gopacket.CaptureInfo{Timestamp: start.Add(time.Duration(i) * time.Second), CaptureLength: len(buf.Bytes()), Length: len(buf.Bytes())}
+		if err := writer.WritePacket(ci, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ethernet(etherType layers.EthernetType) *layers.Ethernet {
+	return &layers.Ethernet{SrcMAC: clientMAC, DstMAC: serverMAC, EthernetType: etherType}
+}
+
+func ipv4(src, dst net.IP, protocol layers.IPProtocol) *layers.IPv4 {
+	return &layers.IPv4{Version: 4, TTL: 64, Protocol: protocol, SrcIP: src, DstIP: dst}
+}
+
+func udp(src, dst net.IP, srcPort, dstPort int, payload gopacket.SerializableLayer) []gopacket.SerializableLayer {
+	ip := ipv4(src, dst, layers.IPProtocolUDP)
+	u := &layers.UDP{SrcPort: layers.UDPPort(srcPort), DstPort: layers.UDPPort(dstPort)}
+	u.SetNetworkLayerForChecksum(ip)
+	return []gopacket.SerializableLayer{ethernet(layers.EthernetTypeIPv4), ip, u, payload}
+}
+
+func tcp(src, dst net.IP, srcPort, dstPort int, payload gopacket.SerializableLayer) []gopacket.SerializableLayer {
+	ip := ipv4(src, dst, layers.IPProtocolTCP)
+	t := &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: layers.TCPPort(dstPort), PSH: true, ACK: true, Window: 1024}
+	t.SetNetworkLayerForChecksum(ip)
+	return []gopacket.SerializableLayer{ethernet(layers.EthernetTypeIPv4), ip, t, payload}
+}
+
+// quotedUDP is the start of a UDP datagram as an ICMP error quotes it
+func quotedUDP(src, dst net.IP) []byte {
+	layersOf := udp(src, dst, 40000, 33434, gopacket.Payload([]byte("probe")))
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, layersOf[1:]...); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func icmpError(src, dst net.IP, quote []byte) []gopacket.SerializableLayer {
+	icmp := &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodePort)}
+	return []gopacket.SerializableLayer{ethernet(layers.EthernetTypeIPv4), ipv4(src, dst, layers.IPProtocolICMPv4), icmp, gopacket.Payload(quote)}
+}
+
+func icmpRedirect(src, dst net.IP, quote []byte) []gopacket.SerializableLayer {
+	icmp := &layers.ICMPv4{
+		TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeRedirect, layers.ICMPv4CodeHost),
+		Id:       binary.BigEndian.Uint16(gateway[:2]),
+		Seq:      binary.BigEndian.Uint16(gateway[2:]),
+	}
+	return []gopacket.SerializableLayer{ethernet(layers.EthernetTypeIPv4), ipv4(src, dst, layers.IPProtocolICMPv4), icmp, gopacket.Payload(quote)}
+}
+
+func icmpv6Error(src, dst net.IP) []gopacket.SerializableLayer {
+	quoted := &layers.IPv6{Version: 6, HopLimit: 1, NextHeader: layers.IPProtocolUDP, SrcIP: dst, DstIP: src}
+	u := &layers.UDP{SrcPort: 40000, DstPort: 33434}
+	u.SetNetworkLayerForChecksum(quoted)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, quoted, u, gopacket.Payload([]byte("probe"))); err != nil {
+		panic(err)
+	}
+
+	ip := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolICMPv6, SrcIP: src, DstIP: dst}
+	icmp := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeTimeExceeded, 0)}
+	icmp.SetNetworkLayerForChecksum(ip)
+	payload := append(make([]byte, 4), buf.Bytes()...)
+	return []gopacket.SerializableLayer{ethernet(layers.EthernetTypeIPv6), ip, icmp, gopacket.Payload(payload)}
+}
+
+// httpsResponse is a DNS response with an HTTPS record, which gopacket
+// cannot write, carrying an address hint
+func httpsResponse() []byte {
+	msg := []byte{0x12, 0x34, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0}
+	msg = append(msg, dnsName(hostName+".example.com")...)
+	msg = append(msg, 0, 65, 0, 1)
+	rdata := []byte{0, 1, 0, 0, 4, 0, 4}
+	rdata = append(rdata, hint...)
+	msg = append(msg, 0xc0, 0x0c, 0, 65, 0, 1, 0, 0, 0x0e, 0x10, 0, byte(len(rdata)))
+	return append(msg, rdata...)
+}
+
+// nbnsResponse is a NetBIOS name query response giving an address
+func nbnsResponse() []byte {
+	msg := []byte{0x56, 0x78, 0x85, 0x00, 0, 0, 0, 1, 0, 0, 0, 0}
+	name := make([]byte, 0, 32)
+	for _, c := range []byte(fmt.Sprintf("%-16s", "SECRET")) {
+		name = append(name, 'A'+c>>4, 'A'+c&0x0f)
+	}
+	msg = append(msg, 32)
+	msg = append(msg, name...)
+	msg = append(msg, 0, 0, 0x20, 0, 1, 0, 0, 0x0e, 0x10, 0, 6, 0, 0)
+	return append(msg, netbios...)
+}
+
+// mdnsResponse announces the host's name and address
+func mdnsResponse() []byte {
+	msg := []byte{0, 0, 0x84, 0, 0, 0, 0, 1, 0, 0, 0, 0}
+	msg = append(msg, dnsName(hostName+".local")...)
+	msg = append(msg, 0, 1, 0x80, 1, 0, 0, 0, 120, 0, 4)
+	return append(msg, mdns...)
+}
+
+func dnsName(name string) []byte {
+	var out []byte
+	for _, label := range bytes.Split([]byte(name), []byte(".")) {
+		out = append(out, byte(len(label)))
+		out = append(out, label...)
+	}
+	return append(out, 0)
+}
+
+func dhcpAck() *layers.DHCPv4 {
+	option := func(t layers.DHCPOpt, data []byte) layers.DHCPOption {
+		return layers.NewDHCPOption(t, data)
+	}
+	return &layers.DHCPv4{
+		Operation:    layers.DHCPOpReply,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  6,
+		Xid:          0x1234,
+		ClientIP:     client,
+		YourClientIP: leased,
+		NextServerIP: router,
+		ClientHWAddr: clientMAC,
+		ServerName:   []byte(hostName),
+		Options: layers.DHCPOptions{
+			option(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeAck)}),
+			option(layers.DHCPOptServerID, router),
+			option(layers.DHCPOptRouter, append(append([]byte(nil), router...), gateway...)),
+			option(layers.DHCPOptHostname, []byte(hostName)),
+			option(layers.DHCPOptClientID, append([]byte{1}, clientMAC...)),
+			option(layers.DHCPOptLeaseTime, []byte{0, 0, 0x0e, 0x10}),
+		},
+	}
+}
@@ -0,0 +1,82 @@
+package analysis
+
+import (
+	"github.com/shreethaar/heroPacket/internal/models"
+	"sort"
+	"time"
+)
+
+const (
+	AnalyzerThroughput = "throughput"
+	TableThroughput    = "throughput"
+)
+
+func init() {
+	Register(Plugin{
+		Name:        AnalyzerThroughput,
+		Title:       "Throughput",
+		Version:     "1.0.0",
+		Description: "Packets, bytes and bit rate over time",
+		Config: []ConfigOption{
+			{Name: "interval", Type: ColumnNumber, Default: "1", Description: "Length of each interval in seconds"},
+		},
+		Tables: []TableDefinition{{
+			Name:  TableThroughput,
+			Title: "Throughput",
+			Columns: []TableColumn{
+				{"start", ColumnTime}, {"packets", ColumnInteger}, {"bytes", ColumnInteger}, {"bits_per_second", ColumnNumber},
+			},
+		}},
+		New: func(s *Session, config Config) Analyzer {
+			interval := time.Duration(config.Float("interval") * float64(time.Second))
+			if interval < time.Millisecond {
+				interval = time.Millisecond
+			}
+			return &ThroughputAnalyzer{Interval: interval, intervals: make(map[int64]*throughputInterval)}
+		},
+	})
+}
+
+type throughputInterval struct {
+	packets int
+	bytes   int
+}
+
+// ThroughputAnalyzer totals the traffic of each interval of the capture,
+// counted from the start of the first packet's interval
+type ThroughputAnalyzer struct {
+	Interval  time.Duration
+	intervals map[int64]*throughputInterval
+}
+
+func (t *ThroughputAnalyzer) Process(packet models.Packet) {
+	if packet.Timestamp.IsZero() {
+		return
+	}
+	key := packet.Timestamp.UnixNano() / int64(t.Interval)
+	interval := t.intervals[key]
+	if interval == nil {
+		interval = &throughputInterval{}
+		t.intervals[key] = interval
+	}
+	interval.packets++
+	interval.bytes += packet.Length
+}
+
+// Table lists the intervals that had traffic, in order
+func (t *ThroughputAnalyzer) Table(name string) (*Table, error) {
+	table := NewTable(name)
+	keys := make([]int64, 0, len(t.intervals))
+	for key := range t.intervals {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	seconds := t.Interval.Seconds()
+	for _, key := range keys {
+		interval := t.intervals[key]
+		start := time.Unix(0, key*int64(t.Interval)).UTC()
+		table.Add(start, interval.packets, interval.bytes, float64(interval.bytes*8)/seconds)
+	}
+	return table, nil
+}
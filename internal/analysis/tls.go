@@ -0,0 +1,518 @@
+package analysis
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/shreethaar/heroPacket/internal/models"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tlsRecordChangeCipherSpec = 20
+	tlsRecordHandshake        = 22
+
+	tlsClientHello = 1
+	tlsServerHello = 2
+
+	tlsExtServerName          = 0
+	tlsExtSupportedGroups     = 10
+	tlsExtECPointFormats      = 11
+	tlsExtSignatureAlgorithms = 13
+	tlsExtALPN                = 16
+	tlsExtSupportedVersions   = 43
+)
+
+// TLSSession describes the handshake of one TLS connection.
+type TLSSession struct {
+	StreamIndex       int
+	ClientIP          string
+	ClientPort        uint16
+	ServerIP          string
+	ServerPort        uint16
+	SNI               string
+	ClientVersion     uint16   // Legacy version field of the ClientHello
+	OfferedVersions   []uint16 // supported_versions, or the legacy version
+	NegotiatedVersion uint16
+	CipherSuites      []uint16
+	CipherSuite       uint16
+	ALPN              []string
+	NegotiatedALPN    string
+	Extensions        []uint16
+	ServerExtensions  []uint16
+	JA3               string
+	JA3Hash           string
+	JA3S              string
+	JA3SHash          string
+	JA4               string
+	Decrypted         bool
+	DecryptionError   string // Why the session could not be decrypted
+
+	// Hello fields only needed to compute the fingerprints
+	groups              []uint16
+	pointFormats        []uint16
+	signatureAlgorithms []uint16
+	serverVersion       uint16
+
+	// Hello randoms, which identify the session in key logs
+	clientRandom []byte
+	serverRandom []byte
+
+	started time.Time // Start of the stream, when the server name was seen
+}
+
+type TLSAnalyzer struct {
+	mu       sync.Mutex
+	Sessions []*TLSSession
+	SNIs     map[string]int // Server name -> count
+	JA3      map[string]int // JA3 hash -> count
+	JA3S     map[string]int // JA3S hash -> count
+	JA4      map[string]int // JA4 fingerprint -> count
+	Versions map[string]int // Negotiated version -> count
+	KeyLog   *KeyLog        // Secrets used to decrypt sessions, if any
+}
+
+type TLSCount struct {
+	Name  string
+	Count int
+}
+
+func NewTLSAnalyzer() *TLSAnalyzer {
+	return &TLSAnalyzer{
+		SNIs:     make(map[string]int),
+		JA3:      make(map[string]int),
+		JA3S:     make(map[string]int),
+		JA4:      make(map[string]int),
+		Versions: make(map[string]int),
+	}
+}
+
+// Process is a no-op: hellos can span several segments, so they are parsed
+// from reassembled streams in ProcessStream instead.
+func (t *TLSAnalyzer) Process(packet models.Packet) {
+}
+
+func (t *TLSAnalyzer) ProcessStream(stream *Stream) {
+	if stream.Protocol != "TCP" {
+		return
+	}
+	client := stream.Data(ClientToServer)
+	if !looksLikeTLS(client) {
+		return
+	}
+
+	session := &TLSSession{
+		StreamIndex: stream.Index,
+		ClientIP:    stream.ClientIP,
+		ClientPort:  stream.ClientPort,
+		ServerIP:    stream.ServerIP,
+		ServerPort:  stream.ServerPort,
+		started:     stream.StartTime,
+	}
+
+	found := false
+	for _, msg := range tlsHandshakeMessages(client) {
+		if msg.Type == tlsClientHello {
+			found = parseClientHello(msg.Body, session) == nil
+			break
+		}
+	}
+	if !found {
+		return
+	}
+	for _, msg := range tlsHandshakeMessages(stream.Data(ServerToClient)) {
+		if msg.Type == tlsServerHello {
+			parseServerHello(msg.Body, session)
+			break
+		}
+	}
+	session.fingerprint()
+	t.decrypt(stream, session)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Sessions = append(t.Sessions, session)
+	if session.SNI != "" {
+		t.SNIs[session.SNI]++
+	}
+	t.JA3[session.JA3Hash]++
+	t.JA4[session.JA4]++
+	if session.JA3SHash != "" {
+		t.JA3S[session.JA3SHash]++
+	}
+	if session.NegotiatedVersion != 0 {
+		t.Versions[TLSVersionName(session.NegotiatedVersion)]++
+	}
+}
+
+func looksLikeTLS(data []byte) bool {
+	return len(data) >= 6 && data[0] == tlsRecordHandshake && data[1] == 3 && data[5] == tlsClientHello
+}
+
+type tlsHandshakeMessage struct {
+	Type byte
+	Body []byte
+}
+
+// tlsHandshakeMessages reassembles the cleartext handshake messages at the
+// start of one direction of a TLS stream. It stops at ChangeCipherSpec or
+// any other record type, since everything after that is encrypted.
+func tlsHandshakeMessages(data []byte) []tlsHandshakeMessage {
+	var buf []byte
+	for len(data) >= 5 {
+		contentType := data[0]
+		length := int(binary.BigEndian.Uint16(data[3:5]))
+		if contentType != tlsRecordHandshake || len(data) < 5+length {
+			break
+		}
+		buf = append(buf, data[5:5+length]...)
+		data = data[5+length:]
+	}
+
+	var messages []tlsHandshakeMessage
+	for len(buf) >= 4 {
+		length := int(buf[1])<<16 | int(buf[2])<<8 | int(buf[3])
+		if len(buf) < 4+length {
+			break
+		}
+		messages = append(messages, tlsHandshakeMessage{Type: buf[0], Body: buf[4 : 4+length]})
+		buf = buf[4+length:]
+	}
+	return messages
+}
+
+// tlsReader is a bounds-checked cursor over handshake message fields.
+type tlsReader struct {
+	data []byte
+	err  error
+}
+
+func (r *tlsReader) bytes(n int) []byte {
+	if r.err != nil || len(r.data) < n {
+		r.err = fmt.Errorf("truncated TLS message")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *tlsReader) uint8() int {
+	if b := r.bytes(1); b != nil {
+		return int(b[0])
+	}
+	return 0
+}
+
+func (r *tlsReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *tlsReader) vector8() []byte {
+	return r.bytes(r.uint8())
+}
+
+func (r *tlsReader) vector16() []byte {
+	return r.bytes(int(r.uint16()))
+}
+
+func parseClientHello(body []byte, session *TLSSession) error {
+	r := &tlsReader{data: body}
+	session.ClientVersion = r.uint16()
+	session.clientRandom = r.bytes(32)
+	r.vector8() // session id
+	suites := &tlsReader{data: r.vector16()}
+	for len(suites.data) >= 2 {
+		session.CipherSuites = append(session.CipherSuites, suites.uint16())
+	}
+	r.vector8() // compression methods
+	if r.err != nil {
+		return r.err
+	}
+
+	session.OfferedVersions = []uint16{session.ClientVersion}
+	extensions := &tlsReader{data: r.vector16()}
+	for len(extensions.data) >= 4 && extensions.err == nil {
+		extType := extensions.uint16()
+		ext := &tlsReader{data: extensions.vector16()}
+		session.Extensions = append(session.Extensions, extType)
+
+		switch extType {
+		case tlsExtServerName:
+			names := &tlsReader{data: ext.vector16()}
+			for len(names.data) >= 3 {
+				nameType := names.uint8()
+				name := names.vector16()
+				if nameType == 0 && session.SNI == "" {
+					session.SNI = string(name)
+				}
+			}
+		case tlsExtSupportedGroups:
+			groups := &tlsReader{data: ext.vector16()}
+			for len(groups.data) >= 2 {
+				session.groups = append(session.groups, groups.uint16())
+			}
+		case tlsExtECPointFormats:
+			for _, f := range ext.vector8() {
+				session.pointFormats = append(session.pointFormats, uint16(f))
+			}
+		case tlsExtSignatureAlgorithms:
+			algorithms := &tlsReader{data: ext.vector16()}
+			for len(algorithms.data) >= 2 {
+				session.signatureAlgorithms = append(session.signatureAlgorithms, algorithms.uint16())
+			}
+		case tlsExtALPN:
+			protocols := &tlsReader{data: ext.vector16()}
+			for len(protocols.data) > 0 && protocols.err == nil {
+				session.ALPN = append(session.ALPN, string(protocols.vector8()))
+			}
+		case tlsExtSupportedVersions:
+			versions := &tlsReader{data: ext.vector8()}
+			session.OfferedVersions = nil
+			for len(versions.data) >= 2 {
+				session.OfferedVersions = append(session.OfferedVersions, versions.uint16())
+			}
+		}
+	}
+	return nil
+}
+
+func parseServerHello(body []byte, session *TLSSession) {
+	r := &tlsReader{data: body}
+	session.serverVersion = r.uint16()
+	session.NegotiatedVersion = session.serverVersion
+	session.serverRandom = r.bytes(32)
+	r.vector8() // session id
+	session.CipherSuite = r.uint16()
+	r.uint8() // compression method
+	if r.err != nil {
+		return
+	}
+
+	extensions := &tlsReader{data: r.vector16()}
+	for len(extensions.data) >= 4 && extensions.err == nil {
+		extType := extensions.uint16()
+		ext := &tlsReader{data: extensions.vector16()}
+		session.ServerExtensions = append(session.ServerExtensions, extType)
+
+		switch extType {
+		case tlsExtSupportedVersions:
+			if v := ext.uint16(); ext.err == nil {
+				session.NegotiatedVersion = v
+			}
+		case tlsExtALPN:
+			protocols := &tlsReader{data: ext.vector16()}
+			session.NegotiatedALPN = string(protocols.vector8())
+		}
+	}
+}
+
+// isGREASE reports whether a value is one of the reserved GREASE values
+// (RFC 8701) that fingerprints must ignore.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func withoutGREASE(values []uint16) []uint16 {
+	var out []uint16
+	for _, v := range values {
+		if !isGREASE(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func joinDecimal(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(int(v))
+	}
+	return strings.Join(parts, "-")
+}
+
+func joinHex(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s *TLSSession) fingerprint() {
+	s.JA3 = fmt.Sprintf("%d,%s,%s,%s,%s",
+		s.ClientVersion,
+		joinDecimal(withoutGREASE(s.CipherSuites)),
+		joinDecimal(withoutGREASE(s.Extensions)),
+		joinDecimal(withoutGREASE(s.groups)),
+		joinDecimal(s.pointFormats),
+	)
+	s.JA3Hash = md5Hex(s.JA3)
+
+	if s.CipherSuite != 0 {
+		// JA3S uses the legacy version field, not the negotiated one.
+		s.JA3S = fmt.Sprintf("%d,%d,%s", s.serverVersion, s.CipherSuite, joinDecimal(s.ServerExtensions))
+		s.JA3SHash = md5Hex(s.JA3S)
+	}
+
+	s.JA4 = s.ja4()
+}
+
+func (s *TLSSession) ja4() string {
+	version := uint16(0)
+	for _, v := range withoutGREASE(s.OfferedVersions) {
+		if v > version {
+			version = v
+		}
+	}
+	versionCode := map[uint16]string{
+		tls.VersionTLS13: "13",
+		tls.VersionTLS12: "12",
+		tls.VersionTLS11: "11",
+		tls.VersionTLS10: "10",
+		tls.VersionSSL30: "s3",
+	}[version]
+	if versionCode == "" {
+		versionCode = "00"
+	}
+
+	sni := "i"
+	if s.SNI != "" {
+		sni = "d"
+	}
+
+	ciphers := withoutGREASE(s.CipherSuites)
+	extensions := withoutGREASE(s.Extensions)
+
+	alpn := "00"
+	if len(s.ALPN) > 0 && len(s.ALPN[0]) > 0 {
+		first := s.ALPN[0]
+		alpn = string(first[0]) + string(first[len(first)-1])
+		if !isAlphanumeric(first[0]) || !isAlphanumeric(first[len(first)-1]) {
+			h := hex.EncodeToString([]byte(first))
+			alpn = string(h[0]) + string(h[len(h)-1])
+		}
+	}
+
+	a := fmt.Sprintf("t%s%s%02d%02d%s", versionCode, sni, min(len(ciphers), 99), min(len(extensions), 99), alpn)
+
+	sortedCiphers := append([]uint16(nil), ciphers...)
+	sort.Slice(sortedCiphers, func(i, j int) bool { return sortedCiphers[i] < sortedCiphers[j] })
+
+	var sortedExtensions []uint16
+	for _, e := range extensions {
+		if e != tlsExtServerName && e != tlsExtALPN {
+			sortedExtensions = append(sortedExtensions, e)
+		}
+	}
+	sort.Slice(sortedExtensions, func(i, j int) bool { return sortedExtensions[i] < sortedExtensions[j] })
+
+	c := joinHex(sortedExtensions)
+	if len(s.signatureAlgorithms) > 0 {
+		c += "_" + joinHex(s.signatureAlgorithms)
+	}
+
+	return a + "_" + ja4Hash(joinHex(sortedCiphers), len(sortedCiphers) == 0) + "_" + ja4Hash(c, len(sortedExtensions) == 0)
+}
+
+func ja4Hash(s string, empty bool) string {
+	if empty {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// TLSVersionName returns the conventional name of a TLS protocol version.
+func TLSVersionName(version uint16) string {
+	if version == 0 {
+		return ""
+	}
+	return tls.VersionName(version)
+}
+
+// CipherSuiteName returns the IANA name of a cipher suite.
+func CipherSuiteName(id uint16) string {
+	if id == 0 {
+		return ""
+	}
+	return tls.CipherSuiteName(id)
+}
+
+func (t *TLSAnalyzer) TopSNIs(n int) []TLSCount {
+	return t.top(t.SNIs, n)
+}
+
+func (t *TLSAnalyzer) TopJA3(n int) []TLSCount {
+	return t.top(t.JA3, n)
+}
+
+func (t *TLSAnalyzer) TopJA4(n int) []TLSCount {
+	return t.top(t.JA4, n)
+}
+
+func (t *TLSAnalyzer) VersionDistribution() []TLSCount {
+	return t.top(t.Versions, len(t.Versions))
+}
+
+func (t *TLSAnalyzer) top(m map[string]int, n int) []TLSCount {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var counts []TLSCount
+	for name, count := range m {
+		counts = append(counts, TLSCount{Name: name, Count: count})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Name < counts[j].Name
+	})
+
+	if len(counts) > n {
+		return counts[:n]
+	}
+	return counts
+}
+
+// GetSessions returns every TLS handshake in stream order.
+// AddNames adds the server names the handshakes asked for
+func (t *TLSAnalyzer) AddNames(names *NameResolver) {
+	for _, session := range t.GetSessions() {
+		names.Add(session.ServerIP, session.SNI, "TLS SNI", session.started)
+	}
+}
+
+func (t *TLSAnalyzer) GetSessions() []*TLSSession {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sessions := make([]*TLSSession, len(t.Sessions))
+	copy(sessions, t.Sessions)
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StreamIndex < sessions[j].StreamIndex
+	})
+	return sessions
+}
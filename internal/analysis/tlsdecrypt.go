@@ -0,0 +1,425 @@
+package analysis
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"sort"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	tlsRecordAlert           = 21
+	tlsRecordApplicationData = 23
+
+	tlsFinished = 20
+)
+
+type tlsCipherKind int
+
+const (
+	tlsCipherGCM tlsCipherKind = iota
+	tlsCipherChaCha20
+	tlsCipherCBC
+)
+
+// tlsCipherSpec describes the record protection of a cipher suite.
+type tlsCipherSpec struct {
+	kind   tlsCipherKind
+	keyLen int
+	ivLen  int // Implicit IV bytes taken from the TLS 1.2 key block
+	macLen int
+	mac    func() hash.Hash
+	prf    func() hash.Hash // PRF hash for TLS 1.2, HKDF hash for TLS 1.3
+}
+
+var tlsCipherSpecs = map[uint16]tlsCipherSpec{
+	// TLS 1.3
+	tls.TLS_AES_128_GCM_SHA256:       {kind: tlsCipherGCM, keyLen: 16, ivLen: 12, prf: sha256.New},
+	tls.TLS_AES_256_GCM_SHA384:       {kind: tlsCipherGCM, keyLen: 32, ivLen: 12, prf: sha512.New384},
+	tls.TLS_CHACHA20_POLY1305_SHA256: {kind: tlsCipherChaCha20, keyLen: 32, ivLen: 12, prf: sha256.New},
+
+	// TLS 1.2 AEAD
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:         {kind: tlsCipherGCM, keyLen: 16, ivLen: 4, prf: sha256.New},
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:         {kind: tlsCipherGCM, keyLen: 32, ivLen: 4, prf: sha512.New384},
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:   {kind: tlsCipherGCM, keyLen: 16, ivLen: 4, prf: sha256.New},
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:   {kind: tlsCipherGCM, keyLen: 32, ivLen: 4, prf: sha512.New384},
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256: {kind: tlsCipherGCM, keyLen: 16, ivLen: 4, prf: sha256.New},
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384: {kind: tlsCipherGCM, keyLen: 32, ivLen: 4, prf: sha512.New384},
+	0x009e: {kind: tlsCipherGCM, keyLen: 16, ivLen: 4, prf: sha256.New},    // TLS_DHE_RSA_WITH_AES_128_GCM_SHA256
+	0x009f: {kind: tlsCipherGCM, keyLen: 32, ivLen: 4, prf: sha512.New384}, // TLS_DHE_RSA_WITH_AES_256_GCM_SHA384
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256:   {kind: tlsCipherChaCha20, keyLen: 32, ivLen: 12, prf: sha256.New},
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256: {kind: tlsCipherChaCha20, keyLen: 32, ivLen: 12, prf: sha256.New},
+
+	// TLS 1.2 CBC
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA:            {kind: tlsCipherCBC, keyLen: 16, ivLen: 16, macLen: 20, mac: sha1.New, prf: sha256.New},
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA:            {kind: tlsCipherCBC, keyLen: 32, ivLen: 16, macLen: 20, mac: sha1.New, prf: sha256.New},
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA256:         {kind: tlsCipherCBC, keyLen: 16, ivLen: 16, macLen: 32, mac: sha256.New, prf: sha256.New},
+	0x003d:                                      {kind: tlsCipherCBC, keyLen: 32, ivLen: 16, macLen: 32, mac: sha256.New, prf: sha256.New}, // TLS_RSA_WITH_AES_256_CBC_SHA256
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA:      {kind: tlsCipherCBC, keyLen: 16, ivLen: 16, macLen: 20, mac: sha1.New, prf: sha256.New},
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA:      {kind: tlsCipherCBC, keyLen: 32, ivLen: 16, macLen: 20, mac: sha1.New, prf: sha256.New},
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA:    {kind: tlsCipherCBC, keyLen: 16, ivLen: 16, macLen: 20, mac: sha1.New, prf: sha256.New},
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA:    {kind: tlsCipherCBC, keyLen: 32, ivLen: 16, macLen: 20, mac: sha1.New, prf: sha256.New},
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256:   {kind: tlsCipherCBC, keyLen: 16, ivLen: 16, macLen: 32, mac: sha256.New, prf: sha256.New},
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256: {kind: tlsCipherCBC, keyLen: 16, ivLen: 16, macLen: 32, mac: sha256.New, prf: sha256.New},
+	0xc028: {kind: tlsCipherCBC, keyLen: 32, ivLen: 16, macLen: 48, mac: sha512.New384, prf: sha512.New384}, // TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA384
+	0xc024: {kind: tlsCipherCBC, keyLen: 32, ivLen: 16, macLen: 48, mac: sha512.New384, prf: sha512.New384}, // TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA384
+}
+
+// tlsRecordCipher removes the protection of records sent in one direction.
+type tlsRecordCipher struct {
+	spec  tlsCipherSpec
+	tls13 bool
+	aead  cipher.AEAD
+	block cipher.Block
+	mac   []byte // CBC MAC key
+	iv    []byte
+	seq   uint64
+}
+
+func newTLSRecordCipher(spec tlsCipherSpec, tls13 bool, key, iv []byte) (*tlsRecordCipher, error) {
+	c := &tlsRecordCipher{spec: spec, tls13: tls13, iv: iv}
+	var err error
+	switch spec.kind {
+	case tlsCipherGCM:
+		var block cipher.Block
+		if block, err = aes.NewCipher(key); err == nil {
+			c.aead, err = cipher.NewGCM(block)
+		}
+	case tlsCipherChaCha20:
+		c.aead, err = chacha20poly1305.New(key)
+	case tlsCipherCBC:
+		c.block, err = aes.NewCipher(key)
+	}
+	return c, err
+}
+
+func (c *tlsRecordCipher) nonce() []byte {
+	nonce := make([]byte, len(c.iv))
+	copy(nonce, c.iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(c.seq >> (8 * i))
+	}
+	return nonce
+}
+
+// decrypt returns the plaintext of one record. header is the 5 byte record
+// header, which TLS 1.3 authenticates as is.
+func (c *tlsRecordCipher) decrypt(header, payload []byte) ([]byte, error) {
+	defer func() { c.seq++ }()
+
+	if c.spec.kind == tlsCipherCBC {
+		if len(payload) < 32 || len(payload)%16 != 0 {
+			return nil, fmt.Errorf("bad CBC record length")
+		}
+		plaintext := make([]byte, len(payload)-16)
+		cipher.NewCBCDecrypter(c.block, payload[:16]).CryptBlocks(plaintext, payload[16:])
+		padding := int(plaintext[len(plaintext)-1]) + 1
+		if padding+c.spec.macLen > len(plaintext) {
+			return nil, fmt.Errorf("bad CBC padding")
+		}
+		for _, b := range plaintext[len(plaintext)-padding:] {
+			if int(b) != padding-1 {
+				return nil, fmt.Errorf("bad CBC padding")
+			}
+		}
+
+		// MAC-then-encrypt: the MAC covers the sequence number, the record
+		// header with the plaintext length, and the plaintext
+		content := plaintext[:len(plaintext)-padding-c.spec.macLen]
+		additional := make([]byte, 13)
+		binary.BigEndian.PutUint64(additional, c.seq)
+		copy(additional[8:11], header[:3])
+		binary.BigEndian.PutUint16(additional[11:], uint16(len(content)))
+		mac := hmac.New(c.spec.mac, c.mac)
+		mac.Write(additional)
+		mac.Write(content)
+		if !hmac.Equal(mac.Sum(nil), plaintext[len(content):len(content)+c.spec.macLen]) {
+			return nil, fmt.Errorf("bad record MAC")
+		}
+		return content, nil
+	}
+
+	overhead := c.aead.Overhead()
+	if c.tls13 {
+		return c.aead.Open(nil, c.nonce(), payload, header)
+	}
+
+	// TLS 1.2 GCM sends part of the nonce explicitly; ChaCha20 derives it
+	// from the sequence number like TLS 1.3.
+	var nonce []byte
+	ciphertext := payload
+	if c.spec.kind == tlsCipherGCM {
+		if len(payload) < 8+overhead {
+			return nil, fmt.Errorf("short GCM record")
+		}
+		nonce = append(append([]byte(nil), c.iv...), payload[:8]...)
+		ciphertext = payload[8:]
+	} else {
+		nonce = c.nonce()
+	}
+	if len(ciphertext) < overhead {
+		return nil, fmt.Errorf("short AEAD record")
+	}
+
+	additional := make([]byte, 13)
+	binary.BigEndian.PutUint64(additional, c.seq)
+	copy(additional[8:11], header[:3])
+	binary.BigEndian.PutUint16(additional[11:], uint16(len(ciphertext)-overhead))
+	return c.aead.Open(nil, nonce, ciphertext, additional)
+}
+
+// tls12PRF implements the TLS 1.2 P_hash expansion (RFC 5246 section 5).
+func tls12PRF(h func() hash.Hash, secret []byte, label string, seed []byte, length int) []byte {
+	labelSeed := append([]byte(label), seed...)
+	mac := hmac.New(h, secret)
+	mac.Write(labelSeed)
+	a := mac.Sum(nil)
+
+	var out []byte
+	for len(out) < length {
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(labelSeed)
+		out = append(out, mac.Sum(nil)...)
+
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+	}
+	return out[:length]
+}
+
+// hkdfExpandLabel implements HKDF-Expand-Label (RFC 8446 section 7.1).
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, length int) []byte {
+	full := "tls13 " + label
+	info := []byte{byte(length >> 8), byte(length), byte(len(full))}
+	info = append(info, full...)
+	info = append(info, 0) // empty context
+
+	out := make([]byte, length)
+	hkdf.Expand(h, secret, info).Read(out)
+	return out
+}
+
+func tls13RecordCipher(spec tlsCipherSpec, secret []byte) (*tlsRecordCipher, error) {
+	key := hkdfExpandLabel(spec.prf, secret, "key", spec.keyLen)
+	iv := hkdfExpandLabel(spec.prf, secret, "iv", spec.ivLen)
+	return newTLSRecordCipher(spec, true, key, iv)
+}
+
+type tlsRecord struct {
+	offset      int
+	contentType byte
+	header      []byte
+	payload     []byte
+}
+
+func tlsRecords(data []byte) []tlsRecord {
+	var records []tlsRecord
+	for offset := 0; offset+5 <= len(data); {
+		length := int(binary.BigEndian.Uint16(data[offset+3 : offset+5]))
+		if offset+5+length > len(data) {
+			break
+		}
+		records = append(records, tlsRecord{
+			offset:      offset,
+			contentType: data[offset],
+			header:      data[offset : offset+5],
+			payload:     data[offset+5 : offset+5+length],
+		})
+		offset += 5 + length
+	}
+	return records
+}
+
+// tlsPlaintext is decrypted application data and where its record started
+// in the direction's ciphertext.
+type tlsPlaintext struct {
+	direction StreamDirection
+	offset    int
+	data      []byte
+}
+
+// decrypt recovers the application data of a TLS stream. On success it sets
+// stream.Decrypted; otherwise session.DecryptionError explains why not.
+func (t *TLSAnalyzer) decrypt(stream *Stream, session *TLSSession) {
+	if t.KeyLog.Len() == 0 {
+		session.DecryptionError = "no key log provided"
+		return
+	}
+	if session.CipherSuite == 0 {
+		session.DecryptionError = "ServerHello missing from capture"
+		return
+	}
+	secrets := t.KeyLog.Lookup(session.clientRandom)
+	if secrets == nil {
+		session.DecryptionError = "no secrets logged for this client random"
+		return
+	}
+	spec, supported := tlsCipherSpecs[session.CipherSuite]
+	if !supported {
+		session.DecryptionError = "unsupported cipher suite " + CipherSuiteName(session.CipherSuite)
+		return
+	}
+
+	var plaintext []tlsPlaintext
+	for _, dir := range []StreamDirection{ClientToServer, ServerToClient} {
+		var records []tlsPlaintext
+		var err error
+		switch {
+		case session.NegotiatedVersion == tls.VersionTLS13:
+			records, err = decryptTLS13(stream.Data(dir), dir, spec, secrets)
+		case session.NegotiatedVersion == tls.VersionTLS12:
+			records, err = decryptTLS12(stream.Data(dir), dir, spec, secrets, session)
+		default:
+			err = fmt.Errorf("%s decryption is not supported", TLSVersionName(session.NegotiatedVersion))
+		}
+		if err != nil {
+			session.DecryptionError = fmt.Sprintf("%s: %v", dir, err)
+			return
+		}
+		plaintext = append(plaintext, records...)
+	}
+
+	// Interleave both directions in the order their records were captured.
+	sort.SliceStable(plaintext, func(i, j int) bool {
+		return stream.chunkIndex(plaintext[i].direction, plaintext[i].offset) <
+			stream.chunkIndex(plaintext[j].direction, plaintext[j].offset)
+	})
+
+	decrypted := &Stream{
+		Index:      stream.Index,
+		Protocol:   stream.Protocol,
+		ClientIP:   stream.ClientIP,
+		ClientPort: stream.ClientPort,
+		ServerIP:   stream.ServerIP,
+		ServerPort: stream.ServerPort,
+		Packets:    stream.Packets,
+		Numbers:    stream.Numbers,
+		StartTime:  stream.StartTime,
+		EndTime:    stream.EndTime,
+	}
+	for _, record := range plaintext {
+		chunk := stream.Chunks[stream.chunkIndex(record.direction, record.offset)]
+		decrypted.appendData(record.direction, stream.TimeAt(record.direction, record.offset), chunk.Packet, record.data, true)
+	}
+
+	stream.Decrypted = decrypted
+	session.Decrypted = true
+}
+
+func decryptTLS12(data []byte, dir StreamDirection, spec tlsCipherSpec, secrets *TLSSecrets, session *TLSSession) ([]tlsPlaintext, error) {
+	if secrets.MasterSecret == nil {
+		return nil, fmt.Errorf("key log has no CLIENT_RANDOM master secret")
+	}
+
+	seed := append(append([]byte(nil), session.serverRandom...), session.clientRandom...)
+	keyBlock := tls12PRF(spec.prf, secrets.MasterSecret, "key expansion", seed, 2*(spec.macLen+spec.keyLen+spec.ivLen))
+	keys := keyBlock[2*spec.macLen:]
+	macKey, key, iv := keyBlock[:spec.macLen], keys[:spec.keyLen], keys[2*spec.keyLen:2*spec.keyLen+spec.ivLen]
+	if dir == ServerToClient {
+		macKey, key, iv = keyBlock[spec.macLen:2*spec.macLen], keys[spec.keyLen:2*spec.keyLen], keys[2*spec.keyLen+spec.ivLen:]
+	}
+	c, err := newTLSRecordCipher(spec, false, key, iv)
+	if err != nil {
+		return nil, err
+	}
+	c.mac = macKey
+
+	var out []tlsPlaintext
+	encrypted := false
+	for _, record := range tlsRecords(data) {
+		if record.contentType == tlsRecordChangeCipherSpec {
+			encrypted = true
+			continue
+		}
+		if !encrypted {
+			continue
+		}
+		plaintext, err := c.decrypt(record.header, record.payload)
+		if err != nil {
+			return nil, fmt.Errorf("record %d failed to decrypt: %v", c.seq-1, err)
+		}
+		if record.contentType == tlsRecordApplicationData && len(plaintext) > 0 {
+			out = append(out, tlsPlaintext{direction: dir, offset: record.offset, data: plaintext})
+		}
+	}
+	return out, nil
+}
+
+func decryptTLS13(data []byte, dir StreamDirection, spec tlsCipherSpec, secrets *TLSSecrets) ([]tlsPlaintext, error) {
+	handshakeSecret, trafficSecret := secrets.ClientHandshake, secrets.ClientTraffic
+	if dir == ServerToClient {
+		handshakeSecret, trafficSecret = secrets.ServerHandshake, secrets.ServerTraffic
+	}
+	if handshakeSecret == nil || trafficSecret == nil {
+		return nil, fmt.Errorf("key log is missing TLS 1.3 %s secrets", dir)
+	}
+
+	c, err := tls13RecordCipher(spec, handshakeSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []tlsPlaintext
+	var handshake []byte
+	inHandshake := true
+	for _, record := range tlsRecords(data) {
+		if record.contentType != tlsRecordApplicationData {
+			continue // Cleartext hellos and compatibility ChangeCipherSpec
+		}
+		plaintext, err := c.decrypt(record.header, record.payload)
+		if err != nil {
+			return nil, fmt.Errorf("record %d failed to decrypt: %v", c.seq-1, err)
+		}
+
+		// The real content type is the last non-zero byte.
+		end := len(plaintext) - 1
+		for end >= 0 && plaintext[end] == 0 {
+			end--
+		}
+		if end < 0 {
+			continue
+		}
+		contentType, content := plaintext[end], plaintext[:end]
+
+		switch contentType {
+		case tlsRecordApplicationData:
+			if len(content) > 0 {
+				out = append(out, tlsPlaintext{direction: dir, offset: record.offset, data: content})
+			}
+		case tlsRecordHandshake:
+			if !inHandshake {
+				continue // Post-handshake messages such as NewSessionTicket
+			}
+			handshake = append(handshake, content...)
+			for len(handshake) >= 4 {
+				length := int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+				if len(handshake) < 4+length {
+					break
+				}
+				msgType := handshake[0]
+				handshake = handshake[4+length:]
+				if msgType == tlsFinished {
+					// Application traffic keys protect everything after Finished.
+					if c, err = tls13RecordCipher(spec, trafficSecret); err != nil {
+						return nil, err
+					}
+					inHandshake = false
+					break
+				}
+			}
+		}
+	}
+	return out, nil
+}
@@ -3,6 +3,7 @@ package analysis
 import (
     "github.com/wcharczuk/go-chart"
     "net/http"
+    "time"
 )
 
 type Visualization struct {
@@ -46,3 +47,45 @@ func (v *Visualization) SizeDistributionChart(buckets map[string]int, w http.Res
     w.Header().Set("Content-Type", "image/svg+xml")
     return barChart.Render(chart.SVG, w)
 }
+
+func (v *Visualization) HostTrafficChart(points []TrafficPoint, w http.ResponseWriter) error {
+    var times []time.Time
+    var sent, received []float64
+    for _, point := range points {
+        times = append(times, point.Time)
+        sent = append(sent, float64(point.BytesSent))
+        received = append(received, float64(point.BytesReceived))
+    }
+    // A line needs two points; extend a single interval by a second
+    if len(times) == 1 {
+        times = append(times, times[0].Add(time.Second))
+        sent = append(sent, sent[0])
+        received = append(received, received[0])
+    }
+    if len(times) == 0 {
+        times = []time.Time{time.Unix(0, 0), time.Unix(1, 0)}
+        sent, received = []float64{0, 0}, []float64{0, 0}
+    }
+
+    graph := chart.Chart{
+        Width:  900,
+        Height: 300,
+        XAxis: chart.XAxis{
+            Style:          chart.StyleShow(),
+            ValueFormatter: chart.TimeValueFormatterWithFormat("15:04:05"),
+        },
+        YAxis: chart.YAxis{
+            Name:      "Bytes",
+            NameStyle: chart.StyleShow(),
+            Style:     chart.StyleShow(),
+        },
+        Series: []chart.Series{
+            chart.TimeSeries{Name: "Sent", XValues: times, YValues: sent},
+            chart.TimeSeries{Name: "Received", XValues: times, YValues: received},
+        },
+    }
+    graph.Elements = []chart.Renderable{chart.Legend(&graph)}
+
+    w.Header().Set("Content-Type", "image/svg+xml")
+    return graph.Render(chart.SVG, w)
+}
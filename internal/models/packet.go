@@ -3,20 +3,81 @@ package models
 import "time"
 
 type Packet struct {
-    Timestamp  time.Time
-    SourceIP   string
-    DestIP     string
-    Protocol   string
-    Length     int
-    SourcePort uint16
-    DestPort   uint16
-    DNS        *DNSInfo
+    Number      int
+    Timestamp   time.Time
+    SourceMAC   string
+    DestMAC     string
+    SourceIP    string
+    DestIP      string
+    Protocol    string
+    Layers      []string // Protocol stack, outermost first
+    Length      int
+    FrameLength int   // Bytes on the wire, including the link layer
+    TTL         uint8 // IPv4 TTL or IPv6 hop limit
+    SourcePort  uint16
+    DestPort    uint16
+    TCP         *TCPInfo
+    Payload     []byte
+    DNS         *DNSInfo
+    HostNames   []HostName
+    DecodeError string // Why a layer failed to decode, empty if none did
+    Info        string // One-line summary for the packet list
+}
+
+type TCPInfo struct {
+    Seq         uint32
+    Ack         uint32
+    SYN         bool
+    ACK         bool
+    FIN         bool
+    RST         bool
+    PSH         bool
+    Window      uint16
+    WindowScale int // Shift from the window scale option, -1 without one
+}
+
+// HostName is a name claimed by or assigned to an address in a packet,
+// e.g. through DHCP, NBNS or mDNS.
+type HostName struct {
+    IP     string
+    Name   string
+    Source string
 }
 
 type DNSInfo struct {
+    ID           uint16
     QR           bool
     OpCode       string
-    Questions    []string
-    Answers      []string
-    ResponseCode string
+    Truncated    bool
+    Questions    []DNSQuestion
+    Answers      []DNSRecord
+    Authorities  []DNSRecord
+    Additionals  []DNSRecord // Excluding the EDNS OPT record
+    ResponseCode string      // Mnemonic such as NOERROR or NXDOMAIN
+    Transport    string      // "UDP" or "TCP"
+    EDNS         *EDNSInfo
+}
+
+type DNSQuestion struct {
+    Name  string
+    Type  string
+    Class string
+}
+
+// DNSRecord is a resource record with its data rendered in zone file
+// presentation format.
+type DNSRecord struct {
+    Name  string
+    Type  string
+    Class string
+    TTL   uint32
+    Data  string
+}
+
+// EDNSInfo holds the contents of an EDNS(0) OPT pseudo-record.
+type EDNSInfo struct {
+    UDPSize  uint16
+    Version  uint8
+    DNSSECOK bool
+    Options  []string // Option name and value, e.g. "ECS 192.0.2.0/24"
 }
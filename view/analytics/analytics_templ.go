@@ -10,7 +10,7 @@ import templruntime "github.com/a-h/templ/runtime"
 
 import (
 	"fmt"
-	"heroPacket/internal/analysis"
+	"github.com/shreethaar/heroPacket/internal/analysis"
 )
 
 type ViewData struct {
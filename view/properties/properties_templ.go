@@ -9,7 +9,7 @@ import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
 import (
-	"heroPacket/internal/analysis"
+	"github.com/shreethaar/heroPacket/internal/analysis"
 	"strconv"
 	"time"
 )